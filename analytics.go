@@ -0,0 +1,56 @@
+package heimdall
+
+import "hash/fnv"
+
+// AnalyticsEvent is a coarse summary of a login attempt for product analytics.
+// It deliberately carries no PII: no IP address, user ID, session ID,
+// User-Agent or precise coordinates.
+type AnalyticsEvent struct {
+	// CountryCode is the ISO country code of the login, if known.
+	CountryCode string `json:"country_code"`
+
+	// Country is the country name of the login, if known.
+	Country string `json:"country"`
+
+	// DeviceType is the coarse device class.
+	DeviceType DeviceType `json:"device_type"`
+
+	// IsNewLocation mirrors RegisterResult.IsNewLocation.
+	IsNewLocation bool `json:"is_new_location"`
+
+	// LimitExceeded mirrors RegisterResult.LimitExceeded.
+	LimitExceeded bool `json:"limit_exceeded"`
+
+	// UserBucket is a hash of the user ID reduced to Config.AnalyticsUserBuckets
+	// buckets, so trends can be split into cohorts without identifying users.
+	UserBucket uint32 `json:"user_bucket"`
+}
+
+// AnalyticsSink receives anonymized login events from RegisterSession.
+// Emit is called synchronously, so implementations should not block.
+type AnalyticsSink interface {
+	Emit(event AnalyticsEvent)
+}
+
+// emitAnalytics sends a PII-free event for a registration to the configured sink.
+func (h *Heimdall) emitAnalytics(userID string, device DeviceInfo, location LocationInfo, result *RegisterResult) {
+	if h.config.AnalyticsSink == nil {
+		return
+	}
+
+	h.config.AnalyticsSink.Emit(AnalyticsEvent{
+		CountryCode:   location.CountryCode,
+		Country:       location.Country,
+		DeviceType:    device.DeviceType,
+		IsNewLocation: result.IsNewLocation,
+		LimitExceeded: result.LimitExceeded,
+		UserBucket:    userBucket(userID, h.config.AnalyticsUserBuckets),
+	})
+}
+
+// userBucket hashes a user ID into one of n buckets.
+func userBucket(userID string, n int) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(userID))
+	return hash.Sum32() % uint32(n)
+}
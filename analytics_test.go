@@ -0,0 +1,67 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// recordingSink collects emitted analytics events.
+type recordingSink struct {
+	events []AnalyticsEvent
+}
+
+func (s *recordingSink) Emit(event AnalyticsEvent) {
+	s.events = append(s.events, event)
+}
+
+func TestAnalyticsEventsContainNoPII(t *testing.T) {
+	sink := &recordingSink{}
+	h, err := newTestHeimdallWithConfig(Config{AnalyticsSink: sink})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	userID := "alice@example.com"
+	device := DeviceInfo{IP: "203.0.113.77", UserAgent: "Mozilla/5.0", Browser: "Chrome", DeviceType: "mobile"}
+	nyc := LocationInfo{IP: device.IP, City: "New York", Country: "United States", CountryCode: "US", Latitude: 40.7128, Longitude: -74.0060}
+	london := LocationInfo{IP: device.IP, City: "London", Country: "United Kingdom", CountryCode: "GB", Latitude: 51.5074, Longitude: -0.1278}
+
+	if _, err := h.RegisterSession(userID, "secret-session-1", device, nyc, 1); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if _, err := h.RegisterSession(userID, "secret-session-2", device, london, 1); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(sink.events))
+	}
+
+	first, second := sink.events[0], sink.events[1]
+	if first.CountryCode != "US" || first.DeviceType != "mobile" || first.IsNewLocation || first.LimitExceeded {
+		t.Errorf("Unexpected first event: %+v", first)
+	}
+	if second.CountryCode != "GB" || !second.IsNewLocation || !second.LimitExceeded {
+		t.Errorf("Unexpected second event: %+v", second)
+	}
+	if first.UserBucket != second.UserBucket {
+		t.Errorf("Same user should map to the same bucket, got %d and %d", first.UserBucket, second.UserBucket)
+	}
+	if first.UserBucket >= 1024 {
+		t.Errorf("UserBucket %d out of range", first.UserBucket)
+	}
+
+	for _, event := range sink.events {
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			t.Fatalf("Failed to encode event: %v", err)
+		}
+		for _, pii := range []string{userID, device.IP, "secret-session", "Mozilla", "New York", "40.71"} {
+			if strings.Contains(string(encoded), pii) {
+				t.Errorf("Event %s contains PII %q", encoded, pii)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package heimdall
+
+import (
+	"fmt"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// DetectConcurrentAnomaly reports whether any two of the user's active
+// sessions are farther apart than thresholdKM, which suggests account
+// sharing or a compromised account. If so it returns the farthest pair of
+// sessions, newest first. Sessions without coordinates are ignored.
+func (h *Heimdall) DetectConcurrentAnomaly(userID string, thresholdKM float64) (bool, []*Session, error) {
+	storeSessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return false, nil, fmt.Errorf("heimdall: failed to get active sessions: %w", err)
+	}
+
+	var located []*Session
+	for _, s := range storeSessions {
+		session := storeToSession(s)
+		if hasCoordinates(session.Location) {
+			located = append(located, session)
+		}
+	}
+
+	var pair []*Session
+	farthest := thresholdKM
+	for i, a := range located {
+		for _, b := range located[i+1:] {
+			distance := HaversineDistance(
+				a.Location.Latitude, a.Location.Longitude,
+				b.Location.Latitude, b.Location.Longitude,
+			)
+			if distance > farthest {
+				pair = []*Session{a, b}
+				farthest = distance
+			}
+		}
+	}
+	return pair != nil, pair, nil
+}
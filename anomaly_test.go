@@ -0,0 +1,60 @@
+package heimdall
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDetectConcurrentAnomaly(t *testing.T) {
+	newYork := LocationInfo{City: "New York", Latitude: 40.7128, Longitude: -74.0060}
+	brooklyn := LocationInfo{City: "Brooklyn", Latitude: 40.6782, Longitude: -73.9442}
+	boston := LocationInfo{City: "Boston", Latitude: 42.3601, Longitude: -71.0589}
+	tokyo := LocationInfo{City: "Tokyo", Latitude: 35.6762, Longitude: 139.6503}
+	unknown := LocationInfo{}
+
+	tests := []struct {
+		name      string
+		locations []LocationInfo
+		wantPair  []string // cities of the expected pair, newest first
+	}{
+		{"co-located", []LocationInfo{newYork, brooklyn, unknown}, nil},
+		{"single session", []LocationInfo{tokyo}, nil},
+		{"split", []LocationInfo{newYork, unknown, tokyo}, []string{"Tokyo", "New York"}},
+		{"farthest pair", []LocationInfo{newYork, boston, tokyo}, []string{"Tokyo", "New York"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := newTestHeimdall()
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			for i, location := range tt.locations {
+				device := DeviceInfo{IP: "8.8.8.8", UserAgent: "test"}
+				opts := RegisterOptions{CreatedAt: time.Now().Add(-time.Duration(len(tt.locations)-i) * time.Minute)}
+				if _, err := h.RegisterSessionWithOptions("user123", fmt.Sprintf("session%d", i), device, location, 0, opts); err != nil {
+					t.Fatalf("Failed to register session: %v", err)
+				}
+			}
+
+			anomaly, pair, err := h.DetectConcurrentAnomaly("user123", 1000)
+			if err != nil {
+				t.Fatalf("DetectConcurrentAnomaly failed: %v", err)
+			}
+			if anomaly != (tt.wantPair != nil) {
+				t.Fatalf("Expected anomaly %v, got %v", tt.wantPair != nil, anomaly)
+			}
+			if tt.wantPair == nil {
+				if pair != nil {
+					t.Errorf("Expected no pair, got %v", pair)
+				}
+				return
+			}
+			if len(pair) != 2 || pair[0].Location.City != tt.wantPair[0] || pair[1].Location.City != tt.wantPair[1] {
+				t.Errorf("Expected pair %v, got %v", tt.wantPair, pair)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package heimdall
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// ASNReader looks up the autonomous system (network operator) of IPs using a
+// MaxMind GeoLite2-ASN database.
+type ASNReader struct {
+	db *geoip2.Reader
+}
+
+// NewASNReader opens a MaxMind GeoLite2-ASN database.
+// A file that is not a MaxMind database, or is an edition without ASN data,
+// is rejected with ErrGeoIPDatabaseInvalid.
+func NewASNReader(dbPath string) (*ASNReader, error) {
+	if dbPath == "" {
+		return nil, ErrGeoIPDatabaseNotConfigured
+	}
+
+	db, err := geoip2.Open(dbPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("geoip: failed to open ASN database: %w", err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrGeoIPDatabaseInvalid, err)
+	}
+
+	dbType := db.Metadata().DatabaseType
+	if !strings.Contains(dbType, "ASN") {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s has no ASN data", ErrGeoIPDatabaseInvalid, dbType)
+	}
+
+	return &ASNReader{db: db}, nil
+}
+
+// Lookup returns the autonomous system number of an IP address, or 0 if the
+// database has none for it.
+func (r *ASNReader) Lookup(ip string) (uint, error) {
+	if r == nil || r.db == nil {
+		return 0, ErrGeoIPDatabaseNotConfigured
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidIP, ip)
+	}
+
+	record, err := r.db.ASN(parsed)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrGeoIPLookupFailed, err)
+	}
+	return record.AutonomousSystemNumber, nil
+}
+
+// Close closes the ASN database.
+func (r *ASNReader) Close() error {
+	if r == nil || r.db == nil {
+		return nil
+	}
+	return r.db.Close()
+}
+
+// isNewASN reports whether location is on a network (ASN) none of the
+// sessions are on. Sessions and locations without a known ASN are ignored.
+func isNewASN(sessions []*Session, location LocationInfo) bool {
+	if location.ASN == 0 {
+		return false
+	}
+
+	known := false
+	for _, s := range sessions {
+		if s.Location.ASN == 0 {
+			continue
+		}
+		known = true
+		if s.Location.ASN == location.ASN {
+			return false
+		}
+	}
+	return known
+}
@@ -0,0 +1,95 @@
+package heimdall
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRegisterSessionIsNewASN(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	userID := "user123"
+	device := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	home := LocationInfo{City: "New York", Country: "United States", CountryCode: "US", ASN: 7922}
+	office := LocationInfo{City: "New York", Country: "United States", CountryCode: "US", ASN: 3356}
+
+	steps := []struct {
+		name     string
+		location LocationInfo
+		want     bool
+	}{
+		{"first login has no history", home, false},
+		{"repeat ASN", home, false},
+		{"first-time ASN", office, true},
+		{"ASN seen before", office, false},
+		{"unknown ASN", LocationInfo{City: "New York"}, false},
+	}
+
+	for i, step := range steps {
+		result, err := h.RegisterSession(userID, fmt.Sprintf("session%d", i), device, step.location, 0)
+		if err != nil {
+			t.Fatalf("%s: failed to register session: %v", step.name, err)
+		}
+		if result.IsNewASN != step.want {
+			t.Errorf("%s: IsNewASN = %v, want %v", step.name, result.IsNewASN, step.want)
+		}
+	}
+
+	// The ASN is stored with the session
+	sessions, err := h.ListSessions(userID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	asns := make(map[uint]int)
+	for _, s := range sessions {
+		asns[s.Location.ASN]++
+	}
+	if asns[7922] != 2 || asns[3356] != 2 || asns[0] != 1 {
+		t.Errorf("Expected stored ASNs 7922 x2, 3356 x2 and one unknown, got %v", asns)
+	}
+}
+
+func TestExtractRequestInfoASN(t *testing.T) {
+	asnDB := writeTestGeoIPDBOfType(t, "GeoLite2-ASN", map[string]map[string]any{
+		"81.2.69.0/24": {"autonomous_system_number": uint32(20712)},
+	})
+
+	h, err := newTestHeimdallWithConfig(Config{ASNDatabasePath: asnDB})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	tests := []struct {
+		remoteAddr string
+		want       uint
+	}{
+		{"81.2.69.160:443", 20712},
+		{"8.8.8.8:443", 0},
+	}
+
+	for _, tt := range tests {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: tt.remoteAddr}
+		_, location, err := h.ExtractRequestInfo(r)
+		if err != nil {
+			t.Fatalf("ExtractRequestInfo(%s) failed: %v", tt.remoteAddr, err)
+		}
+		if location.ASN != tt.want {
+			t.Errorf("ExtractRequestInfo(%s): expected ASN %d, got %d", tt.remoteAddr, tt.want, location.ASN)
+		}
+	}
+
+	// A City database is not an ASN database
+	cityDB := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+	if _, err := NewASNReader(cityDB); !errors.Is(err, ErrGeoIPDatabaseInvalid) {
+		t.Errorf("Expected ErrGeoIPDatabaseInvalid for a City database, got %v", err)
+	}
+}
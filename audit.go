@@ -0,0 +1,60 @@
+package heimdall
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// SessionAudit is the lifecycle of a single session, for audit exports.
+type SessionAudit struct {
+	// Session is the session as registered, including its device and
+	// location snapshot and CreatedAt.
+	Session *Session `json:"session"`
+
+	// ExpiresAt is when the session expires or expired.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// InvalidatedAt is when the session was invalidated, or zero if it
+	// was not. Stores record it with second precision.
+	InvalidatedAt time.Time `json:"invalidated_at"`
+}
+
+// Active reports whether the session is neither expired nor invalidated.
+func (a *SessionAudit) Active() bool {
+	return a.InvalidatedAt.IsZero() && !a.Session.IsExpired()
+}
+
+// SessionHistory returns the lifecycle of a session, including after it has
+// expired or been invalidated. It returns ErrSessionNotFound if the store has
+// no session with the ID. Requires a session store implementing
+// store.AuditStore; otherwise ErrUnsupportedStore is returned.
+func (h *Heimdall) SessionHistory(sessionID string) (*SessionAudit, error) {
+	auditStore, ok := store.Optional[store.AuditStore](h.sessions)
+	if !ok {
+		return nil, ErrUnsupportedStore
+	}
+
+	var invalidatedAt time.Time
+	storeSession, err := storeCall(h, "GetSessionAudit", func() (*store.Session, error) {
+		var session *store.Session
+		var err error
+		session, invalidatedAt, err = auditStore.GetSessionAudit(h.storageID(sessionID))
+		return session, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to get session history: %w", err)
+	}
+	if storeSession == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	session := storeToSession(storeSession)
+	session.SessionID = sessionID
+	return &SessionAudit{
+		Session:       session,
+		ExpiresAt:     session.ExpiresAt(),
+		InvalidatedAt: invalidatedAt,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package heimdall
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+func TestSessionHistory(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)", Browser: "Chrome"}
+	location := LocationInfo{IP: "8.8.8.8", City: "London", Country: "United Kingdom", CountryCode: "GB"}
+	for _, id := range []string{"active", "invalidated"} {
+		if _, err := h.RegisterSession("user123", id, device, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	before := time.Now().Add(-time.Second)
+	if err := h.InvalidateSession("invalidated"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	t.Run("active", func(t *testing.T) {
+		audit, err := h.SessionHistory("active")
+		if err != nil {
+			t.Fatalf("SessionHistory failed: %v", err)
+		}
+		if !audit.Active() {
+			t.Error("Expected session to be active")
+		}
+		if !audit.InvalidatedAt.IsZero() {
+			t.Errorf("Expected no InvalidatedAt, got %v", audit.InvalidatedAt)
+		}
+		if audit.Session.SessionID != "active" || audit.Session.UserID != "user123" {
+			t.Errorf("Unexpected session %+v", audit.Session)
+		}
+		if audit.Session.Device.Browser != "Chrome" || audit.Session.Location.City != "London" {
+			t.Errorf("Expected device and location snapshot, got %+v, %+v", audit.Session.Device, audit.Session.Location)
+		}
+		if !audit.ExpiresAt.Equal(audit.Session.CreatedAt.Add(h.config.SessionTTL)) {
+			t.Errorf("Expected ExpiresAt CreatedAt+TTL, got %v", audit.ExpiresAt)
+		}
+	})
+
+	t.Run("invalidated", func(t *testing.T) {
+		audit, err := h.SessionHistory("invalidated")
+		if err != nil {
+			t.Fatalf("SessionHistory failed: %v", err)
+		}
+		if audit.Active() {
+			t.Error("Expected session not to be active")
+		}
+		if audit.InvalidatedAt.Before(before) || audit.InvalidatedAt.After(time.Now().Add(time.Second)) {
+			t.Errorf("Expected InvalidatedAt around now, got %v", audit.InvalidatedAt)
+		}
+		if audit.Session.Location.CountryCode != "GB" {
+			t.Errorf("Expected location snapshot, got %+v", audit.Session.Location)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := h.SessionHistory("unknown"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("Expected ErrSessionNotFound, got %v", err)
+		}
+	})
+}
+
+func TestSessionHistoryUnsupportedStore(t *testing.T) {
+	h, err := New(Config{SessionStore: store.NewMemorySessionStore(), InvalidationCache: store.NewMemoryCache()})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.SessionHistory("session1"); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("Expected ErrUnsupportedStore, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package heimdall
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// AuthResult is returned from Authenticate.
+type AuthResult struct {
+	// Valid is true if the session is active: known, not expired and not
+	// invalidated.
+	Valid bool `json:"valid"`
+
+	// Session is the active session, with SessionID as passed to
+	// Authenticate. Nil if Valid is false.
+	Session *Session `json:"session,omitempty"`
+
+	// Device and Location are extracted from the current request, as by
+	// ExtractRequestInfo.
+	Device   DeviceInfo   `json:"device"`
+	Location LocationInfo `json:"location"`
+
+	// DeviceMismatch is true if the request comes from a different device
+	// than the one the session was created on, compared by fingerprint, or
+	// by User-Agent if the fingerprints are missing or of different
+	// versions. Devices that cannot be compared never mismatch.
+	DeviceMismatch bool `json:"device_mismatch"`
+
+	// CountryMismatch is true if the request comes from a different country
+	// than the one the session was created in. Requests and sessions
+	// without a known country code never mismatch.
+	CountryMismatch bool `json:"country_mismatch"`
+}
+
+// Authenticate checks the session presented with a request in one call: it
+// extracts the request's device and location, checks that the session is
+// still active, and compares the request against the session for signs of
+// a stolen session. Callers decide how to treat mismatches, e.g. by
+// requiring step-up verification or invalidating the session.
+// An invalid session is reported with Valid false, not as an error.
+// Requires a session store implementing store.SessionGetter; otherwise
+// ErrUnsupportedStore is returned.
+func (h *Heimdall) Authenticate(r *http.Request, sessionID string) (*AuthResult, error) {
+	device, location, err := h.ExtractRequestInfo(r)
+	if err != nil {
+		return nil, err
+	}
+	if device.Fingerprint == "" {
+		device.Fingerprint = h.config.DeviceFingerprinter(device)
+	}
+	result := &AuthResult{Device: device, Location: location}
+
+	session, err := h.GetSession(sessionID)
+	if errors.Is(err, ErrSessionInvalidated) || errors.Is(err, ErrSessionNotFound) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Valid = true
+	result.Session = session
+
+	sessionDevice := result.Session.Device
+	result.DeviceMismatch = comparableDevices(sessionDevice, device) && !sameDevice(sessionDevice, device)
+
+	sessionCountry := result.Session.Location.CountryCode
+	result.CountryMismatch = sessionCountry != "" && location.CountryCode != "" &&
+		!strings.EqualFold(sessionCountry, location.CountryCode)
+
+	return result, nil
+}
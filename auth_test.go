@@ -0,0 +1,81 @@
+package heimdall
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	geoDB := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+		"5.9.0.0/16":   cityRecord("Berlin", "Germany", "DE", 52.52, 13.405),
+	})
+
+	h, err := newTestHeimdallWithConfig(Config{GeoIPDatabasePath: geoDB})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	const laptopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	const phoneUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+
+	request := func(remoteAddr, ua string) *http.Request {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: remoteAddr}
+		r.Header.Set("User-Agent", ua)
+		return r
+	}
+
+	for _, sessionID := range []string{"session1", "session2"} {
+		device, location, err := h.ExtractRequestInfo(request("81.2.69.160:443", laptopUA))
+		if err != nil {
+			t.Fatalf("ExtractRequestInfo failed: %v", err)
+		}
+		if _, err := h.RegisterSession("user123", sessionID, device, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("session2"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	tests := []struct {
+		name                string
+		r                   *http.Request
+		sessionID           string
+		wantValid           bool
+		wantDeviceMismatch  bool
+		wantCountryMismatch bool
+	}{
+		{"valid", request("81.2.69.161:443", laptopUA), "session1", true, false, false},
+		{"invalidated", request("81.2.69.160:443", laptopUA), "session2", false, false, false},
+		{"unknown", request("81.2.69.160:443", laptopUA), "session3", false, false, false},
+		{"device mismatch", request("81.2.69.160:443", phoneUA), "session1", true, true, false},
+		{"country mismatch", request("5.9.1.1:443", laptopUA), "session1", true, false, true},
+	}
+
+	for _, tt := range tests {
+		result, err := h.Authenticate(tt.r, tt.sessionID)
+		if err != nil {
+			t.Fatalf("%s: Authenticate failed: %v", tt.name, err)
+		}
+		if result.Valid != tt.wantValid {
+			t.Errorf("%s: expected Valid %v, got %v", tt.name, tt.wantValid, result.Valid)
+		}
+		if tt.wantValid && (result.Session == nil || result.Session.SessionID != tt.sessionID) {
+			t.Errorf("%s: expected session %s, got %+v", tt.name, tt.sessionID, result.Session)
+		}
+		if !tt.wantValid && result.Session != nil {
+			t.Errorf("%s: expected no session, got %+v", tt.name, result.Session)
+		}
+		if result.DeviceMismatch != tt.wantDeviceMismatch {
+			t.Errorf("%s: expected DeviceMismatch %v, got %v", tt.name, tt.wantDeviceMismatch, result.DeviceMismatch)
+		}
+		if result.CountryMismatch != tt.wantCountryMismatch {
+			t.Errorf("%s: expected CountryMismatch %v, got %v", tt.name, tt.wantCountryMismatch, result.CountryMismatch)
+		}
+		if result.Device.IP != result.Location.IP || result.Device.IP == "" {
+			t.Errorf("%s: expected the request's device and location, got %+v and %+v", tt.name, result.Device, result.Location)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package heimdall
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// RegisterRequest is one login for RegisterSessions, with the arguments of
+// RegisterSessionWithOptions.
+type RegisterRequest struct {
+	UserID          string
+	SessionID       string
+	Device          DeviceInfo
+	Location        LocationInfo
+	ConcurrentLimit int
+	Options         RegisterOptions
+}
+
+// RegisterSessions registers several sessions at once, e.g. for the linked
+// accounts of an SSO login, returning one result per request. Either all
+// sessions are saved or none is: if any request fails its checks or the
+// save fails, an error is returned and nothing is changed. With
+// Config.LimitExceededAsError a request exceeding its limit fails the batch
+// with ErrSessionLimitExceeded; otherwise it is reported in its result and
+// not saved, and the other sessions are.
+//
+// Sessions are saved in one transaction by stores implementing
+// store.BatchSaveStore. Other stores save them one by one and delete the
+// saved ones if a save fails. Requests are checked against the sessions
+// stored before the batch, so a batch with several requests for the same
+// user, which could together exceed the user's limit, is rejected with
+// ErrDuplicateBatchUser. RegisterOptions.IdempotencyKey is not supported;
+// a request setting it is rejected with ErrIdempotencyKeyInBatch.
+func (h *Heimdall) RegisterSessions(reqs []RegisterRequest) ([]*RegisterResult, error) {
+	users := make(map[string]bool, len(reqs))
+	for i, req := range reqs {
+		if users[req.UserID] {
+			return nil, fmt.Errorf("heimdall: request %d: %w", i, ErrDuplicateBatchUser)
+		}
+		if req.Options.IdempotencyKey != "" {
+			return nil, fmt.Errorf("heimdall: request %d: %w", i, ErrIdempotencyKeyInBatch)
+		}
+		users[req.UserID] = true
+	}
+
+	pending := make([]*pendingSession, len(reqs))
+	var toSave []*store.Session
+	var limitErr error
+	for i, req := range reqs {
+		p, err := h.prepareSession(req.UserID, req.SessionID, req.Device, req.Location, req.ConcurrentLimit, req.Options)
+		if p == nil {
+			return nil, fmt.Errorf("heimdall: request %d: %w", i, err)
+		}
+		if err != nil {
+			limitErr = err
+		}
+		pending[i] = p
+		if p.session != nil {
+			toSave = append(toSave, p.session)
+		}
+	}
+
+	results := make([]*RegisterResult, len(pending))
+	for i, p := range pending {
+		results[i] = p.result
+	}
+	if limitErr != nil {
+		return results, limitErr
+	}
+
+	if err := h.saveAll(toSave); err != nil {
+		return nil, err
+	}
+
+	// Replaced sessions are invalidated once the new sessions are saved,
+	// so a failed save leaves them in place
+	for _, p := range pending {
+		if p.session == nil {
+			continue
+		}
+		if err := h.replaceSessions(p); err != nil {
+			return nil, err
+		}
+		h.completeSession(p)
+	}
+	return results, nil
+}
+
+// saveAll saves sessions atomically, in one transaction if the store
+// supports it.
+func (h *Heimdall) saveAll(sessions []*store.Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	if batchStore, ok := store.Optional[store.BatchSaveStore](h.sessions); ok {
+		err := h.storeExec("SaveAll", func() error {
+			return batchStore.SaveAll(sessions)
+		})
+		if err != nil {
+			h.config.Logger.Error("heimdall: failed to save sessions", "count", len(sessions), "error", err)
+			return fmt.Errorf("heimdall: failed to save sessions: %w", err)
+		}
+		return nil
+	}
+
+	for i, session := range sessions {
+		err := h.storeExec("Save", func() error {
+			return h.sessions.Save(session)
+		})
+		if err == nil {
+			continue
+		}
+
+		h.config.Logger.Error("heimdall: failed to save session", "user_id", session.UserID, "error", err)
+		errs := []error{fmt.Errorf("heimdall: failed to save session: %w", err)}
+		for _, saved := range sessions[:i] {
+			err := h.storeExec("Delete", func() error {
+				return h.sessions.Delete(saved.SessionID)
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("heimdall: failed to roll back session: %w", err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package heimdall
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// failingSaveStore fails to save the session with ID failID.
+type failingSaveStore struct {
+	store.SessionStore
+	failID string
+}
+
+func (s failingSaveStore) Save(session *store.Session) error {
+	if session.SessionID == s.failID {
+		return errors.New("injected failure")
+	}
+	return s.SessionStore.Save(session)
+}
+
+func batchRequests() []RegisterRequest {
+	device := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	return []RegisterRequest{
+		{UserID: "user1", SessionID: "app1", Device: device, Location: location},
+		{UserID: "user2", SessionID: "app2", Device: device, Location: location},
+		{UserID: "user3", SessionID: "app3", Device: device, Location: location},
+	}
+}
+
+func TestRegisterSessions(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	reqs := batchRequests()
+	results, err := h.RegisterSessions(reqs)
+	if err != nil {
+		t.Fatalf("RegisterSessions failed: %v", err)
+	}
+	if len(results) != len(reqs) {
+		t.Fatalf("Expected %d results, got %d", len(reqs), len(results))
+	}
+	for i, req := range reqs {
+		if results[i].Session == nil || results[i].Session.SessionID != req.SessionID {
+			t.Errorf("Expected result %d for %s, got %+v", i, req.SessionID, results[i].Session)
+		}
+		if len(results[i].ActiveSessions) != 1 {
+			t.Errorf("Expected the new session in result %d's active sessions, got %d", i, len(results[i].ActiveSessions))
+		}
+		sessions, err := h.ListSessions(req.UserID)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 1 {
+			t.Errorf("Expected 1 session for %s, got %d", req.UserID, len(sessions))
+		}
+	}
+}
+
+func TestRegisterSessionsRollsBack(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func() Config
+	}{
+		{"save failure", func() Config {
+			return Config{SessionStore: failingSaveStore{store.NewMemorySessionStore(), "app3"}}
+		}},
+		{"rejected request", func() Config {
+			return Config{
+				SessionStore:       store.NewMemorySessionStore(),
+				SessionIDValidator: func(id string) bool { return id != "app3" },
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config()
+			cfg.InvalidationCache = store.NewMemoryCache()
+			h, err := New(cfg)
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			results, err := h.RegisterSessions(batchRequests())
+			if err == nil {
+				t.Fatal("Expected RegisterSessions to fail")
+			}
+			if results != nil {
+				t.Errorf("Expected no results, got %v", results)
+			}
+			for _, userID := range []string{"user1", "user2", "user3"} {
+				sessions, err := h.ListSessions(userID)
+				if err != nil {
+					t.Fatalf("Failed to list sessions: %v", err)
+				}
+				if len(sessions) != 0 {
+					t.Errorf("Expected no sessions for %s after rollback, got %d", userID, len(sessions))
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterSessionsDuplicateUser(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	reqs := batchRequests()
+	reqs[2].UserID = reqs[0].UserID
+	reqs[0].ConcurrentLimit, reqs[2].ConcurrentLimit = 1, 1
+	if _, err := h.RegisterSessions(reqs); !errors.Is(err, ErrDuplicateBatchUser) {
+		t.Fatalf("Expected ErrDuplicateBatchUser, got %v", err)
+	}
+
+	// Nothing was saved
+	for _, req := range reqs {
+		sessions, err := h.ListSessions(req.UserID)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("Expected no sessions for %s, got %d", req.UserID, len(sessions))
+		}
+	}
+}
+
+func TestRegisterSessionsRejectsIdempotencyKey(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	reqs := batchRequests()
+	reqs[1].Options.IdempotencyKey = "retry-1"
+	if _, err := h.RegisterSessions(reqs); !errors.Is(err, ErrIdempotencyKeyInBatch) {
+		t.Fatalf("Expected ErrIdempotencyKeyInBatch, got %v", err)
+	}
+
+	sessions, err := h.ListSessions(reqs[0].UserID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("Expected nothing to be saved, got %d sessions", len(sessions))
+	}
+}
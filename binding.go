@@ -0,0 +1,68 @@
+package heimdall
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// CheckSessionBinding reports whether currentIP is in the same subnet as the
+// IP the session was created from. Subnet sizes are set by SubnetPrefixIPv4
+// and SubnetPrefixIPv6. An IPv4 address never matches an IPv6 one.
+//
+// Always returns true if PinSessionToSubnet is disabled.
+// On mismatch, the session is invalidated if InvalidateOnSubnetChange is set.
+// Returns ErrSessionNotFound if the session is not active. Requires a
+// session store implementing store.SessionGetter; otherwise
+// ErrUnsupportedStore is returned.
+func (h *Heimdall) CheckSessionBinding(sessionID, currentIP string) (bool, error) {
+	if !h.config.PinSessionToSubnet {
+		return true, nil
+	}
+	getter, ok := store.Optional[store.SessionGetter](h.sessions)
+	if !ok {
+		return false, ErrUnsupportedStore
+	}
+
+	session, err := storeCall(h, "GetSession", func() (*store.Session, error) {
+		return getter.GetSession(h.storageID(sessionID))
+	})
+	if err != nil {
+		return false, fmt.Errorf("heimdall: failed to get session: %w", err)
+	}
+	if session == nil {
+		return false, ErrSessionNotFound
+	}
+
+	if sameSubnet(session.DeviceIP, currentIP, h.config.SubnetPrefixIPv4, h.config.SubnetPrefixIPv6) {
+		return true, nil
+	}
+
+	if h.config.InvalidateOnSubnetChange {
+		if err := h.InvalidateSession(sessionID); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// sameSubnet reports whether two IPs fall in the same subnet of the given
+// prefix length. Invalid IPs never match.
+func sameSubnet(a, b string, prefixIPv4, prefixIPv6 int) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return false
+	}
+
+	if v4A, v4B := ipA.To4(), ipB.To4(); v4A != nil || v4B != nil {
+		if v4A == nil || v4B == nil {
+			return false
+		}
+		mask := net.CIDRMask(prefixIPv4, 32)
+		return v4A.Mask(mask).Equal(v4B.Mask(mask))
+	}
+
+	mask := net.CIDRMask(prefixIPv6, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
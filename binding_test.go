@@ -0,0 +1,134 @@
+package heimdall
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+func TestCheckSessionBinding(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{PinSessionToSubnet: true})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "203.0.113.10"}
+	if _, err := h.RegisterSession("user123", "session1", device, LocationInfo{IP: device.IP}, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	ok, err := h.CheckSessionBinding("session1", "203.0.113.200")
+	if err != nil {
+		t.Fatalf("Failed to check binding: %v", err)
+	}
+	if !ok {
+		t.Error("IP in the same /24 should pass the binding check")
+	}
+
+	ok, err = h.CheckSessionBinding("session1", "198.51.100.10")
+	if err != nil {
+		t.Fatalf("Failed to check binding: %v", err)
+	}
+	if ok {
+		t.Error("IP in a different network should fail the binding check")
+	}
+
+	// Session is only checked, not invalidated, by default
+	invalidated, err := h.IsSessionInvalidated("session1")
+	if err != nil {
+		t.Fatalf("Failed to check invalidation: %v", err)
+	}
+	if invalidated {
+		t.Error("Session should not be invalidated without InvalidateOnSubnetChange")
+	}
+
+	_, err = h.CheckSessionBinding("unknown", "203.0.113.10")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestCheckSessionBindingInvalidatesOnChange(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		PinSessionToSubnet:       true,
+		InvalidateOnSubnetChange: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "203.0.113.10"}
+	if _, err := h.RegisterSession("user123", "session1", device, LocationInfo{IP: device.IP}, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	ok, err := h.CheckSessionBinding("session1", "198.51.100.10")
+	if err != nil {
+		t.Fatalf("Failed to check binding: %v", err)
+	}
+	if ok {
+		t.Error("IP in a different network should fail the binding check")
+	}
+
+	invalidated, err := h.IsSessionInvalidated("session1")
+	if err != nil {
+		t.Fatalf("Failed to check invalidation: %v", err)
+	}
+	if !invalidated {
+		t.Error("Session should be invalidated after a subnet change")
+	}
+}
+
+func TestSameSubnet(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"same IPv4 /24", "192.0.2.1", "192.0.2.254", true},
+		{"different IPv4 /24", "192.0.2.1", "192.0.3.1", false},
+		{"same IPv6 /64", "2001:db8::1", "2001:db8::ffff", true},
+		{"different IPv6 /64", "2001:db8:0:1::1", "2001:db8:0:2::1", false},
+		{"IPv4 vs IPv6", "192.0.2.1", "2001:db8::1", false},
+		{"IPv4-mapped IPv6 matches IPv4", "::ffff:192.0.2.1", "192.0.2.2", true},
+		{"invalid IP", "not-an-ip", "192.0.2.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameSubnet(tt.a, tt.b, 24, 64); got != tt.want {
+				t.Errorf("sameSubnet(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionLookupUnsupportedStore(t *testing.T) {
+	h, err := New(Config{
+		SessionStore:       struct{ store.SessionStore }{store.NewMemorySessionStore()},
+		InvalidationCache:  store.NewMemoryCache(),
+		PinSessionToSubnet: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.CheckSessionBinding("session1", "203.0.113.10"); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("CheckSessionBinding: expected ErrUnsupportedStore, got %v", err)
+	}
+	if _, err := h.GetSession("session1"); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("GetSession: expected ErrUnsupportedStore, got %v", err)
+	}
+	if _, err := h.Introspect("session1"); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("Introspect: expected ErrUnsupportedStore, got %v", err)
+	}
+	r := &http.Request{Header: http.Header{"User-Agent": {"Mozilla/5.0"}}, RemoteAddr: "203.0.113.10:443"}
+	if _, err := h.Authenticate(r, "session1"); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("Authenticate: expected ErrUnsupportedStore, got %v", err)
+	}
+}
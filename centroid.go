@@ -0,0 +1,76 @@
+package heimdall
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// UsualLocation returns where the user usually logs in from: the spherical
+// mean of the coordinates of their newest lastN active sessions that have
+// coordinates, or of all of them if lastN is zero or less. Only Latitude,
+// Longitude and Geohash are set. The bool is false if no active session has
+// coordinates, or if they cancel out, e.g. two antipodal sessions.
+func (h *Heimdall) UsualLocation(userID string, lastN int) (LocationInfo, bool, error) {
+	storeSessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return LocationInfo{}, false, fmt.Errorf("heimdall: failed to get active sessions: %w", err)
+	}
+
+	sessions := make([]*Session, len(storeSessions))
+	for i, s := range storeSessions {
+		sessions[i] = storeToSession(s)
+	}
+
+	center, ok := h.sessionCentroid(sessions, lastN)
+	return center, ok, nil
+}
+
+// sessionCentroid returns the spherical mean of the locations of the newest
+// lastN sessions with coordinates, or of all of them if lastN <= 0.
+func (h *Heimdall) sessionCentroid(sessions []*Session, lastN int) (LocationInfo, bool) {
+	located := make([]*Session, 0, len(sessions))
+	for _, s := range sessions {
+		if hasCoordinates(s.Location) {
+			located = append(located, s)
+		}
+	}
+	slices.SortStableFunc(located, func(a, b *Session) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if lastN > 0 && len(located) > lastN {
+		located = located[:lastN]
+	}
+	if len(located) == 0 {
+		return LocationInfo{}, false
+	}
+
+	// Average the points as unit vectors, so longitudes wrap correctly
+	var x, y, z float64
+	for _, s := range located {
+		lat := s.Location.Latitude * math.Pi / 180
+		lng := s.Location.Longitude * math.Pi / 180
+		x += math.Cos(lat) * math.Cos(lng)
+		y += math.Cos(lat) * math.Sin(lng)
+		z += math.Sin(lat)
+	}
+	n := float64(len(located))
+	x, y, z = x/n, y/n, z/n
+
+	hyp := math.Hypot(x, y)
+	if hyp < 1e-9 && math.Abs(z) < 1e-9 {
+		return LocationInfo{}, false
+	}
+
+	lat := math.Atan2(z, hyp) * 180 / math.Pi
+	lng := math.Atan2(y, x) * 180 / math.Pi
+	return LocationInfo{
+		Latitude:  lat,
+		Longitude: lng,
+		Geohash:   Geohash(lat, lng, h.config.GeohashPrecision),
+	}, true
+}
@@ -0,0 +1,125 @@
+package heimdall
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestUsualLocation(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, ok, err := h.UsualLocation("user123", 0); err != nil || ok {
+		t.Fatalf("Expected no usual location without sessions, got ok %v, err %v", ok, err)
+	}
+
+	// An old session far away, then a cluster around Paris
+	base := time.Now().Add(-time.Hour)
+	logins := []LocationInfo{
+		{City: "Tokyo", Latitude: 35.6762, Longitude: 139.6503},
+		{City: "Paris", Latitude: 48.8566, Longitude: 2.3522},
+		{City: "Versailles", Latitude: 48.8049, Longitude: 2.1204},
+		{City: "Saint-Denis", Latitude: 48.9362, Longitude: 2.3574},
+		{City: "Unknown"}, // no coordinates, ignored
+	}
+	for i, loc := range logins {
+		opts := RegisterOptions{CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		if _, err := h.RegisterSessionWithOptions("user123", fmt.Sprintf("session%d", i), DeviceInfo{IP: "8.8.8.8"}, loc, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	usual, ok, err := h.UsualLocation("user123", 3)
+	if err != nil {
+		t.Fatalf("UsualLocation failed: %v", err)
+	}
+	if !ok {
+		t.Fatal("Expected a usual location")
+	}
+	if d := HaversineDistance(usual.Latitude, usual.Longitude, 48.8659, 2.2767); d > 1 {
+		t.Errorf("Expected the centroid of the Paris cluster, got (%v, %v), %.1f km off", usual.Latitude, usual.Longitude, d)
+	}
+	if usual.Geohash == "" {
+		t.Error("Expected the usual location to have a geohash")
+	}
+
+	// All sessions: Tokyo pulls the centroid far from Paris
+	usual, _, err = h.UsualLocation("user123", 0)
+	if err != nil {
+		t.Fatalf("UsualLocation failed: %v", err)
+	}
+	if d := HaversineDistance(usual.Latitude, usual.Longitude, 48.8566, 2.3522); d < 500 {
+		t.Errorf("Expected Tokyo to move the centroid, got (%v, %v)", usual.Latitude, usual.Longitude)
+	}
+}
+
+func TestSessionCentroidAntimeridian(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	sessions := []*Session{
+		{Location: LocationInfo{Latitude: -17, Longitude: 179}},
+		{Location: LocationInfo{Latitude: -17, Longitude: -179}},
+	}
+	center, ok := h.sessionCentroid(sessions, 0)
+	if !ok {
+		t.Fatal("Expected a centroid")
+	}
+	if math.Abs(math.Abs(center.Longitude)-180) > 0.01 || math.Abs(center.Latitude+17) > 0.01 {
+		t.Errorf("Expected the centroid on the antimeridian, got (%v, %v)", center.Latitude, center.Longitude)
+	}
+
+	antipodal := []*Session{
+		{Location: LocationInfo{Latitude: 10, Longitude: 20}},
+		{Location: LocationInfo{Latitude: -10, Longitude: -160}},
+	}
+	if _, ok := h.sessionCentroid(antipodal, 0); ok {
+		t.Error("Expected no centroid for antipodal sessions")
+	}
+}
+
+func TestNewLocationCompareCentroid(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{NewLocationComparison: CompareCentroid})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	paris := LocationInfo{City: "Paris", Latitude: 48.8566, Longitude: 2.3522}
+	london := LocationInfo{City: "London", Latitude: 51.5074, Longitude: -0.1278}
+	for i, loc := range []LocationInfo{paris, paris, paris, london} {
+		if _, err := h.RegisterSession("user123", fmt.Sprintf("session%d", i), device, loc, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	// Far from the latest session (London), but near the usual location
+	result, err := h.RegisterSession("user123", "session4", device, paris, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.IsNewLocation {
+		t.Errorf("Login near the usual location should not be flagged, previous %+v", result.PreviousLocation)
+	}
+
+	tokyo := LocationInfo{City: "Tokyo", Latitude: 35.6762, Longitude: 139.6503}
+	result, err = h.RegisterSession("user123", "session5", device, tokyo, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !result.IsNewLocation || result.PreviousLocation == nil {
+		t.Fatal("Login far from the usual location should be flagged")
+	}
+	if d := HaversineDistance(result.PreviousLocation.Latitude, result.PreviousLocation.Longitude, paris.Latitude, paris.Longitude); d > 150 {
+		t.Errorf("PreviousLocation should be the usual location near Paris, got %+v", result.PreviousLocation)
+	}
+}
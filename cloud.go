@@ -0,0 +1,60 @@
+package heimdall
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// LoadCloudRanges replaces the list of cloud provider networks used to set
+// LocationInfo.IsCloudProvider in ExtractRequestInfo. Logins from cloud
+// providers are likely automated. The provider lists published by AWS, GCP
+// and Azure can be converted to this format.
+//
+// r must contain one CIDR or IP per line. Blank lines and lines starting
+// with # are ignored. It is safe to call LoadCloudRanges again at any time
+// to reload the list; on error the previous list is kept.
+func (h *Heimdall) LoadCloudRanges(r io.Reader) error {
+	var networks []*net.IPNet
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		network, err := parseNetwork(line)
+		if err != nil {
+			return fmt.Errorf("heimdall: invalid cloud range on line %d %q: %w", lineNum, line, err)
+		}
+		networks = append(networks, network)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("heimdall: failed to read cloud ranges: %w", err)
+	}
+
+	h.cloudRanges.Store(&networks)
+	return nil
+}
+
+// isCloudIP reports whether ip is in one of the loaded cloud ranges.
+func (h *Heimdall) isCloudIP(ip string) bool {
+	networks := h.cloudRanges.Load()
+	if networks == nil {
+		return false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range *networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package heimdall
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoadCloudRanges(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	ranges := `
+# AWS
+3.5.140.0/22
+# GCP
+34.64.0.0/10
+2600:1900::/28
+`
+	if err := h.LoadCloudRanges(strings.NewReader(ranges)); err != nil {
+		t.Fatalf("LoadCloudRanges failed: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"3.5.141.7", true},
+		{"34.100.1.1", true},
+		{"2600:1900::1", true},
+		{"81.2.69.160", false},
+		{"2001:db8::1", false},
+	}
+
+	for _, tt := range tests {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: tt.ip + ":4242"}
+		if strings.Contains(tt.ip, ":") {
+			r.RemoteAddr = "[" + tt.ip + "]:4242"
+		}
+
+		_, location, err := h.ExtractRequestInfo(r)
+		if err != nil {
+			t.Fatalf("ExtractRequestInfo failed: %v", err)
+		}
+		if location.IsCloudProvider != tt.want {
+			t.Errorf("IP %s: IsCloudProvider = %v, want %v", tt.ip, location.IsCloudProvider, tt.want)
+		}
+	}
+}
+
+func TestLoadCloudRangesReload(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if err := h.LoadCloudRanges(strings.NewReader("3.5.140.0/22\n")); err != nil {
+		t.Fatalf("LoadCloudRanges failed: %v", err)
+	}
+	if !h.isCloudIP("3.5.141.7") {
+		t.Fatal("Expected IP to be in the loaded range")
+	}
+
+	// A failed reload keeps the previous list
+	if err := h.LoadCloudRanges(strings.NewReader("34.64.0.0/10\nnot-a-cidr\n")); err == nil {
+		t.Fatal("Expected an error for an invalid range")
+	}
+	if !h.isCloudIP("3.5.141.7") {
+		t.Error("Expected the previous ranges to be kept after a failed reload")
+	}
+
+	if err := h.LoadCloudRanges(strings.NewReader("34.64.0.0/10\n")); err != nil {
+		t.Fatalf("LoadCloudRanges failed: %v", err)
+	}
+	if h.isCloudIP("3.5.141.7") || !h.isCloudIP("34.100.1.1") {
+		t.Error("Expected the reloaded ranges to replace the previous ones")
+	}
+}
@@ -1,6 +1,8 @@
 package heimdall
 
 import (
+	"context"
+	"math/rand/v2"
 	"time"
 
 	"github.com/aadithya-v/heimdall/store"
@@ -12,26 +14,328 @@ type Config struct {
 	// Default: 24 hours.
 	SessionTTL time.Duration
 
+	// MinSessionTTL and MaxSessionTTL bound the TTL callers may request with
+	// RegisterOptions.TTL. Out-of-range TTLs are clamped to the bounds, or
+	// rejected with ErrTTLOutOfRange if RejectOutOfRangeTTL is set.
+	// Default: 0 (unbounded).
+	MinSessionTTL time.Duration
+	MaxSessionTTL time.Duration
+
+	// RejectOutOfRangeTTL makes RegisterSession fail instead of clamping
+	// TTLs outside MinSessionTTL and MaxSessionTTL.
+	// Default: false.
+	RejectOutOfRangeTTL bool
+
+	// TTLJitter randomizes each session's TTL by up to this much either way,
+	// so sessions created in a burst, e.g. after a mass re-login, do not all
+	// expire at once. The jittered TTL is at least one second and, unless
+	// it is the default SessionTTL, stays within MinSessionTTL and
+	// MaxSessionTTL if set.
+	// Default: 0 (no jitter).
+	TTLJitter time.Duration
+
+	// TTLJitterSource returns uniformly distributed values in [0, 1) used to
+	// pick the jitter. Set it to make TTLs deterministic in tests.
+	// Default: math/rand/v2.Float64.
+	TTLJitterSource func() float64
+
 	// InvalidationTTL is how long to remember invalidated sessions.
 	// This should be at least as long as SessionTTL to prevent
 	// invalidated sessions from being reused.
 	// Default: 24 hours (Same as SessionTTL).
 	InvalidationTTL time.Duration
 
+	// InvalidationFailMode decides what IsSessionInvalidatedOr reports when
+	// the invalidation cache cannot be reached.
+	// Default: FailClosed.
+	InvalidationFailMode InvalidationFailMode
+
 	// GeoIPDatabasePath is the path to MaxMind GeoLite2-City.mmdb file.
 	// Required for IP-based location detection.
 	// Download from: https://dev.maxmind.com/geoip/geolite2-free-geolocation-data
 	GeoIPDatabasePath string
 
+	// ASNDatabasePath is the path to a MaxMind GeoLite2-ASN.mmdb file, used
+	// to set LocationInfo.ASN for RegisterResult.IsNewASN.
+	// Default: "" (no ASN lookup).
+	ASNDatabasePath string
+
+	// DefaultLocation, if set, is the location given by ExtractRequestInfo
+	// to private and reserved IPs (see IsPrivateIP), which GeoIP cannot
+	// locate, e.g. for internal deployments behind NAT. Its IP is replaced
+	// by the client IP. Applies even if GeoIPDatabasePath is not set.
+	// Default: nil (such IPs get a location with the IP only).
+	DefaultLocation *LocationInfo
+
+	// TrustedProxies lists IPs or CIDRs of proxies whose forwarding headers
+	// are trusted for geolocation. When set, a client IP taken from a proxy
+	// header is only geolocated if the request came directly from one of
+	// these proxies. The IP is recorded on the session either way.
+	// Default: empty (proxy headers are trusted for geolocation).
+	TrustedProxies []string
+
+	// RequireClientIP makes ExtractRequestInfo fail with ErrMissingClientIP
+	// when neither the proxy headers nor RemoteAddr contain a valid IP.
+	// Otherwise such requests are accepted with DeviceInfo.IP set to the raw
+	// RemoteAddr, which may be empty, and are not geolocated.
+	// Default: false.
+	RequireClientIP bool
+
+	// MaxForwardedHopsForGeo is the longest X-Forwarded-For chain whose client
+	// IP is still geolocated. Long chains are more likely to be spoofed.
+	// Default: 0 (no limit).
+	MaxForwardedHopsForGeo int
+
+	// BlockedCountries lists ISO country codes, e.g. "KP", from which
+	// RegisterSession rejects logins with ErrLocationBlocked. Requires
+	// GeoIPDatabasePath (or an Enricher) to resolve the country.
+	// Default: empty (no countries blocked).
+	BlockedCountries []string
+
+	// AllowedCountries is the allowlist variant of BlockedCountries: logins
+	// from any other country, including ones whose country could not be
+	// resolved, are rejected with ErrLocationBlocked. Cannot be combined
+	// with BlockedCountries.
+	// Default: empty (all countries allowed).
+	AllowedCountries []string
+
 	// NewLocationThresholdKM is the distance threshold in kilometers
 	// for triggering a "new location" alert.
 	// Default: 100 km.
 	NewLocationThresholdKM float64
 
+	// SameIPNeverNewLocation stops a login from the same IP as the session it
+	// is compared against from being a new location, however far apart
+	// GeoIP places the two lookups, e.g. after a GeoIP database update.
+	// Default: false.
+	SameIPNeverNewLocation bool
+
+	// NewLocationGrace stops a login from being a new location if the
+	// user's previous session was created within this long of it, treating
+	// the two as one login event. This absorbs GeoIP flipping between
+	// nearby datacenters on back-to-back registrations.
+	// Default: 0 (disabled).
+	NewLocationGrace time.Duration
+
+	// LocationLearningSessions suppresses IsNewLocation while the user has
+	// fewer than this many sessions in total, so the first logins of a new
+	// account only establish a baseline. Stores implementing
+	// store.SessionCountStore count expired and invalidated sessions too;
+	// for other stores only active sessions are counted.
+	// Default: 0 (always detect).
+	LocationLearningSessions int
+
+	// GeohashPrecision is the length of the LocationInfo.Geohash computed
+	// by ExtractRequestInfo, from 1 to 12. Longer geohashes mean smaller
+	// areas: 5 characters are about 5 km wide.
+	// Default: 5.
+	GeohashPrecision int
+
+	// NewLocationComparison selects which active session a login is compared
+	// against for new-location detection.
+	// Default: CompareLatest.
+	NewLocationComparison LocationComparison
+
+	// MaxActiveSessionsInResult caps the length of
+	// RegisterResult.ActiveSessions, keeping the newest sessions, for users
+	// with many sessions. Limit checks and RegisterResult.ActiveSessionCount
+	// still cover all fetched sessions, up to MaxSessionsFetched.
+	// Default: 0 (unlimited).
+	MaxActiveSessionsInResult int
+
+	// MaxSessionsFetched caps how many of a user's active sessions
+	// RegisterSession fetches, newest first, to bound memory use for users
+	// with pathologically many sessions. Larger concurrent limits are
+	// lowered to it, and ActiveSessionCount counts at most this many.
+	// Stores implementing store.LimitedFetchStore apply the cap in the
+	// query; others are truncated after fetching.
+	// Default: 1000.
+	MaxSessionsFetched int
+
+	// SoftConcurrentLimit sets RegisterResult.LimitWarning for logins that
+	// take the user past this many active sessions, counted like the
+	// concurrent limit passed to RegisterSession. The session is still saved,
+	// so apps can nudge users to sign out elsewhere before the hard limit
+	// blocks them.
+	// Default: 0 (no warning).
+	SoftConcurrentLimit int
+
+	// LimitExceededAsError makes RegisterSession return
+	// ErrSessionLimitExceeded together with the result when the concurrent
+	// session limit is exceeded. RegisterResult.LimitExceeded is set either way.
+	// Default: false.
+	LimitExceededAsError bool
+
+	// ExpiredSessionsWindow makes RegisterSession report sessions that expired
+	// within this window before the login, so callers can update their UI.
+	// Requires a session store implementing store.ExpiredSessionStore.
+	// Default: 0 (disabled).
+	ExpiredSessionsWindow time.Duration
+
+	// OnExpire, if set, is called by ListSessions for each of the user's
+	// sessions that expired since the user's sessions were last listed.
+	// Sessions that expired longer ago than the longest session TTL
+	// (SessionTTL or MaxSessionTTL, plus TTLJitter) may not be reported.
+	// Requires a session store implementing store.ExpiredSessionStore.
+	// Default: nil (expiry is not reported).
+	OnExpire ExpireHandler
+
+	// UAParser parses User-Agent strings in ExtractRequestInfo.
+	// Default: DefaultUAParser.
+	UAParser UAParser
+
+	// DeviceClassifier, if set, can override the DeviceType detected by
+	// ExtractRequestInfo.
+	// Default: nil (built-in classification only).
+	DeviceClassifier DeviceClassifier
+
+	// DeviceFingerprinter derives the fingerprint stored with each session
+	// and compared to detect new devices, for devices registered without one.
+	// Default: DefaultDeviceFingerprint.
+	DeviceFingerprinter DeviceFingerprinter
+
+	// SessionIDGenerator creates session IDs for BeginSession.
+	// Default: DefaultSessionIDGenerator.
+	SessionIDGenerator SessionIDGenerator
+
+	// SessionIDHasher, if set, transforms session IDs before they reach the
+	// session store and invalidation cache, e.g. SHA256SessionIDHasher.
+	// Callers keep passing raw IDs to Heimdall, but sessions read back from
+	// the store (ListSessions, RegisterResult.ActiveSessions, ListInvalidated)
+	// carry the hashed ID. Changing the hasher orphans existing sessions.
+	// Default: nil (IDs are stored as is).
+	SessionIDHasher SessionIDHasher
+
+	// SessionIDValidator, if set, makes RegisterSession fail with
+	// ErrInvalidSessionID for session IDs it rejects.
+	// Default: nil (all session IDs are accepted).
+	SessionIDValidator SessionIDValidator
+
+	// Enricher, if set, is called by RegisterSession before the login is
+	// evaluated and saved, and may modify the device and location, e.g. with
+	// data from an internal device registry.
+	// Default: nil.
+	Enricher Enricher
+
+	// RejectEmptyUserAgent makes RegisterSession fail with ErrMissingUserAgent
+	// when the device has no User-Agent.
+	// Default: false.
+	RejectEmptyUserAgent bool
+
+	// OneSessionPerDevice makes RegisterSession replace the user's existing
+	// sessions on the same device instead of adding another one. Replaced
+	// sessions are invalidated and reported in RegisterResult.ReplacedSessions.
+	// Devices are compared by fingerprint (see DeviceFingerprinter), or by
+	// User-Agent if either has none or they differ in version. With the
+	// default fingerprinter, identical browsers on different machines count
+	// as one device.
+	// Default: false.
+	OneSessionPerDevice bool
+
+	// DedupeWindow makes RegisterSession return the user's existing session
+	// instead of creating another one when it was created within this window
+	// from the same device (compared as for OneSessionPerDevice) and IP,
+	// e.g. for a double-submitted login form. The returned result has
+	// Deduplicated set. Ignored if SessionIDHasher is set, since only the
+	// hash of the existing session's ID is known.
+	// Default: 0 (disabled).
+	DedupeWindow time.Duration
+
+	// IdempotencyTTL is how long the result of a registration with
+	// RegisterOptions.IdempotencyKey is remembered.
+	// Default: 10 minutes.
+	IdempotencyTTL time.Duration
+
+	// PinSessionToSubnet binds sessions to the subnet of the IP they were
+	// created from. See Heimdall.CheckSessionBinding.
+	// Default: false.
+	PinSessionToSubnet bool
+
+	// SubnetPrefixIPv4 is the prefix length of the IPv4 subnet a session is
+	// pinned to. Use 32 to pin to the exact IP.
+	// Default: 24.
+	SubnetPrefixIPv4 int
+
+	// SubnetPrefixIPv6 is the prefix length of the IPv6 subnet a session is
+	// pinned to. Use 128 to pin to the exact IP.
+	// Default: 64.
+	SubnetPrefixIPv6 int
+
+	// InvalidateOnSubnetChange makes CheckSessionBinding invalidate a session
+	// whose source IP has moved to a different subnet.
+	// Default: false.
+	InvalidateOnSubnetChange bool
+
+	// StepUpPolicy decides RegisterResult.RequiresStepUp from the login's
+	// signals.
+	// Default: DefaultStepUpPolicy.
+	StepUpPolicy StepUpPolicy
+
+	// ScoreWeights configures the ScoreLogin risk score reported in
+	// RegisterResult.Score. A zero NewLocationKM uses NewLocationThresholdKM.
+	// Default: DefaultScoreWeights().
+	ScoreWeights ScoreWeights
+
+	// AnalyticsSink receives an anonymized AnalyticsEvent for every
+	// RegisterSession call, for aggregate login trends.
+	// Default: nil (no events are emitted).
+	AnalyticsSink AnalyticsSink
+
+	// AnalyticsUserBuckets is the number of buckets user IDs are hashed into
+	// for AnalyticsEvent.UserBucket. Fewer buckets means less identifying.
+	// Default: 1024.
+	AnalyticsUserBuckets int
+
+	// DeviceTokenSecret is the HMAC key for IssueDeviceToken and
+	// VerifyDeviceToken. Use at least 32 random bytes and keep it secret;
+	// rotating it revokes all remembered devices.
+	// Default: nil (device tokens are disabled).
+	DeviceTokenSecret []byte
+
+	// DeviceTokenTTL is how long a remembered-device token stays valid.
+	// Default: 90 days.
+	DeviceTokenTTL time.Duration
+
+	// OperationTimeout bounds each session store and invalidation cache
+	// call, so a stuck backend fails the request with ErrOperationTimeout
+	// instead of hanging it. Maintain is not bounded.
+	// The backends cannot be cancelled, so a timed-out call keeps running
+	// in its own goroutine: a timed-out write such as saving or
+	// invalidating a session may still be applied afterwards, and each
+	// call to a hung backend holds a goroutine until it returns. Prefer
+	// the backend's own timeouts (e.g. the MySQL DSN's timeout settings or
+	// the Redis client's) where available.
+	// Default: 0 (disabled).
+	OperationTimeout time.Duration
+
+	// SlowQueryThreshold is how long a session store or invalidation cache
+	// call may take before it is reported to SlowQueryHandler.
+	// Default: 0 (disabled).
+	SlowQueryThreshold time.Duration
+
+	// SlowQueryHandler, if set, is called for every store call exceeding
+	// SlowQueryThreshold, e.g. to log it.
+	// Default: nil.
+	SlowQueryHandler SlowQueryHandler
+
+	// Logger receives diagnostic logs, e.g. failed GeoIP lookups and store
+	// errors. Pass slog.Default() to use the standard logger.
+	// Default: nil (logs are discarded).
+	Logger Logger
+
 	// SessionStore is the storage backend for sessions.
 	// Default: SQLite store (creates heimdall.db in current directory).
 	SessionStore store.SessionStore
 
+	// FieldCipher, if set, encrypts the device IP, user agent and location
+	// of sessions before they are saved (see store.EncryptedStore), e.g.
+	// store.NewAESGCMCipher. Encrypted fields cannot be queried, so
+	// FindSessions and ReEnrichSessions return ErrUnsupportedStore, and
+	// DistinctIPCount only counts active sessions. Other optional store
+	// interfaces are forwarded.
+	// Default: nil (no encryption).
+	FieldCipher store.FieldCipher
+
 	// InvalidationCache is the cache for invalidated session IDs.
 	// Default: in-memory cache.
 	InvalidationCache store.InvalidationCache
@@ -42,12 +346,66 @@ type Config struct {
 	DatabasePath string
 }
 
+// Enricher adjusts the device and location of a login before it is saved.
+// ctx is RegisterOptions.Context.
+type Enricher func(ctx context.Context, device *DeviceInfo, location *LocationInfo)
+
+// LocationComparison selects which of a user's active sessions a new login
+// is compared against for new-location detection.
+type LocationComparison int
+
+const (
+	// CompareLatest compares against the most recently created active session.
+	CompareLatest LocationComparison = iota
+
+	// CompareNearest compares against all active sessions and flags a new
+	// location only if even the closest one exceeds the threshold.
+	// PreviousLocation is then set to the closest session's location.
+	// This reduces false positives for users active in several places.
+	CompareNearest
+
+	// CompareCentroid compares against the user's usual location, the
+	// spherical mean of all active sessions with coordinates (see
+	// Heimdall.UsualLocation). PreviousLocation is then set to that mean.
+	// Logins without coordinates are compared as for CompareLatest.
+	CompareCentroid
+)
+
+// InvalidationFailMode is the policy applied when the invalidation cache
+// returns an error.
+type InvalidationFailMode int
+
+const (
+	// FailClosed treats every session as invalidated while the cache is
+	// unavailable. Revoked sessions can never be used, but a cache outage
+	// logs everyone out.
+	FailClosed InvalidationFailMode = iota
+
+	// FailOpen treats every session as valid while the cache is unavailable.
+	// Users stay logged in during an outage, but sessions revoked before or
+	// during it are accepted until the cache recovers.
+	FailOpen
+)
+
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() Config {
 	return Config{
 		SessionTTL:             24 * time.Hour,
 		InvalidationTTL:        24 * time.Hour,
 		NewLocationThresholdKM: 100,
+		GeohashPrecision:       5,
+		MaxSessionsFetched:     1000,
+		SubnetPrefixIPv4:       24,
+		SubnetPrefixIPv6:       64,
+		StepUpPolicy:           DefaultStepUpPolicy,
+		ScoreWeights:           DefaultScoreWeights(),
+		TTLJitterSource:        rand.Float64,
+		SessionIDGenerator:     DefaultSessionIDGenerator,
+		UAParser:               DefaultUAParser{},
+		DeviceFingerprinter:    DefaultDeviceFingerprint,
+		AnalyticsUserBuckets:   1024,
+		DeviceTokenTTL:         90 * 24 * time.Hour,
+		IdempotencyTTL:         10 * time.Minute,
 		DatabasePath:           "heimdall.db",
 	}
 }
@@ -65,6 +423,51 @@ func (c *Config) applyDefaults() {
 	if c.NewLocationThresholdKM <= 0 {
 		c.NewLocationThresholdKM = defaults.NewLocationThresholdKM
 	}
+	if c.MaxSessionsFetched <= 0 {
+		c.MaxSessionsFetched = defaults.MaxSessionsFetched
+	}
+	if c.GeohashPrecision <= 0 || c.GeohashPrecision > maxGeohashPrecision {
+		c.GeohashPrecision = defaults.GeohashPrecision
+	}
+	if c.SubnetPrefixIPv4 <= 0 || c.SubnetPrefixIPv4 > 32 {
+		c.SubnetPrefixIPv4 = defaults.SubnetPrefixIPv4
+	}
+	if c.SubnetPrefixIPv6 <= 0 || c.SubnetPrefixIPv6 > 128 {
+		c.SubnetPrefixIPv6 = defaults.SubnetPrefixIPv6
+	}
+	if c.StepUpPolicy == nil {
+		c.StepUpPolicy = defaults.StepUpPolicy
+	}
+	if c.ScoreWeights == (ScoreWeights{}) {
+		c.ScoreWeights = defaults.ScoreWeights
+	}
+	if c.ScoreWeights.NewLocationKM <= 0 {
+		c.ScoreWeights.NewLocationKM = c.NewLocationThresholdKM
+	}
+	if c.TTLJitterSource == nil {
+		c.TTLJitterSource = defaults.TTLJitterSource
+	}
+	if c.SessionIDGenerator == nil {
+		c.SessionIDGenerator = defaults.SessionIDGenerator
+	}
+	if c.UAParser == nil {
+		c.UAParser = defaults.UAParser
+	}
+	if c.DeviceFingerprinter == nil {
+		c.DeviceFingerprinter = defaults.DeviceFingerprinter
+	}
+	if c.AnalyticsUserBuckets <= 0 {
+		c.AnalyticsUserBuckets = defaults.AnalyticsUserBuckets
+	}
+	if c.DeviceTokenTTL <= 0 {
+		c.DeviceTokenTTL = defaults.DeviceTokenTTL
+	}
+	if c.IdempotencyTTL <= 0 {
+		c.IdempotencyTTL = defaults.IdempotencyTTL
+	}
+	if c.Logger == nil {
+		c.Logger = nopLogger{}
+	}
 	if c.DatabasePath == "" {
 		c.DatabasePath = defaults.DatabasePath
 	}
@@ -0,0 +1,26 @@
+package heimdall
+
+import "strings"
+
+// countrySet returns the upper-cased ISO codes as a set, or nil if empty.
+func countrySet(codes []string) map[string]bool {
+	if len(codes) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[strings.ToUpper(strings.TrimSpace(code))] = true
+	}
+	return set
+}
+
+// countryBlocked reports whether logins from countryCode are rejected by
+// Config.BlockedCountries or Config.AllowedCountries. An unresolved country
+// is only blocked by an allowlist.
+func (h *Heimdall) countryBlocked(countryCode string) bool {
+	code := strings.ToUpper(countryCode)
+	if h.allowedCountries != nil {
+		return !h.allowedCountries[code]
+	}
+	return h.blockedCountries[code]
+}
@@ -0,0 +1,70 @@
+package heimdall
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCountryLists(t *testing.T) {
+	device := DeviceInfo{IP: "1.2.3.4", UserAgent: "test"}
+	germany := LocationInfo{IP: "1.2.3.4", Country: "Germany", CountryCode: "DE"}
+	unresolved := LocationInfo{IP: "1.2.3.4"}
+
+	tests := []struct {
+		name     string
+		config   Config
+		location LocationInfo
+		blocked  bool
+	}{
+		{"blocked country", Config{BlockedCountries: []string{"kp", "DE"}}, germany, true},
+		{"country not blocked", Config{BlockedCountries: []string{"KP"}}, germany, false},
+		{"unresolved with blocklist", Config{BlockedCountries: []string{"KP"}}, unresolved, false},
+		{"allowed country", Config{AllowedCountries: []string{"de"}}, germany, false},
+		{"country not allowed", Config{AllowedCountries: []string{"FR"}}, germany, true},
+		{"unresolved with allowlist", Config{AllowedCountries: []string{"DE"}}, unresolved, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := newTestHeimdallWithConfig(tt.config)
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			result, err := h.RegisterSession("user123", "session1", device, tt.location, 0)
+			sessions, listErr := h.ListSessions("user123")
+			if listErr != nil {
+				t.Fatalf("Failed to list sessions: %v", listErr)
+			}
+
+			if tt.blocked {
+				if !errors.Is(err, ErrLocationBlocked) {
+					t.Errorf("Expected ErrLocationBlocked, got %v", err)
+				}
+				if result != nil {
+					t.Error("Expected no result for a blocked login")
+				}
+				if len(sessions) != 0 {
+					t.Errorf("Expected blocked login not to be saved, got %d sessions", len(sessions))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to register session: %v", err)
+			}
+			if len(sessions) != 1 {
+				t.Errorf("Expected 1 session, got %d", len(sessions))
+			}
+		})
+	}
+}
+
+func TestCountryListsMutuallyExclusive(t *testing.T) {
+	_, err := newTestHeimdallWithConfig(Config{
+		BlockedCountries: []string{"KP"},
+		AllowedCountries: []string{"DE"},
+	})
+	if err == nil {
+		t.Fatal("Expected error when both BlockedCountries and AllowedCountries are set")
+	}
+}
@@ -0,0 +1,61 @@
+package heimdall
+
+import "fmt"
+
+// DeviceSummary describes one of a user's devices for a "your devices" UI.
+type DeviceSummary struct {
+	// Device is the device of the latest session on it.
+	Device DeviceInfo `json:"device"`
+
+	// Location is the location of the latest session on the device.
+	Location LocationInfo `json:"location"`
+
+	// LatestSession is the most recently created active session on the device.
+	LatestSession *Session `json:"latest_session"`
+
+	// SessionCount is the number of active sessions on the device.
+	SessionCount int `json:"session_count"`
+}
+
+// ListDevices returns the user's devices with active sessions, most recently
+// used first. Devices are identified by fingerprint, or by User-Agent for
+// sessions whose fingerprint is missing or of another version, as for
+// Config.OneSessionPerDevice; sessions with neither are listed as separate
+// devices. Pass Device.Fingerprint to InvalidateByFingerprint to sign a
+// device out.
+func (h *Heimdall) ListDevices(userID string) ([]DeviceSummary, error) {
+	sessions, err := h.ListSessions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to list devices: %w", err)
+	}
+
+	devices := []DeviceSummary{}
+
+	// Sessions are newest first, so the first session seen per device is its latest
+	for _, s := range sessions {
+		if i := findDevice(devices, s.Device); i >= 0 {
+			devices[i].SessionCount++
+			continue
+		}
+
+		devices = append(devices, DeviceSummary{
+			Device:        s.Device,
+			Location:      s.Location,
+			LatestSession: s,
+			SessionCount:  1,
+		})
+	}
+
+	return devices, nil
+}
+
+// findDevice returns the index of the summary in devices for the same device
+// as device, or -1 if there is none.
+func findDevice(devices []DeviceSummary, device DeviceInfo) int {
+	for i, d := range devices {
+		if sameDevice(d.Device, device) {
+			return i
+		}
+	}
+	return -1
+}
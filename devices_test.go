@@ -0,0 +1,56 @@
+package heimdall
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListDevices(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	phone := DeviceInfo{IP: "8.8.4.4", UserAgent: "Mozilla/5.0 (iPhone)", DeviceType: "mobile"}
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)", DeviceType: "desktop"}
+	nyc := LocationInfo{IP: "8.8.4.4", City: "New York", Country: "United States"}
+	boston := LocationInfo{IP: "8.8.4.4", City: "Boston", Country: "United States"}
+
+	now := time.Now()
+	logins := []struct {
+		sessionID string
+		device    DeviceInfo
+		location  LocationInfo
+		createdAt time.Time
+	}{
+		{"phone-old", phone, nyc, now.Add(-3 * time.Minute)},
+		{"laptop", laptop, nyc, now.Add(-2 * time.Minute)},
+		{"phone-new", phone, boston, now.Add(-1 * time.Minute)},
+	}
+	for _, l := range logins {
+		opts := RegisterOptions{CreatedAt: l.createdAt}
+		if _, err := h.RegisterSessionWithOptions("user123", l.sessionID, l.device, l.location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	devices, err := h.ListDevices("user123")
+	if err != nil {
+		t.Fatalf("ListDevices failed: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 devices, got %d", len(devices))
+	}
+
+	if devices[0].Device.UserAgent != phone.UserAgent || devices[0].SessionCount != 2 {
+		t.Errorf("Expected the phone with 2 sessions first, got %+v", devices[0])
+	}
+	if devices[0].LatestSession.SessionID != "phone-new" || devices[0].Location.City != "Boston" {
+		t.Errorf("Expected the phone's latest session from Boston, got %s from %s",
+			devices[0].LatestSession.SessionID, devices[0].Location.City)
+	}
+	if devices[1].Device.UserAgent != laptop.UserAgent || devices[1].SessionCount != 1 {
+		t.Errorf("Expected the laptop with 1 session second, got %+v", devices[1])
+	}
+}
@@ -0,0 +1,70 @@
+package heimdall
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IssueDeviceToken returns a signed "remembered device" token binding
+// fingerprint to userID, for the app to store in a long-lived cookie.
+// fingerprint is any stable identifier the app uses for the device, e.g. its
+// User-Agent or an app-generated device ID. Tokens are signed with
+// Config.DeviceTokenSecret and expire after Config.DeviceTokenTTL.
+func (h *Heimdall) IssueDeviceToken(userID, fingerprint string) (string, error) {
+	if len(h.config.DeviceTokenSecret) == 0 {
+		return "", ErrDeviceTokenSecretNotConfigured
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(fingerprint))
+	issuedAt := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := h.deviceTokenMAC(userID, encoded, issuedAt)
+
+	return encoded + "." + issuedAt + "." + base64.RawURLEncoding.EncodeToString(mac), nil
+}
+
+// VerifyDeviceToken checks a token issued by IssueDeviceToken for userID and
+// returns the device fingerprint it was issued for. ok is false if the token
+// is malformed, was issued for another user, has been tampered with or has
+// expired.
+func (h *Heimdall) VerifyDeviceToken(userID, token string) (fingerprint string, ok bool) {
+	if len(h.config.DeviceTokenSecret) == 0 {
+		return "", false
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	encoded, issuedAt := parts[0], parts[1]
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac, h.deviceTokenMAC(userID, encoded, issuedAt)) {
+		return "", false
+	}
+
+	issued, err := strconv.ParseInt(issuedAt, 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > h.config.DeviceTokenTTL {
+		return "", false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// deviceTokenMAC returns the HMAC-SHA256 of a device token's fields.
+func (h *Heimdall) deviceTokenMAC(userID, encodedFingerprint, issuedAt string) []byte {
+	mac := hmac.New(sha256.New, h.config.DeviceTokenSecret)
+	mac.Write([]byte(userID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(encodedFingerprint))
+	mac.Write([]byte{0})
+	mac.Write([]byte(issuedAt))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,113 @@
+package heimdall
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeviceTokenRoundTrip(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{DeviceTokenSecret: []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	fingerprint := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) Chrome/120.0"
+	token, err := h.IssueDeviceToken("user1", fingerprint)
+	if err != nil {
+		t.Fatalf("IssueDeviceToken failed: %v", err)
+	}
+
+	got, ok := h.VerifyDeviceToken("user1", token)
+	if !ok {
+		t.Fatal("Expected token to verify")
+	}
+	if got != fingerprint {
+		t.Errorf("Expected fingerprint %q, got %q", fingerprint, got)
+	}
+
+	if _, ok := h.VerifyDeviceToken("user2", token); ok {
+		t.Error("Expected token issued for user1 to be rejected for user2")
+	}
+}
+
+func TestDeviceTokenTampering(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{DeviceTokenSecret: []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	token, err := h.IssueDeviceToken("user1", "device-a")
+	if err != nil {
+		t.Fatalf("IssueDeviceToken failed: %v", err)
+	}
+	other, err := h.IssueDeviceToken("user1", "device-b")
+	if err != nil {
+		t.Fatalf("IssueDeviceToken failed: %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	otherParts := strings.Split(other, ".")
+
+	tampered := map[string]string{
+		"swapped fingerprint": otherParts[0] + "." + parts[1] + "." + parts[2],
+		"changed issued at":   parts[0] + ".1." + parts[2],
+		"truncated signature": parts[0] + "." + parts[1] + "." + parts[2][:len(parts[2])-2],
+		"missing part":        parts[0] + "." + parts[2],
+		"empty":               "",
+	}
+	for name, tok := range tampered {
+		if _, ok := h.VerifyDeviceToken("user1", tok); ok {
+			t.Errorf("%s: expected token to be rejected", name)
+		}
+	}
+
+	rotated, err := newTestHeimdallWithConfig(Config{DeviceTokenSecret: []byte("another secret of thirty-two b!!")})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer rotated.Close()
+
+	if _, ok := rotated.VerifyDeviceToken("user1", token); ok {
+		t.Error("Expected token to be rejected after secret rotation")
+	}
+}
+
+func TestDeviceTokenExpiry(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		DeviceTokenSecret: []byte("0123456789abcdef0123456789abcdef"),
+		DeviceTokenTTL:    time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	token, err := h.IssueDeviceToken("user1", "device-a")
+	if err != nil {
+		t.Fatalf("IssueDeviceToken failed: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	if _, ok := h.VerifyDeviceToken("user1", token); ok {
+		t.Error("Expected expired token to be rejected")
+	}
+}
+
+func TestDeviceTokenSecretNotConfigured(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.IssueDeviceToken("user1", "device-a"); !errors.Is(err, ErrDeviceTokenSecretNotConfigured) {
+		t.Errorf("Expected ErrDeviceTokenSecretNotConfigured, got %v", err)
+	}
+	if _, ok := h.VerifyDeviceToken("user1", "a.1.b"); ok {
+		t.Error("Expected verification to fail without a secret")
+	}
+}
@@ -0,0 +1,56 @@
+package heimdall
+
+import "strings"
+
+// DeviceType is the coarse class of device a session was created from.
+type DeviceType string
+
+// Device types. The built-in extractor only produces desktop, mobile,
+// tablet, bot and unknown; the others are available to a DeviceClassifier.
+const (
+	DeviceDesktop  DeviceType = "desktop"
+	DeviceMobile   DeviceType = "mobile"
+	DeviceTablet   DeviceType = "tablet"
+	DeviceBot      DeviceType = "bot"
+	DeviceTV       DeviceType = "tv"
+	DeviceConsole  DeviceType = "console"
+	DeviceWearable DeviceType = "wearable"
+	DeviceUnknown  DeviceType = "unknown"
+)
+
+// deviceTypes lists every valid DeviceType.
+var deviceTypes = []DeviceType{
+	DeviceDesktop,
+	DeviceMobile,
+	DeviceTablet,
+	DeviceBot,
+	DeviceTV,
+	DeviceConsole,
+	DeviceWearable,
+	DeviceUnknown,
+}
+
+// String returns the serialized form of the device type.
+func (t DeviceType) String() string {
+	return string(t)
+}
+
+// Valid reports whether t is one of the defined device types.
+func (t DeviceType) Valid() bool {
+	for _, known := range deviceTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDeviceType parses a stored device type, ignoring case and surrounding
+// whitespace. Unrecognized values parse as DeviceUnknown.
+func ParseDeviceType(s string) DeviceType {
+	t := DeviceType(strings.ToLower(strings.TrimSpace(s)))
+	if !t.Valid() {
+		return DeviceUnknown
+	}
+	return t
+}
@@ -0,0 +1,83 @@
+package heimdall
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExtractDeviceInfoDeviceType(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want DeviceType
+	}{
+		{"desktop", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", DeviceDesktop},
+		{"mobile", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", DeviceMobile},
+		{"tablet", "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/604.1", DeviceTablet},
+		{"bot", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", DeviceBot},
+		{"empty", "", DeviceUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}, RemoteAddr: "203.0.113.7:4242"}
+			r.Header.Set("User-Agent", tt.ua)
+
+			if got := ExtractDeviceInfo(r).DeviceType; got != tt.want {
+				t.Errorf("ExtractDeviceInfo().DeviceType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDeviceType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want DeviceType
+	}{
+		{"desktop", DeviceDesktop},
+		{"Mobile", DeviceMobile},
+		{" tv ", DeviceTV},
+		{"wearable", DeviceWearable},
+		{"", DeviceUnknown},
+		{"kiosk", DeviceUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ParseDeviceType(tt.in); got != tt.want {
+			t.Errorf("ParseDeviceType(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, dt := range deviceTypes {
+		if got := ParseDeviceType(dt.String()); got != dt {
+			t.Errorf("ParseDeviceType(%q) = %q, want %q", dt.String(), got, dt)
+		}
+	}
+}
+
+func TestDeviceTypeStoreRoundTrip(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	for _, dt := range deviceTypes {
+		userID := "user-" + dt.String()
+		device := DeviceInfo{IP: "203.0.113.7", UserAgent: "test", DeviceType: dt}
+		if _, err := h.RegisterSession(userID, "session-"+dt.String(), device, LocationInfo{IP: "203.0.113.7"}, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+
+		sessions, err := h.ListSessions(userID)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 1 {
+			t.Fatalf("Expected 1 session, got %d", len(sessions))
+		}
+		if got := sessions[0].Device.DeviceType; got != dt {
+			t.Errorf("Expected DeviceType %q after round trip, got %q", dt, got)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package heimdall
+
+import (
+	"fmt"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// Diagnostics contains runtime information about Heimdall's backends,
+// intended for capacity monitoring and health pages.
+type Diagnostics struct {
+	// GeoIPEnabled is true if a GeoIP database is configured.
+	GeoIPEnabled bool `json:"geoip_enabled"`
+
+	// InvalidatedEntries is the number of entries tracked by the invalidation cache.
+	// -1 if the cache does not implement store.StatsCache.
+	InvalidatedEntries int `json:"invalidated_entries"`
+}
+
+// Diagnostics returns runtime information about the configured backends.
+func (h *Heimdall) Diagnostics() (*Diagnostics, error) {
+	d := &Diagnostics{
+		GeoIPEnabled:       h.geoip != nil,
+		InvalidatedEntries: -1,
+	}
+
+	if stats, ok := h.invalidated.(store.StatsCache); ok {
+		n, err := storeCall(h, "Len", stats.Len)
+		if err != nil {
+			return nil, fmt.Errorf("heimdall: failed to count invalidated entries: %w", err)
+		}
+		d.InvalidatedEntries = n
+	}
+
+	return d, nil
+}
@@ -1,6 +1,9 @@
 package heimdall
 
-import "math"
+import (
+	"math"
+	"strings"
+)
 
 const earthRadiusKM = 6371.0
 
@@ -25,13 +28,18 @@ func HaversineDistance(lat1, lng1, lat2, lng2 float64) float64 {
 
 // IsNewLocation returns true if the distance between two locations
 // exceeds the given threshold in kilometers.
+// Identical coordinates are never a new location, without computing the
+// distance. The exception is a threshold of zero or less, which is left to
+// the distance comparison.
 func IsNewLocation(prev, curr LocationInfo, thresholdKM float64) bool {
 	// If either location has no coordinates, compare by city/country
-	if prev.Latitude == 0 && prev.Longitude == 0 {
-		return prev.City != curr.City || prev.Country != curr.Country
+	if !hasCoordinates(prev) || !hasCoordinates(curr) {
+		return !sameCityCountry(prev, curr)
 	}
-	if curr.Latitude == 0 && curr.Longitude == 0 {
-		return prev.City != curr.City || prev.Country != curr.Country
+
+	// Common for users on a static IP
+	if thresholdKM > 0 && prev.Latitude == curr.Latitude && prev.Longitude == curr.Longitude {
+		return false
 	}
 
 	distance := HaversineDistance(
@@ -41,3 +49,58 @@ func IsNewLocation(prev, curr LocationInfo, thresholdKM float64) bool {
 
 	return distance > thresholdKM
 }
+
+// SessionDistanceMatrix returns the pairwise Haversine distances in kilometers
+// between the sessions' locations. The matrix is symmetric with zeros on the
+// diagonal. Distances involving a session without coordinates are 0.
+func SessionDistanceMatrix(sessions []*Session) [][]float64 {
+	matrix := make([][]float64, len(sessions))
+	for i := range matrix {
+		matrix[i] = make([]float64, len(sessions))
+	}
+
+	for i := 0; i < len(sessions); i++ {
+		for j := i + 1; j < len(sessions); j++ {
+			a, b := sessions[i].Location, sessions[j].Location
+			if !hasCoordinates(a) || !hasCoordinates(b) {
+				continue
+			}
+			distance := HaversineDistance(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+			matrix[i][j] = distance
+			matrix[j][i] = distance
+		}
+	}
+
+	return matrix
+}
+
+// hasCoordinates reports whether a location has a known latitude/longitude.
+// (0, 0) is treated as unknown.
+func hasCoordinates(loc LocationInfo) bool {
+	return loc.Latitude != 0 || loc.Longitude != 0
+}
+
+// sameCityCountry reports whether two locations name the same city and country.
+// Names are compared case-insensitively, ignoring surrounding whitespace.
+// ISO country codes are compared instead of country names when both are known,
+// since names vary between GeoIP providers and locales ("United States" vs "USA").
+func sameCityCountry(a, b LocationInfo) bool {
+	if normalizePlaceName(a.City) != normalizePlaceName(b.City) {
+		return false
+	}
+	return sameCountry(a, b)
+}
+
+// sameCountry reports whether two locations are in the same country,
+// comparing ISO codes when both are known and normalized names otherwise.
+func sameCountry(a, b LocationInfo) bool {
+	if a.CountryCode != "" && b.CountryCode != "" {
+		return strings.EqualFold(a.CountryCode, b.CountryCode)
+	}
+	return normalizePlaceName(a.Country) == normalizePlaceName(b.Country)
+}
+
+// normalizePlaceName lowercases a place name and trims surrounding whitespace.
+func normalizePlaceName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -3,6 +3,7 @@ package heimdall
 import (
 	"math"
 	"testing"
+	"time"
 )
 
 func TestHaversineDistance(t *testing.T) {
@@ -464,6 +465,61 @@ func TestIsNewLocation(t *testing.T) {
 			thresholdKM: 100,
 			want:        false,
 		},
+		{
+			name: "no coords - city and country differ only in case/whitespace - not new",
+			prev: LocationInfo{
+				City:    "New York",
+				Country: "United States",
+			},
+			curr: LocationInfo{
+				City:    " new york",
+				Country: "UNITED STATES ",
+			},
+			thresholdKM: 100,
+			want:        false,
+		},
+		{
+			name: "no coords - country name variants with same ISO code - not new",
+			prev: LocationInfo{
+				City:        "New York",
+				Country:     "United States",
+				CountryCode: "US",
+			},
+			curr: LocationInfo{
+				City:        "New York",
+				Country:     "USA",
+				CountryCode: "us",
+			},
+			thresholdKM: 100,
+			want:        false,
+		},
+		{
+			name: "no coords - same country name but different ISO codes - is new",
+			prev: LocationInfo{
+				Country:     "Congo",
+				CountryCode: "CG",
+			},
+			curr: LocationInfo{
+				Country:     "Congo",
+				CountryCode: "CD",
+			},
+			thresholdKM: 100,
+			want:        true,
+		},
+		{
+			name: "no coords - ISO code missing on one side falls back to names - is new",
+			prev: LocationInfo{
+				City:        "New York",
+				Country:     "United States",
+				CountryCode: "US",
+			},
+			curr: LocationInfo{
+				City:    "New York",
+				Country: "USA",
+			},
+			thresholdKM: 100,
+			want:        true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -477,6 +533,23 @@ func TestIsNewLocation(t *testing.T) {
 	}
 }
 
+func TestIsNewLocationIdenticalCoordinates(t *testing.T) {
+	loc := LocationInfo{City: "New York", Country: "United States", Latitude: 40.7128, Longitude: -74.0060}
+	moved := loc
+	moved.City = "Somewhere Else" // only the coordinates are compared
+
+	for _, threshold := range []float64{0, 0.001, 100, 20000} {
+		if IsNewLocation(loc, moved, threshold) {
+			t.Errorf("Threshold %v: identical coordinates should not be a new location", threshold)
+		}
+	}
+
+	// Negative thresholds are left to the distance comparison
+	if !IsNewLocation(loc, moved, -1) {
+		t.Error("Threshold -1: expected every location to be new")
+	}
+}
+
 func TestIsNewLocationWithRealWorldScenarios(t *testing.T) {
 	// Test realistic session location change scenarios
 	tests := []struct {
@@ -590,6 +663,62 @@ func TestIsNewLocationWithRealWorldScenarios(t *testing.T) {
 	}
 }
 
+func TestSessionDistanceMatrix(t *testing.T) {
+	sessions := []*Session{
+		{SessionID: "nyc", Location: LocationInfo{Latitude: 40.7128, Longitude: -74.0060}},
+		{SessionID: "london", Location: LocationInfo{Latitude: 51.5074, Longitude: -0.1278}},
+		{SessionID: "paris", Location: LocationInfo{Latitude: 48.8566, Longitude: 2.3522}},
+		{SessionID: "unknown", Location: LocationInfo{City: "Nowhere"}},
+	}
+
+	matrix := SessionDistanceMatrix(sessions)
+
+	if len(matrix) != len(sessions) {
+		t.Fatalf("Expected %d rows, got %d", len(sessions), len(matrix))
+	}
+
+	for i := range matrix {
+		if len(matrix[i]) != len(sessions) {
+			t.Fatalf("Expected %d columns in row %d, got %d", len(sessions), i, len(matrix[i]))
+		}
+		if matrix[i][i] != 0 {
+			t.Errorf("Expected 0 on the diagonal at %d, got %v", i, matrix[i][i])
+		}
+		for j := range matrix[i] {
+			if matrix[i][j] != matrix[j][i] {
+				t.Errorf("Matrix not symmetric at (%d, %d): %v != %v", i, j, matrix[i][j], matrix[j][i])
+			}
+		}
+	}
+
+	expected := []struct {
+		i, j int
+		km   float64
+	}{
+		{0, 1, 5570}, // NYC to London
+		{1, 2, 344},  // London to Paris
+		{0, 2, 5837}, // NYC to Paris
+	}
+	for _, e := range expected {
+		if got := matrix[e.i][e.j]; math.Abs(got-e.km) > e.km*0.01 {
+			t.Errorf("Distance %s-%s = %.0f km, want ~%.0f km",
+				sessions[e.i].SessionID, sessions[e.j].SessionID, got, e.km)
+		}
+	}
+
+	for j := range sessions {
+		if matrix[3][j] != 0 {
+			t.Errorf("Expected 0 for session without coordinates at (3, %d), got %v", j, matrix[3][j])
+		}
+	}
+}
+
+func TestSessionDistanceMatrixEmpty(t *testing.T) {
+	if matrix := SessionDistanceMatrix(nil); len(matrix) != 0 {
+		t.Errorf("Expected empty matrix, got %v", matrix)
+	}
+}
+
 // Benchmark tests
 func BenchmarkHaversineDistance(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -617,6 +746,20 @@ func BenchmarkIsNewLocation(b *testing.B) {
 	}
 }
 
+func BenchmarkIsNewLocationIdenticalCoords(b *testing.B) {
+	loc := LocationInfo{
+		City:      "New York",
+		Country:   "United States",
+		Latitude:  40.7128,
+		Longitude: -74.0060,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		IsNewLocation(loc, loc, 100)
+	}
+}
+
 func BenchmarkIsNewLocationNoCoords(b *testing.B) {
 	prev := LocationInfo{
 		City:    "New York",
@@ -632,3 +775,46 @@ func BenchmarkIsNewLocationNoCoords(b *testing.B) {
 		IsNewLocation(prev, curr, 100)
 	}
 }
+
+func TestListSessionsByProximity(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	logins := []struct {
+		sessionID string
+		location  LocationInfo
+	}{
+		{"tokyo", LocationInfo{City: "Tokyo", Latitude: 35.6762, Longitude: 139.6503}},
+		{"unknown-old", LocationInfo{}},
+		{"boston", LocationInfo{City: "Boston", Latitude: 42.3601, Longitude: -71.0589}},
+		{"london", LocationInfo{City: "London", Latitude: 51.5074, Longitude: -0.1278}},
+		{"unknown-new", LocationInfo{}},
+		{"brooklyn", LocationInfo{City: "Brooklyn", Latitude: 40.6782, Longitude: -73.9442}},
+	}
+	now := time.Now()
+	for i, l := range logins {
+		device := DeviceInfo{IP: "8.8.8.8", UserAgent: "test"}
+		opts := RegisterOptions{CreatedAt: now.Add(time.Duration(i-len(logins)) * time.Minute)}
+		if _, err := h.RegisterSessionWithOptions("user123", l.sessionID, device, l.location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	// Reference point in Manhattan
+	sessions, err := h.ListSessionsByProximity("user123", 40.7128, -74.0060)
+	if err != nil {
+		t.Fatalf("ListSessionsByProximity failed: %v", err)
+	}
+	want := []string{"brooklyn", "boston", "london", "tokyo", "unknown-new", "unknown-old"}
+	if len(sessions) != len(want) {
+		t.Fatalf("Expected %d sessions, got %d", len(want), len(sessions))
+	}
+	for i, id := range want {
+		if sessions[i].SessionID != id {
+			t.Errorf("Position %d: expected %s, got %s", i, id, sessions[i].SessionID)
+		}
+	}
+}
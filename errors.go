@@ -16,9 +16,79 @@ var (
 	// without configuring the GeoIP database path.
 	ErrGeoIPDatabaseNotConfigured = errors.New("heimdall: GeoIP database path not configured")
 
+	// ErrGeoIPDatabaseInvalid is returned when the GeoIP database file exists
+	// but is corrupt or not a City/Country edition.
+	ErrGeoIPDatabaseInvalid = errors.New("heimdall: invalid GeoIP database")
+
 	// ErrGeoIPLookupFailed is returned when IP geolocation lookup fails.
 	ErrGeoIPLookupFailed = errors.New("heimdall: GeoIP lookup failed")
 
+	// ErrInvalidSessionID is returned when a session ID is rejected by
+	// Config.SessionIDValidator.
+	ErrInvalidSessionID = errors.New("heimdall: invalid session ID")
+
+	// ErrTTLOutOfRange is returned when a requested session TTL is outside
+	// MinSessionTTL and MaxSessionTTL while RejectOutOfRangeTTL is enabled.
+	ErrTTLOutOfRange = errors.New("heimdall: session TTL out of range")
+
+	// ErrInvalidLimit is returned by RegisterSession and UsersOverLimit when
+	// the concurrent session limit is negative.
+	ErrInvalidLimit = errors.New("heimdall: invalid concurrent session limit")
+
+	// ErrFutureCreatedAt is returned when a session is registered with a
+	// creation time in the future.
+	ErrFutureCreatedAt = errors.New("heimdall: session creation time is in the future")
+
+	// ErrMissingUserAgent is returned when registering a session without a
+	// User-Agent while RejectEmptyUserAgent is enabled.
+	ErrMissingUserAgent = errors.New("heimdall: missing user agent")
+
+	// ErrMissingClientIP is returned by ExtractRequestInfo when no valid client
+	// IP can be determined while RequireClientIP is enabled.
+	ErrMissingClientIP = errors.New("heimdall: missing client IP")
+
+	// ErrLocationBlocked is returned by RegisterSession when the login's
+	// country is rejected by Config.BlockedCountries or Config.AllowedCountries.
+	ErrLocationBlocked = errors.New("heimdall: login location blocked")
+
+	// ErrCloseTimeout is returned by CloseWithTimeout when the backends do not
+	// finish closing in time.
+	ErrCloseTimeout = errors.New("heimdall: timed out waiting for close")
+
+	// ErrOperationTimeout is returned when a session store or invalidation
+	// cache call takes longer than Config.OperationTimeout.
+	ErrOperationTimeout = errors.New("heimdall: store operation timed out")
+
+	// ErrUnsupportedStore is returned when an operation needs an optional
+	// capability the configured session store does not implement.
+	ErrUnsupportedStore = errors.New("heimdall: operation not supported by session store")
+
+	// ErrInvalidDeviceType is returned when an operation is given a value
+	// that is not one of the defined DeviceType constants.
+	ErrInvalidDeviceType = errors.New("heimdall: invalid device type")
+
+	// ErrInvalidSearchCriteria is returned by FindSessions when the criteria
+	// would match every session.
+	ErrInvalidSearchCriteria = errors.New("heimdall: search criteria must include an IP or country")
+
+	// ErrInvalidTimeRange is returned by LoginTimeSeries when the range is
+	// empty, the bucket is shorter than a second, or the range needs too
+	// many buckets.
+	ErrInvalidTimeRange = errors.New("heimdall: invalid time range")
+
+	// ErrDeviceTokenSecretNotConfigured is returned when issuing a device
+	// token without Config.DeviceTokenSecret.
+	ErrDeviceTokenSecretNotConfigured = errors.New("heimdall: device token secret not configured")
+
+	// ErrDuplicateBatchUser is returned by RegisterSessions when two requests
+	// are for the same user, since they would not count towards each
+	// other's limits.
+	ErrDuplicateBatchUser = errors.New("heimdall: batch has several requests for the same user")
+
+	// ErrIdempotencyKeyInBatch is returned by RegisterSessions when a request
+	// sets RegisterOptions.IdempotencyKey, which batches do not support.
+	ErrIdempotencyKeyInBatch = errors.New("heimdall: idempotency keys are not supported in batches")
+
 	// ErrInvalidIP is returned when an invalid IP address is provided.
 	ErrInvalidIP = errors.New("heimdall: invalid IP address")
 )
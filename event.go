@@ -0,0 +1,69 @@
+package heimdall
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LoginEvent consolidates the signals RegisterSession computed for a login
+// into a single payload for downstream systems such as SIEMs or audit logs.
+type LoginEvent struct {
+	IsNewLocation  bool `json:"is_new_location"`
+	IsNewDevice    bool `json:"is_new_device"`
+	IsNewCountry   bool `json:"is_new_country"`
+	LimitExceeded  bool `json:"limit_exceeded"`
+	RequiresStepUp bool `json:"requires_step_up"`
+
+	// ImpossibleTravel and RiskScore mirror RegisterResult.Score; both are
+	// zero for a user's first login, which has no score.
+	ImpossibleTravel bool    `json:"impossible_travel"`
+	RiskScore        float64 `json:"risk_score"`
+}
+
+// newLoginEvent returns the LoginEvent for result.
+func newLoginEvent(result *RegisterResult) LoginEvent {
+	event := LoginEvent{
+		IsNewLocation:  result.IsNewLocation,
+		IsNewDevice:    result.IsNewDevice,
+		IsNewCountry:   result.IsNewCountry,
+		LimitExceeded:  result.LimitExceeded,
+		RequiresStepUp: result.RequiresStepUp,
+	}
+	if result.Score != nil {
+		event.ImpossibleTravel = result.Score.ImpossibleTravel
+		event.RiskScore = result.Score.Score
+	}
+	return event
+}
+
+// Summary returns a short human-readable description of the signals,
+// e.g. "new device, new country, step-up required", or "no signals".
+func (e LoginEvent) Summary() string {
+	var parts []string
+	if e.IsNewLocation {
+		parts = append(parts, "new location")
+	}
+	if e.IsNewDevice {
+		parts = append(parts, "new device")
+	}
+	if e.IsNewCountry {
+		parts = append(parts, "new country")
+	}
+	if e.ImpossibleTravel {
+		parts = append(parts, "impossible travel")
+	}
+	if e.LimitExceeded {
+		parts = append(parts, "session limit exceeded")
+	}
+	if e.RequiresStepUp {
+		parts = append(parts, "step-up required")
+	}
+	if e.RiskScore > 0 {
+		parts = append(parts, fmt.Sprintf("risk score %.2f", e.RiskScore))
+	}
+
+	if len(parts) == 0 {
+		return "no signals"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,52 @@
+package heimdall
+
+import "testing"
+
+func TestLoginEventMatchesResult(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	nyc := LocationInfo{City: "New York", Country: "United States", CountryCode: "US", Latitude: 40.7128, Longitude: -74.0060}
+	tokyo := LocationInfo{City: "Tokyo", Country: "Japan", CountryCode: "JP", Latitude: 35.6762, Longitude: 139.6503}
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	phone := DeviceInfo{IP: "8.8.4.4", UserAgent: "Mozilla/5.0 (iPhone)"}
+
+	steps := []struct {
+		sessionID string
+		device    DeviceInfo
+		location  LocationInfo
+		summary   string
+	}{
+		{"session1", laptop, nyc, "no signals"},
+		{"session2", phone, tokyo, "new location, new device, new country, impossible travel, step-up required, risk score 0.90"},
+		{"session3", laptop, nyc, "new location, impossible travel, session limit exceeded, step-up required, risk score 0.90"},
+	}
+
+	for _, step := range steps {
+		result, err := h.RegisterSession("user123", step.sessionID, step.device, step.location, 2)
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+
+		want := LoginEvent{
+			IsNewLocation:  result.IsNewLocation,
+			IsNewDevice:    result.IsNewDevice,
+			IsNewCountry:   result.IsNewCountry,
+			LimitExceeded:  result.LimitExceeded,
+			RequiresStepUp: result.RequiresStepUp,
+		}
+		if result.Score != nil {
+			want.ImpossibleTravel = result.Score.ImpossibleTravel
+			want.RiskScore = result.Score.Score
+		}
+		if result.Event != want {
+			t.Errorf("%s: expected event %+v, got %+v", step.sessionID, want, result.Event)
+		}
+		if got := result.Event.Summary(); got != step.summary {
+			t.Errorf("%s: expected summary %q, got %q", step.sessionID, step.summary, got)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package heimdall
+
+import (
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// ExpireHandler is called with a session that expired without being
+// invalidated, e.g. to clean up resources tied to it. It is called
+// synchronously on the request path, so implementations should not block.
+type ExpireHandler func(session *Session)
+
+// notifyExpired calls Config.OnExpire for the user's sessions that expired
+// since the previous check, or since New for the first check of the user.
+// Sessions that expired before New was called, or longer than
+// expiryRetention before the check, may not be reported. A failure to query
+// the store is logged rather than returned.
+func (h *Heimdall) notifyExpired(userID string) {
+	if h.config.OnExpire == nil {
+		return
+	}
+	expiredStore, ok := store.Optional[store.ExpiredSessionStore](h.sessions)
+	if !ok {
+		return
+	}
+
+	// Advance the watermark first, so concurrent checks report each
+	// session once
+	now := time.Now()
+	retention := h.expiryRetention()
+	h.expiryMu.Lock()
+	h.sweepExpiryChecked(now, retention)
+	since, checked := h.expiryChecked[userID]
+	if !checked {
+		// The user's watermark may have been swept
+		since = h.started
+		if floor := now.Add(-retention); floor.After(since) {
+			since = floor
+		}
+	}
+	h.expiryChecked[userID] = now
+	h.expiryMu.Unlock()
+
+	expired, err := storeCall(h, "GetExpiredByUser", func() ([]*store.Session, error) {
+		return expiredStore.GetExpiredByUser(userID, since)
+	})
+	if err != nil {
+		h.config.Logger.Error("heimdall: failed to get expired sessions", "user_id", userID, "error", err)
+
+		// Let the next check retry the window
+		h.expiryMu.Lock()
+		if h.expiryChecked[userID].Equal(now) {
+			h.expiryChecked[userID] = since
+		}
+		h.expiryMu.Unlock()
+		return
+	}
+
+	for _, s := range expired {
+		// Sessions expiring after now are left to the next check
+		if s.ExpiresAt().After(now) {
+			continue
+		}
+		h.config.OnExpire(storeToSession(s))
+	}
+}
+
+// expiryRetention is how long expiry watermarks are kept: the longest TTL a
+// session is normally given, so that a user's sessions alive at their last
+// check have expired by the time the watermark is swept.
+func (h *Heimdall) expiryRetention() time.Duration {
+	return max(h.config.SessionTTL, h.config.MaxSessionTTL) + h.config.TTLJitter
+}
+
+// sweepExpiryChecked forgets watermarks older than retention, at most once
+// per retention, so users who are never listed again do not accumulate.
+// The caller must hold expiryMu.
+func (h *Heimdall) sweepExpiryChecked(now time.Time, retention time.Duration) {
+	if now.Sub(h.expirySwept) < retention {
+		return
+	}
+	for userID, checked := range h.expiryChecked {
+		if now.Sub(checked) > retention {
+			delete(h.expiryChecked, userID)
+		}
+	}
+	h.expirySwept = now
+}
@@ -0,0 +1,98 @@
+package heimdall
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+func TestOnExpire(t *testing.T) {
+	var expired []string
+	sessions := store.NewMemorySessionStore()
+	h, err := New(Config{
+		SessionStore:      sessions,
+		InvalidationCache: store.NewMemoryCache(),
+		OnExpire: func(session *Session) {
+			expired = append(expired, session.SessionID)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	for _, s := range []*store.Session{
+		{SessionID: "active", UserID: "user123", TTLSeconds: 3600, CreatedAt: now},
+		{SessionID: "expiring", UserID: "user123", TTLSeconds: 3600, CreatedAt: now, StoredExpiresAt: now.Add(50 * time.Millisecond)},
+		{SessionID: "before-start", UserID: "user123", TTLSeconds: 3600, CreatedAt: now.Add(-2 * time.Hour)},
+	} {
+		if err := sessions.Save(s); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+
+	if _, err := h.ListSessions("user123"); err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(expired) != 0 {
+		t.Fatalf("Expected no expired sessions yet, got %v", expired)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	list, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(list) != 1 || list[0].SessionID != "active" {
+		t.Errorf("Expected only the active session to be listed, got %v", list)
+	}
+	if len(expired) != 1 || expired[0] != "expiring" {
+		t.Fatalf("Expected OnExpire for the expiring session, got %v", expired)
+	}
+
+	// Each expiry is reported once
+	if _, err := h.ListSessions("user123"); err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(expired) != 1 {
+		t.Errorf("Expected OnExpire to fire once, got %v", expired)
+	}
+}
+
+func TestOnExpireSweepsStaleWatermarks(t *testing.T) {
+	h, err := New(Config{
+		SessionStore:      store.NewMemorySessionStore(),
+		InvalidationCache: store.NewMemoryCache(),
+		SessionTTL:        time.Hour,
+		OnExpire:          func(session *Session) {},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	// Simulate users last listed long ago, and a sweep due
+	stale := time.Now().Add(-2 * time.Hour)
+	h.expiryMu.Lock()
+	for _, userID := range []string{"user1", "user2", "user3"} {
+		h.expiryChecked[userID] = stale
+	}
+	h.expirySwept = stale
+	h.expiryMu.Unlock()
+
+	if _, err := h.ListSessions("user4"); err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+
+	h.expiryMu.Lock()
+	defer h.expiryMu.Unlock()
+	if len(h.expiryChecked) != 1 {
+		t.Errorf("Expected only the listed user's watermark to remain, got %v", h.expiryChecked)
+	}
+	if _, ok := h.expiryChecked["user4"]; !ok {
+		t.Error("Expected a watermark for the listed user")
+	}
+}
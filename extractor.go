@@ -9,31 +9,39 @@ import (
 )
 
 // ExtractDeviceInfo extracts device information from an HTTP request.
+// Requests without a User-Agent get DeviceUnknown and Browser "Unknown".
 func ExtractDeviceInfo(r *http.Request) DeviceInfo {
+	return ExtractDeviceInfoWithParser(r, DefaultUAParser{})
+}
+
+// ExtractDeviceInfoWithParser is like ExtractDeviceInfo but parses the
+// User-Agent with parser instead of DefaultUAParser.
+func ExtractDeviceInfoWithParser(r *http.Request, parser UAParser) DeviceInfo {
 	ua := r.UserAgent()
 	ip := extractIP(r)
 
-	// Parse user agent
-	parsed := useragent.New(ua)
-	browser, browserVersion := parsed.Browser()
-	if browserVersion != "" {
-		browser = browser + " " + browserVersion
+	// Don't guess "desktop" for clients that send no User-Agent at all
+	if strings.TrimSpace(ua) == "" {
+		return DeviceInfo{
+			IP:         ip,
+			UserAgent:  ua,
+			Browser:    "Unknown",
+			DeviceType: DeviceUnknown,
+		}
 	}
 
-	osInfo := parsed.OSInfo()
-	os := osInfo.Name
-	if osInfo.Version != "" {
-		os = os + " " + osInfo.Version
-	}
+	browser, os, parsedType, mobile, bot := parser.Parse(ua)
 
-	// Determine device type
-	deviceType := "desktop"
-	if parsed.Mobile() {
-		deviceType = "mobile"
-	} else if parsed.Bot() {
-		deviceType = "bot"
+	// Determine device type, preferring the parser's own classification
+	deviceType := DeviceDesktop
+	if parsedType != "" {
+		deviceType = ParseDeviceType(parsedType)
+	} else if mobile {
+		deviceType = DeviceMobile
+	} else if bot {
+		deviceType = DeviceBot
 	} else if isTablet(ua) {
-		deviceType = "tablet"
+		deviceType = DeviceTablet
 	}
 
 	return DeviceInfo{
@@ -45,13 +53,53 @@ func ExtractDeviceInfo(r *http.Request) DeviceInfo {
 	}
 }
 
+// UAParser parses a User-Agent string, e.g. to swap in a parser with a more
+// up-to-date device database than DefaultUAParser.
+// deviceType is a DeviceType value, or empty to classify from mobile and bot
+// (falling back to tablet detection and then desktop).
+type UAParser interface {
+	Parse(ua string) (browser, os, deviceType string, mobile, bot bool)
+}
+
+// DefaultUAParser is the built-in UAParser, backed by
+// github.com/mssola/useragent. It leaves deviceType empty.
+type DefaultUAParser struct{}
+
+// Parse implements UAParser.
+func (DefaultUAParser) Parse(ua string) (browser, os, deviceType string, mobile, bot bool) {
+	parsed := useragent.New(ua)
+	browser, browserVersion := parsed.Browser()
+	if browserVersion != "" {
+		browser = browser + " " + browserVersion
+	}
+
+	osInfo := parsed.OSInfo()
+	os = osInfo.Name
+	if osInfo.Version != "" {
+		os = os + " " + osInfo.Version
+	}
+
+	return browser, os, "", parsed.Mobile(), parsed.Bot()
+}
+
+// DeviceClassifier overrides the device type detected from a User-Agent,
+// e.g. to report DeviceTV, DeviceConsole or DeviceWearable.
+// It receives the User-Agent and the default classification and returns the
+// DeviceType to use; return defaultType to keep it.
+type DeviceClassifier func(userAgent string, defaultType DeviceType) DeviceType
+
+// maxForwardedForEntries caps how many X-Forwarded-For entries are parsed.
+// Longer chains are treated as malformed and the header is ignored.
+const maxForwardedForEntries = 20
+
 // extractIP extracts the client IP from an HTTP request.
 // It checks common proxy headers first, then falls back to RemoteAddr.
+// The result is always either a valid IP address or the raw RemoteAddr.
 func extractIP(r *http.Request) string {
 	// Check X-Forwarded-For header (comma-separated list, first is client)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" && !hasControlChars(xff) {
+		ips := strings.SplitN(xff, ",", maxForwardedForEntries+1)
+		if len(ips) <= maxForwardedForEntries {
 			ip := strings.TrimSpace(ips[0])
 			if isValidIP(ip) {
 				return ip
@@ -60,7 +108,7 @@ func extractIP(r *http.Request) string {
 	}
 
 	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+	if xri := r.Header.Get("X-Real-IP"); xri != "" && !hasControlChars(xri) {
 		ip := strings.TrimSpace(xri)
 		if isValidIP(ip) {
 			return ip
@@ -68,7 +116,7 @@ func extractIP(r *http.Request) string {
 	}
 
 	// Check CF-Connecting-IP (Cloudflare)
-	if cfip := r.Header.Get("CF-Connecting-IP"); cfip != "" {
+	if cfip := r.Header.Get("CF-Connecting-IP"); cfip != "" && !hasControlChars(cfip) {
 		ip := strings.TrimSpace(cfip)
 		if isValidIP(ip) {
 			return ip
@@ -76,14 +124,58 @@ func extractIP(r *http.Request) string {
 	}
 
 	// Fall back to RemoteAddr
+	return remoteIP(r)
+}
+
+// remoteIP returns the IP of the direct peer from RemoteAddr, or the raw
+// RemoteAddr if it does not contain a valid IP.
+func remoteIP(r *http.Request) string {
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
+	if err != nil || !isValidIP(host) {
 		// RemoteAddr might not have a port
 		return r.RemoteAddr
 	}
 	return host
 }
 
+// forwardedHops returns the number of entries in the X-Forwarded-For header,
+// capped at maxForwardedForEntries+1.
+func forwardedHops(r *http.Request) int {
+	xff := r.Header.Get("X-Forwarded-For")
+	if xff == "" {
+		return 0
+	}
+	return len(strings.SplitN(xff, ",", maxForwardedForEntries+2))
+}
+
+// parseNetwork parses a CIDR, or a single IP as a host network.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, ErrInvalidIP
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// hasControlChars reports whether s contains ASCII control characters,
+// which never appear in a well-formed proxy header.
+func hasControlChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
 // isValidIP checks if the string is a valid IP address.
 func isValidIP(ip string) bool {
 	return net.ParseIP(ip) != nil
@@ -133,3 +225,20 @@ func IsPrivateIP(ip string) bool {
 
 	return false
 }
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598).
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isReservedIP reports whether ip cannot be geolocated: it is private (see
+// IsPrivateIP), link-local, unspecified or carrier-grade NAT. IPv4-mapped
+// IPv6 addresses are checked as IPv4.
+func isReservedIP(ip string) bool {
+	if IsPrivateIP(ip) {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return parsed.IsLinkLocalUnicast() || parsed.IsUnspecified() || sharedAddressSpace.Contains(parsed)
+}
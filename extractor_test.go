@@ -0,0 +1,207 @@
+package heimdall
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExtractIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		remoteAddr string
+		want       string
+	}{
+		{
+			name:       "remote addr with port",
+			remoteAddr: "203.0.113.7:4242",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "remote addr without port",
+			remoteAddr: "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "forwarded for takes first entry",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.1"},
+			remoteAddr: "10.0.0.2:80",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "invalid forwarded for falls back to real ip",
+			headers:    map[string]string{"X-Forwarded-For": "garbage", "X-Real-IP": "198.51.100.2"},
+			remoteAddr: "10.0.0.2:80",
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "control characters are rejected",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1\x00"},
+			remoteAddr: "10.0.0.2:80",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "overlong forwarded for chain is ignored",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1" + strings.Repeat(",10.0.0.1", maxForwardedForEntries)},
+			remoteAddr: "10.0.0.2:80",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "forwarded for at the cap is accepted",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1" + strings.Repeat(",10.0.0.1", maxForwardedForEntries-1)},
+			remoteAddr: "10.0.0.2:80",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "non-IP host in remote addr returns raw value",
+			remoteAddr: "example.com:80",
+			want:       "example.com:80",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}, RemoteAddr: tt.remoteAddr}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if got := extractIP(r); got != tt.want {
+				t.Errorf("extractIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractDeviceInfoEmptyUserAgent(t *testing.T) {
+	for _, ua := range []string{"", "   \t"} {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: "203.0.113.7:4242"}
+		if ua != "" {
+			r.Header.Set("User-Agent", ua)
+		}
+
+		device := ExtractDeviceInfo(r)
+		if device.DeviceType != "unknown" {
+			t.Errorf("UA %q: expected DeviceType unknown, got %q", ua, device.DeviceType)
+		}
+		if device.Browser != "Unknown" {
+			t.Errorf("UA %q: expected Browser Unknown, got %q", ua, device.Browser)
+		}
+		if device.OS != "" {
+			t.Errorf("UA %q: expected empty OS, got %q", ua, device.OS)
+		}
+		if device.IP != "203.0.113.7" {
+			t.Errorf("UA %q: expected IP 203.0.113.7, got %q", ua, device.IP)
+		}
+	}
+}
+
+func TestDeviceClassifier(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		DeviceClassifier: func(userAgent string, defaultType DeviceType) DeviceType {
+			if strings.Contains(userAgent, "SMART-TV") {
+				return DeviceTV
+			}
+			return defaultType
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	tests := []struct {
+		ua   string
+		want DeviceType
+	}{
+		{"Mozilla/5.0 (SMART-TV; Linux; Tizen 6.0) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/4.0 Chrome/76.0 TV Safari/537.36", DeviceTV},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", DeviceDesktop},
+	}
+
+	for _, tt := range tests {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: "203.0.113.7:4242"}
+		r.Header.Set("User-Agent", tt.ua)
+
+		device, _, err := h.ExtractRequestInfo(r)
+		if err != nil {
+			t.Fatalf("ExtractRequestInfo failed: %v", err)
+		}
+		if device.DeviceType != tt.want {
+			t.Errorf("UA %q: expected DeviceType %q, got %q", tt.ua, tt.want, device.DeviceType)
+		}
+	}
+}
+
+// cannedUAParser is a UAParser returning fixed values.
+type cannedUAParser struct {
+	deviceType string
+	mobile     bool
+}
+
+func (p cannedUAParser) Parse(ua string) (browser, os, deviceType string, mobile, bot bool) {
+	return "Canned Browser 1.0", "Canned OS 2.0", p.deviceType, p.mobile, false
+}
+
+func TestUAParser(t *testing.T) {
+	r := &http.Request{Header: http.Header{}, RemoteAddr: "203.0.113.7:4242"}
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+
+	tests := []struct {
+		parser cannedUAParser
+		want   DeviceType
+	}{
+		{cannedUAParser{deviceType: "tv"}, DeviceTV},
+		{cannedUAParser{deviceType: "fridge"}, DeviceUnknown},
+		{cannedUAParser{mobile: true}, DeviceMobile},
+		{cannedUAParser{}, DeviceDesktop},
+	}
+
+	for _, tt := range tests {
+		device := ExtractDeviceInfoWithParser(r, tt.parser)
+		if device.Browser != "Canned Browser 1.0" || device.OS != "Canned OS 2.0" {
+			t.Errorf("expected canned browser and OS, got %q / %q", device.Browser, device.OS)
+		}
+		if device.DeviceType != tt.want {
+			t.Errorf("parser %+v: expected DeviceType %q, got %q", tt.parser, tt.want, device.DeviceType)
+		}
+	}
+
+	h, err := newTestHeimdallWithConfig(Config{UAParser: cannedUAParser{deviceType: "console"}})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device, _, err := h.ExtractRequestInfo(r)
+	if err != nil {
+		t.Fatalf("ExtractRequestInfo failed: %v", err)
+	}
+	if device.Browser != "Canned Browser 1.0" || device.DeviceType != DeviceConsole {
+		t.Errorf("expected Config.UAParser to be used, got %q / %q", device.Browser, device.DeviceType)
+	}
+
+	// The default parser still classifies as before
+	if got := ExtractDeviceInfo(r); got.DeviceType != DeviceDesktop || !strings.HasPrefix(got.Browser, "Chrome") {
+		t.Errorf("expected default parser to report Chrome on desktop, got %q / %q", got.Browser, got.DeviceType)
+	}
+}
+
+func FuzzExtractIP(f *testing.F) {
+	f.Add("198.51.100.1, 10.0.0.1", "198.51.100.2", "198.51.100.3", "10.0.0.2:80")
+	f.Add("", "", "", "[::1]:443")
+	f.Add("\x00,,,", "not-an-ip", " 2001:db8::1 ", "")
+	f.Add(strings.Repeat("1.1.1.1,", 100), "", "", "garbage")
+
+	f.Fuzz(func(t *testing.T, xff, xri, cfip, remoteAddr string) {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: remoteAddr}
+		r.Header["X-Forwarded-For"] = []string{xff}
+		r.Header["X-Real-Ip"] = []string{xri}
+		r.Header["Cf-Connecting-Ip"] = []string{cfip}
+
+		got := extractIP(r)
+		if got != remoteAddr && !isValidIP(got) {
+			t.Errorf("extractIP() = %q, want a valid IP or the raw RemoteAddr %q", got, remoteAddr)
+		}
+	})
+}
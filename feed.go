@@ -0,0 +1,44 @@
+package heimdall
+
+import (
+	"fmt"
+	"time"
+)
+
+// ImportInvalidations invalidates sessions revoked by another system, e.g. a
+// central auth server, so Heimdall enforces them locally. Each ID is handled
+// like InvalidateSession, but remembered for ttl; zero means
+// Config.InvalidationTTL. IDs of sessions Heimdall does not know are still
+// marked invalidated. All IDs are attempted even if some fail.
+func (h *Heimdall) ImportInvalidations(ids []string, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = h.config.InvalidationTTL
+	}
+
+	failed := 0
+	var firstErr error
+	for _, id := range ids {
+		if err := h.invalidateStoredFor(h.storageID(id), ttl); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("heimdall: failed to import %d of %d invalidations: %w", failed, len(ids), firstErr)
+	}
+	return nil
+}
+
+// SubscribeInvalidations imports every session ID received on ch as with
+// ImportInvalidations and Config.InvalidationTTL, until ch is closed. It
+// blocks, so run it in its own goroutine, and close ch before calling Close.
+// IDs that fail to import are skipped; use ImportInvalidations to handle
+// errors.
+func (h *Heimdall) SubscribeInvalidations(ch <-chan string) {
+	for id := range ch {
+		h.invalidateStored(h.storageID(id))
+	}
+}
@@ -0,0 +1,87 @@
+package heimdall
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+func TestImportInvalidations(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{InvalidationCache: store.NewMemoryCache()})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	for _, sessionID := range []string{"session1", "session2"} {
+		if _, err := h.RegisterSession("user123", sessionID, device, LocationInfo{IP: "8.8.8.8"}, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	// remote1 was issued by another service and is unknown here
+	ids := []string{"session1", "remote1"}
+	if err := h.ImportInvalidations(ids, time.Hour); err != nil {
+		t.Fatalf("ImportInvalidations failed: %v", err)
+	}
+
+	for _, id := range ids {
+		invalidated, err := h.IsSessionInvalidated(id)
+		if err != nil {
+			t.Fatalf("Failed to check invalidation: %v", err)
+		}
+		if !invalidated {
+			t.Errorf("Expected %s to be invalidated", id)
+		}
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "session2" {
+		t.Errorf("Expected [session2], got %v", sessions)
+	}
+}
+
+func TestImportInvalidationsCacheFailure(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		InvalidationCache: failingCache{store.NewMemoryCache()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if err := h.ImportInvalidations([]string{"remote1", "remote2"}, 0); err == nil {
+		t.Error("Expected an error when the cache is unavailable")
+	}
+}
+
+func TestSubscribeInvalidations(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{InvalidationCache: store.NewMemoryCache()})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	ch := make(chan string, 3)
+	ids := []string{"remote1", "remote2", "remote3"}
+	for _, id := range ids {
+		ch <- id
+	}
+	close(ch)
+
+	// Returns once ch is drained and closed
+	h.SubscribeInvalidations(ch)
+
+	exists, err := h.FilterInvalidated(append(ids, "remote4"))
+	if err != nil {
+		t.Fatalf("Failed to check invalidations: %v", err)
+	}
+	if len(exists) != len(ids) {
+		t.Errorf("Expected %v to be invalidated, got %v", ids, exists)
+	}
+}
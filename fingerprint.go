@@ -0,0 +1,62 @@
+package heimdall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// DeviceFingerprinter derives a fingerprint identifying a device, in the
+// versioned form built by FormatFingerprint. Give a new algorithm a new
+// version, so fingerprints stored by the old one are not compared against it.
+type DeviceFingerprinter func(device DeviceInfo) string
+
+// FormatFingerprint returns a fingerprint tagged with the algorithm version
+// that produced it, e.g. "v1:9f86d0...".
+func FormatFingerprint(version, digest string) string {
+	return version + ":" + digest
+}
+
+// ParseFingerprint splits a fingerprint built by FormatFingerprint into its
+// version and digest. ok is false if either is missing.
+func ParseFingerprint(fingerprint string) (version, digest string, ok bool) {
+	version, digest, found := strings.Cut(fingerprint, ":")
+	if !found || version == "" || digest == "" {
+		return "", "", false
+	}
+	return version, digest, true
+}
+
+// DefaultDeviceFingerprint is version "v1": the hex-encoded SHA-256 of the
+// User-Agent. Devices without a User-Agent have no fingerprint.
+func DefaultDeviceFingerprint(device DeviceInfo) string {
+	if device.UserAgent == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(device.UserAgent))
+	return FormatFingerprint("v1", hex.EncodeToString(sum[:]))
+}
+
+// fingerprintMatch is the result of comparing two fingerprints.
+type fingerprintMatch int
+
+const (
+	// fingerprintUnknown means the fingerprints cannot be compared, because
+	// they are malformed or produced by different algorithm versions.
+	fingerprintUnknown fingerprintMatch = iota
+	fingerprintSame
+	fingerprintDifferent
+)
+
+// compareFingerprints compares two fingerprints of the same version.
+func compareFingerprints(a, b string) fingerprintMatch {
+	versionA, digestA, okA := ParseFingerprint(a)
+	versionB, digestB, okB := ParseFingerprint(b)
+	if !okA || !okB || versionA != versionB {
+		return fingerprintUnknown
+	}
+	if digestA == digestB {
+		return fingerprintSame
+	}
+	return fingerprintDifferent
+}
@@ -0,0 +1,183 @@
+package heimdall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// v2Fingerprint is a stand-in for a changed fingerprint algorithm.
+func v2Fingerprint(device DeviceInfo) string {
+	sum := sha256.Sum256([]byte(device.UserAgent + "|" + device.OS))
+	return FormatFingerprint("v2", hex.EncodeToString(sum[:]))
+}
+
+func TestParseFingerprint(t *testing.T) {
+	tests := []struct {
+		in      string
+		version string
+		digest  string
+		ok      bool
+	}{
+		{"v1:abc", "v1", "abc", true},
+		{"v2:a:b", "v2", "a:b", true},
+		{"abc", "", "", false},
+		{":abc", "", "", false},
+		{"v1:", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		version, digest, ok := ParseFingerprint(tt.in)
+		if version != tt.version || digest != tt.digest || ok != tt.ok {
+			t.Errorf("ParseFingerprint(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.in, version, digest, ok, tt.version, tt.digest, tt.ok)
+		}
+	}
+}
+
+func TestIsNewDeviceFingerprintVersions(t *testing.T) {
+	phone := DeviceInfo{UserAgent: "Phone/1.0", OS: "iOS 17"}
+	laptop := DeviceInfo{UserAgent: "Laptop/1.0", OS: "Windows 11"}
+
+	withFingerprint := func(device DeviceInfo, fingerprinter DeviceFingerprinter) DeviceInfo {
+		device.Fingerprint = fingerprinter(device)
+		return device
+	}
+	sessionsOf := func(devices ...DeviceInfo) []*Session {
+		sessions := make([]*Session, len(devices))
+		for i, d := range devices {
+			sessions[i] = &Session{Device: d}
+		}
+		return sessions
+	}
+
+	tests := []struct {
+		name     string
+		sessions []*Session
+		device   DeviceInfo
+		want     bool
+	}{
+		{"same device, same version", sessionsOf(withFingerprint(phone, DefaultDeviceFingerprint)), withFingerprint(phone, DefaultDeviceFingerprint), false},
+		{"other device, same version", sessionsOf(withFingerprint(phone, DefaultDeviceFingerprint)), withFingerprint(laptop, DefaultDeviceFingerprint), true},
+		{"other device, only older versions", sessionsOf(withFingerprint(phone, DefaultDeviceFingerprint)), withFingerprint(laptop, v2Fingerprint), false},
+		{"same device among mixed versions", sessionsOf(withFingerprint(laptop, DefaultDeviceFingerprint), withFingerprint(phone, v2Fingerprint)), withFingerprint(phone, v2Fingerprint), false},
+		{"other device among mixed versions", sessionsOf(withFingerprint(laptop, DefaultDeviceFingerprint), withFingerprint(phone, v2Fingerprint)), withFingerprint(laptop, v2Fingerprint), true},
+		{"session without fingerprint", sessionsOf(phone), withFingerprint(phone, v2Fingerprint), false},
+		{"malformed fingerprint", sessionsOf(DeviceInfo{UserAgent: "Phone/1.0", Fingerprint: "garbage"}), withFingerprint(laptop, DefaultDeviceFingerprint), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNewDevice(tt.sessions, tt.device); got != tt.want {
+				t.Errorf("isNewDevice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceFingerprintVersionChange(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	location := LocationInfo{IP: "8.8.8.8"}
+	phone := DeviceInfo{IP: "8.8.8.8", UserAgent: "Phone/1.0", OS: "iOS 17"}
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Laptop/1.0", OS: "Windows 11"}
+
+	if _, err := h.RegisterSession("user123", "session1", phone, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	// The algorithm changes: the v1 session can no longer be compared against
+	h.config.DeviceFingerprinter = v2Fingerprint
+
+	result, err := h.RegisterSession("user123", "session2", laptop, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.IsNewDevice {
+		t.Error("Expected a device compared only against older fingerprints not to be new")
+	}
+	if version, _, _ := ParseFingerprint(result.Session.Device.Fingerprint); version != "v2" {
+		t.Errorf("Expected a v2 fingerprint, got %q", result.Session.Device.Fingerprint)
+	}
+
+	tablet := DeviceInfo{IP: "8.8.8.8", UserAgent: "Tablet/1.0", OS: "Android 14"}
+	result, err = h.RegisterSession("user123", "session3", tablet, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !result.IsNewDevice {
+		t.Error("Expected a device unlike the v2 session to be new")
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	versions := map[string]int{}
+	for _, s := range sessions {
+		version, _, _ := ParseFingerprint(s.Device.Fingerprint)
+		versions[version]++
+	}
+	if versions["v1"] != 1 || versions["v2"] != 2 {
+		t.Errorf("Expected 1 v1 and 2 v2 stored fingerprints, got %v", versions)
+	}
+}
+
+func TestDeviceFeaturesUseFingerprints(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{DeviceFingerprinter: v2Fingerprint, OneSessionPerDevice: true})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	// The same browser on two machines, told apart by the fingerprinter
+	location := LocationInfo{IP: "8.8.8.8"}
+	work := DeviceInfo{IP: "8.8.8.8", UserAgent: "Browser/1.0", OS: "Windows 11"}
+	home := DeviceInfo{IP: "8.8.8.8", UserAgent: "Browser/1.0", OS: "Ubuntu 24.04"}
+
+	if _, err := h.RegisterSession("user123", "session1", work, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	result, err := h.RegisterSession("user123", "session2", home, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if len(result.ReplacedSessions) != 0 {
+		t.Errorf("Expected another machine not to replace the session, replaced %d", len(result.ReplacedSessions))
+	}
+	if !result.IsNewDevice || result.Score == nil || !result.Score.NewDevice {
+		t.Errorf("Expected another machine to be a new device, got IsNewDevice %v, score %+v", result.IsNewDevice, result.Score)
+	}
+
+	result, err = h.RegisterSession("user123", "session3", work, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if len(result.ReplacedSessions) != 1 || result.ReplacedSessions[0].SessionID != "session1" {
+		t.Errorf("Expected the same machine to replace session1, got %+v", result.ReplacedSessions)
+	}
+
+	devices, err := h.ListDevices("user123")
+	if err != nil {
+		t.Fatalf("ListDevices failed: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 devices, got %d", len(devices))
+	}
+
+	count, err := h.InvalidateByFingerprint("user123", v2Fingerprint(home))
+	if err != nil {
+		t.Fatalf("InvalidateByFingerprint failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 session invalidated, got %d", count)
+	}
+	if invalidated, _ := h.IsSessionInvalidated("session3"); invalidated {
+		t.Error("Expected the other machine's session to stay active")
+	}
+}
@@ -0,0 +1,57 @@
+package heimdall
+
+import "strings"
+
+// geohashAlphabet is the base32 alphabet used by geohashes.
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// maxGeohashPrecision is the longest geohash computed, about 3.7 cm wide.
+const maxGeohashPrecision = 12
+
+// Geohash encodes coordinates as a geohash of precision characters, clamped
+// to 1 through 12. Each character narrows the cell: 5 characters are about
+// 5 km wide, 7 about 150 m.
+func Geohash(lat, lng float64, precision int) string {
+	precision = max(1, min(precision, maxGeohashPrecision))
+
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	bits, ch := 0, 0
+	even := true // Bits alternate between longitude and latitude, starting with longitude
+	for hash.Len() < precision {
+		value, r := lat, &latRange
+		if even {
+			value, r = lng, &lngRange
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if value >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+
+		if bits++; bits == 5 {
+			hash.WriteByte(geohashAlphabet[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// SameArea reports whether a and b are in the same geohash cell, at the
+// precision of the shorter of their geohashes. It is a cheap alternative to
+// IsNewLocation for grouping, but coarse: points just either side of a cell
+// boundary are never in the same area, however close. Locations without a
+// geohash are never in the same area.
+func SameArea(a, b LocationInfo) bool {
+	if a.Geohash == "" || b.Geohash == "" {
+		return false
+	}
+	n := min(len(a.Geohash), len(b.Geohash))
+	return a.Geohash[:n] == b.Geohash[:n]
+}
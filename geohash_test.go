@@ -0,0 +1,89 @@
+package heimdall
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		{42.6, -5.6, 5, "ezs42"},
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{37.3861, -122.0839, 5, "9q9ht"},
+		{0, 0, 0, "s"},
+		{51.5074, -0.1278, 20, "gcpvj0duq533"},
+	}
+
+	for _, tt := range tests {
+		if got := Geohash(tt.lat, tt.lng, tt.precision); got != tt.want {
+			t.Errorf("Geohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lng, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestSameArea(t *testing.T) {
+	location := func(lat, lng float64, precision int) LocationInfo {
+		return LocationInfo{Latitude: lat, Longitude: lng, Geohash: Geohash(lat, lng, precision)}
+	}
+
+	tests := []struct {
+		name string
+		a, b LocationInfo
+		want bool
+	}{
+		{"same street in London", location(51.5074, -0.1278, 5), location(51.5080, -0.1281, 5), true},
+		{"London and Paris", location(51.5074, -0.1278, 5), location(48.8566, 2.3522, 5), false},
+		{"New York and Tokyo", location(40.7128, -74.0060, 5), location(35.6762, 139.6503, 5), false},
+		{"compared at the shorter precision", location(51.5074, -0.1278, 7), location(51.5080, -0.1281, 4), true},
+		{"missing geohash", LocationInfo{City: "London"}, location(51.5074, -0.1278, 5), false},
+	}
+
+	for _, tt := range tests {
+		if got := SameArea(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: SameArea(%q, %q) = %v, want %v", tt.name, tt.a.Geohash, tt.b.Geohash, got, tt.want)
+		}
+	}
+}
+
+func TestExtractRequestInfoGeohash(t *testing.T) {
+	geoDB := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+
+	h, err := newTestHeimdallWithConfig(Config{GeoIPDatabasePath: geoDB, GeohashPrecision: 6})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	r := &http.Request{Header: http.Header{}, RemoteAddr: "81.2.69.160:443"}
+	device, location, err := h.ExtractRequestInfo(r)
+	if err != nil {
+		t.Fatalf("ExtractRequestInfo failed: %v", err)
+	}
+	if want := Geohash(51.5142, -0.0931, 6); location.Geohash != want {
+		t.Errorf("Expected geohash %q, got %q", want, location.Geohash)
+	}
+
+	// The geohash is persisted with the session
+	if _, err := h.RegisterSession("user123", "session1", device, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Location.Geohash != location.Geohash {
+		t.Errorf("Expected the stored session to have geohash %q, got %v", location.Geohash, sessions)
+	}
+
+	// Unlocated IPs get no geohash
+	r.RemoteAddr = "8.8.8.8:443"
+	if _, location, _ = h.ExtractRequestInfo(r); location.Geohash != "" {
+		t.Errorf("Expected no geohash for an unlocated IP, got %q", location.Geohash)
+	}
+}
@@ -1,8 +1,11 @@
 package heimdall
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
+	"strings"
 
 	"github.com/oschwald/geoip2-golang"
 )
@@ -14,6 +17,8 @@ type GeoIPReader struct {
 }
 
 // NewGeoIPReader opens a MaxMind GeoLite2-City database.
+// A file that is not a MaxMind database, or is an edition without city or
+// country data (e.g. ASN), is rejected with ErrGeoIPDatabaseInvalid.
 func NewGeoIPReader(dbPath string) (*GeoIPReader, error) {
 	if dbPath == "" {
 		return nil, ErrGeoIPDatabaseNotConfigured
@@ -21,7 +26,16 @@ func NewGeoIPReader(dbPath string) (*GeoIPReader, error) {
 
 	db, err := geoip2.Open(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("geoip: failed to open database: %w", err)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("geoip: failed to open database: %w", err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrGeoIPDatabaseInvalid, err)
+	}
+
+	dbType := db.Metadata().DatabaseType
+	if !strings.Contains(dbType, "City") && !strings.Contains(dbType, "Country") && !strings.Contains(dbType, "Enterprise") {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s has no city or country data", ErrGeoIPDatabaseInvalid, dbType)
 	}
 
 	return &GeoIPReader{
@@ -69,11 +83,13 @@ func (r *GeoIPReader) Lookup(ip string) (*LocationInfo, error) {
 	}
 
 	return &LocationInfo{
-		IP:        ip,
-		City:      city,
-		Country:   country,
-		Latitude:  record.Location.Latitude,
-		Longitude: record.Location.Longitude,
+		IP:          ip,
+		City:        city,
+		Country:     country,
+		CountryCode: record.Country.IsoCode,
+		Latitude:    record.Location.Latitude,
+		Longitude:   record.Location.Longitude,
+		IsEU:        record.Country.IsInEuropeanUnion,
 	}, nil
 }
 
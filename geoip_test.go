@@ -0,0 +1,289 @@
+package heimdall
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestGeoIPLookup(t *testing.T) {
+	path := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+
+	reader, err := NewGeoIPReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open GeoIP database: %v", err)
+	}
+	defer reader.Close()
+
+	loc, err := reader.Lookup("81.2.69.160")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if loc.City != "London" || loc.Country != "United Kingdom" || loc.CountryCode != "GB" {
+		t.Errorf("Unexpected location: %+v", loc)
+	}
+	if loc.Latitude != 51.5142 || loc.Longitude != -0.0931 {
+		t.Errorf("Unexpected coordinates: (%v, %v)", loc.Latitude, loc.Longitude)
+	}
+
+	if loc.IsEU {
+		t.Error("Expected United Kingdom not to be in the EU")
+	}
+
+	// Addresses outside any network resolve to an empty record
+	loc, err = reader.Lookup("8.8.8.8")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if loc.City != "" || loc.Country != "" {
+		t.Errorf("Expected empty location, got %+v", loc)
+	}
+}
+
+func TestGeoIPLookupIsEU(t *testing.T) {
+	berlin := cityRecord("Berlin", "Germany", "DE", 52.52, 13.405)
+	berlin["country"].(map[string]any)["is_in_european_union"] = true
+
+	path := writeTestGeoIPDB(t, map[string]map[string]any{
+		"5.9.0.0/16":   berlin,
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+
+	reader, err := NewGeoIPReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open GeoIP database: %v", err)
+	}
+	defer reader.Close()
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"5.9.1.1", true},
+		{"81.2.69.160", false},
+	}
+
+	for _, tt := range tests {
+		loc, err := reader.Lookup(tt.ip)
+		if err != nil {
+			t.Fatalf("Lookup(%q) failed: %v", tt.ip, err)
+		}
+		if loc.IsEU != tt.want {
+			t.Errorf("Lookup(%q).IsEU = %v, want %v", tt.ip, loc.IsEU, tt.want)
+		}
+	}
+}
+
+func TestNewGeoIPReaderInvalidDatabase(t *testing.T) {
+	notMMDB := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	if err := os.WriteFile(notMMDB, []byte("<html>404 Not Found</html>"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"not a MaxMind database", notMMDB},
+		{"ASN edition", writeTestGeoIPDBOfType(t, "GeoLite2-ASN", map[string]map[string]any{
+			"81.2.69.0/24": {"autonomous_system_number": uint32(20712)},
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewGeoIPReader(tt.path)
+			if !errors.Is(err, ErrGeoIPDatabaseInvalid) {
+				t.Errorf("Expected ErrGeoIPDatabaseInvalid, got %v", err)
+			}
+			if reader != nil {
+				reader.Close()
+			}
+		})
+	}
+
+	// A missing file is not reported as invalid
+	if _, err := NewGeoIPReader(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil || errors.Is(err, ErrGeoIPDatabaseInvalid) {
+		t.Errorf("Expected a plain open error for a missing file, got %v", err)
+	}
+}
+
+// cityRecord returns a GeoLite2-City style record for writeTestGeoIPDB.
+func cityRecord(city, country, countryCode string, lat, lng float64) map[string]any {
+	return map[string]any{
+		"city": map[string]any{
+			"names": map[string]any{"en": city},
+		},
+		"country": map[string]any{
+			"iso_code": countryCode,
+			"names":    map[string]any{"en": country},
+		},
+		"location": map[string]any{
+			"latitude":  lat,
+			"longitude": lng,
+		},
+	}
+}
+
+// writeTestGeoIPDB writes a minimal IPv4 GeoLite2-City database mapping each
+// CIDR to its record and returns its path. Records may contain strings,
+// float64, bool, uint16, uint32 and nested map[string]any values.
+func writeTestGeoIPDB(t *testing.T, networks map[string]map[string]any) string {
+	t.Helper()
+	return writeTestGeoIPDBOfType(t, "GeoLite2-City", networks)
+}
+
+// writeTestGeoIPDBOfType is like writeTestGeoIPDB with the given database_type.
+func writeTestGeoIPDBOfType(t *testing.T, dbType string, networks map[string]map[string]any) string {
+	t.Helper()
+
+	// Data section: one encoded record per network
+	var data bytes.Buffer
+	type leaf struct {
+		network *net.IPNet
+		offset  int
+	}
+	var leaves []leaf
+
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Invalid CIDR %q: %v", cidr, err)
+		}
+		leaves = append(leaves, leaf{network: network, offset: data.Len()})
+		mmdbEncode(t, &data, networks[cidr])
+	}
+
+	// Search tree: records are node indexes, -1 for "no data",
+	// or -(offset+2) for a pointer into the data section
+	nodes := [][2]int{{-1, -1}}
+	for _, l := range leaves {
+		ones, _ := l.network.Mask.Size()
+		ip := l.network.IP.To4()
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = -(l.offset + 2)
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	nodeCount := len(nodes)
+	var file bytes.Buffer
+	for _, node := range nodes {
+		for _, record := range node {
+			value := record
+			switch {
+			case record == -1:
+				value = nodeCount
+			case record < -1:
+				value = nodeCount + 16 + (-record - 2)
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+
+	file.WriteString("\xAB\xCD\xEFMaxMind.com")
+	mmdbEncode(t, &file, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint32(0),
+		"database_type":               dbType,
+		"description":                 map[string]any{"en": "Heimdall test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []string{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write GeoIP database: %v", err)
+	}
+	return path
+}
+
+// mmdbEncode appends a value in the MaxMind DB data format.
+func mmdbEncode(t *testing.T, buf *bytes.Buffer, value any) {
+	t.Helper()
+
+	switch v := value.(type) {
+	case string:
+		mmdbControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		mmdbControl(buf, 3, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		mmdbControl(buf, 5, 2)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		mmdbControl(buf, 6, 4)
+		binary.Write(buf, binary.BigEndian, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		mmdbControl(buf, 14, size)
+	case []string:
+		mmdbControl(buf, 11, len(v))
+		for _, s := range v {
+			mmdbEncode(t, buf, s)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		mmdbControl(buf, 7, len(v))
+		for _, k := range keys {
+			mmdbEncode(t, buf, k)
+			mmdbEncode(t, buf, v[k])
+		}
+	default:
+		t.Fatalf("mmdbEncode: unsupported type %T", value)
+	}
+}
+
+// mmdbControl writes a control byte for the given type and payload size.
+// Sizes up to 284 bytes are supported.
+func mmdbControl(buf *bytes.Buffer, typeNum, size int) {
+	sizeBits, extra := size, []byte(nil)
+	if size >= 29 {
+		sizeBits, extra = 29, []byte{byte(size - 29)}
+	}
+
+	if typeNum > 7 {
+		buf.WriteByte(byte(sizeBits))
+		buf.WriteByte(byte(typeNum - 7))
+	} else {
+		buf.WriteByte(byte(typeNum<<5 | sizeBits))
+	}
+	buf.Write(extra)
+}
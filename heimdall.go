@@ -1,8 +1,16 @@
 package heimdall
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aadithya-v/heimdall/store"
@@ -14,6 +22,21 @@ type Heimdall struct {
 	sessions    store.SessionStore
 	invalidated store.InvalidationCache
 	geoip       *GeoIPReader
+	asn         *ASNReader
+
+	trustedProxies   []*net.IPNet
+	blockedCountries map[string]bool
+	allowedCountries map[string]bool
+	cloudRanges      atomic.Pointer[[]*net.IPNet]
+
+	started       time.Time
+	expiryMu      sync.Mutex
+	expiryChecked map[string]time.Time // last expiry check per user, for OnExpire
+	expirySwept   time.Time
+
+	idempotencyMu    sync.Mutex
+	idempotency      map[string]*idempotentResult // by user ID and idempotency key
+	idempotencySwept time.Time
 }
 
 // New creates a new Heimdall instance with the given configuration.
@@ -24,8 +47,25 @@ func New(cfg Config) (*Heimdall, error) {
 	cfg.applyDefaults()
 
 	h := &Heimdall{
-		config: cfg,
+		config:        cfg,
+		started:       time.Now(),
+		expiryChecked: make(map[string]time.Time),
+		idempotency:   make(map[string]*idempotentResult),
+	}
+
+	for _, proxy := range cfg.TrustedProxies {
+		network, err := parseNetwork(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("heimdall: invalid trusted proxy %q: %w", proxy, err)
+		}
+		h.trustedProxies = append(h.trustedProxies, network)
+	}
+
+	if len(cfg.BlockedCountries) > 0 && len(cfg.AllowedCountries) > 0 {
+		return nil, errors.New("heimdall: BlockedCountries and AllowedCountries are mutually exclusive")
 	}
+	h.blockedCountries = countrySet(cfg.BlockedCountries)
+	h.allowedCountries = countrySet(cfg.AllowedCountries)
 
 	// Initialize session store (default: SQLite)
 	if cfg.SessionStore != nil {
@@ -39,6 +79,10 @@ func New(cfg Config) (*Heimdall, error) {
 		h.invalidated = sqliteStore
 	}
 
+	if cfg.FieldCipher != nil {
+		h.sessions = store.NewEncryptedStore(h.sessions, cfg.FieldCipher)
+	}
+
 	// Initialize invalidation cache (default: SQLite using sessions table)
 	if cfg.InvalidationCache != nil {
 		h.invalidated = cfg.InvalidationCache
@@ -52,6 +96,14 @@ func New(cfg Config) (*Heimdall, error) {
 		}
 		h.geoip = geoip
 	}
+	if cfg.ASNDatabasePath != "" {
+		asn, err := NewASNReader(cfg.ASNDatabasePath)
+		if err != nil {
+			h.geoip.Close()
+			return nil, fmt.Errorf("heimdall: failed to initialize ASN lookup: %w", err)
+		}
+		h.asn = asn
+	}
 
 	if cfg.NewLocationThresholdKM <= 0 {
 		h.config.NewLocationThresholdKM = 100
@@ -83,35 +135,125 @@ func (h *Heimdall) Close() error {
 		}
 	}
 
+	if h.asn != nil {
+		if err := h.asn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) > 0 {
 		return fmt.Errorf("heimdall: errors during close: %v", errs)
 	}
 	return nil
 }
 
+// CloseWithTimeout is like Close but gives up waiting after timeout, e.g. to
+// bound shutdown while backends finish in-flight work such as a cleanup pass.
+// On timeout it returns ErrCloseTimeout; closing then continues in the
+// background.
+func (h *Heimdall) CloseWithTimeout(timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() { done <- h.Close() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w after %v", ErrCloseTimeout, timeout)
+	}
+}
+
 // ExtractRequestInfo extracts device and location information from an HTTP request.
 // If GeoIP is not configured, location will contain only the IP address.
+// The User-Agent is parsed with Config.UAParser, and the device type is
+// passed through Config.DeviceClassifier if set.
+// Private and reserved IPs get Config.DefaultLocation if set.
+// IsCloudProvider is set if the IP is in a range loaded with LoadCloudRanges.
+// ASN is set if Config.ASNDatabasePath is.
+// The IP is also not geolocated if it came from a proxy header that is not
+// trusted for geolocation (see TrustedProxies and MaxForwardedHopsForGeo).
+// If no valid client IP can be determined, ErrMissingClientIP is returned
+// when RequireClientIP is set; otherwise the request is not geolocated.
 func (h *Heimdall) ExtractRequestInfo(r *http.Request) (DeviceInfo, LocationInfo, error) {
-	device := ExtractDeviceInfo(r)
+	device := ExtractDeviceInfoWithParser(r, h.config.UAParser)
+	validIP := isValidIP(device.IP)
+	if !validIP && h.config.RequireClientIP {
+		return DeviceInfo{}, LocationInfo{}, ErrMissingClientIP
+	}
+	if h.config.DeviceClassifier != nil {
+		device.DeviceType = h.config.DeviceClassifier(device.UserAgent, device.DeviceType)
+	}
 
-	if h.geoip != nil {
-		loc, err := h.geoip.Lookup(device.IP)
-		if err != nil {
-			// Return device info with partial location (IP only)
-			return device, LocationInfo{IP: device.IP}, nil
+	// GeoIP not configured or lookup failed: location has the IP only
+	location := LocationInfo{IP: device.IP}
+	if validIP && h.trustedForGeo(r, device.IP) {
+		if h.config.DefaultLocation != nil && isReservedIP(device.IP) {
+			location = *h.config.DefaultLocation
+			location.IP = device.IP
+		} else if h.geoip != nil {
+			if loc, err := h.geoip.Lookup(device.IP); err == nil {
+				location = *loc
+			} else {
+				h.config.Logger.Warn("heimdall: GeoIP lookup failed", "ip", device.IP, "error", err)
+			}
+		}
+		if h.asn != nil {
+			if asn, err := h.asn.Lookup(device.IP); err == nil {
+				location.ASN = asn
+			} else {
+				h.config.Logger.Warn("heimdall: ASN lookup failed", "ip", device.IP, "error", err)
+			}
 		}
-		return device, *loc, nil
 	}
+	if hasCoordinates(location) {
+		location.Geohash = Geohash(location.Latitude, location.Longitude, h.config.GeohashPrecision)
+	}
+	location.IsCloudProvider = h.isCloudIP(device.IP)
 
-	// GeoIP not configured, return IP only
-	return device, LocationInfo{IP: device.IP}, nil
+	return device, location, nil
+}
+
+// trustedForGeo reports whether the client IP extracted from r may be used
+// for geolocation. IPs taken from the connection itself are always trusted;
+// IPs taken from proxy headers must pass the TrustedProxies and
+// MaxForwardedHopsForGeo checks.
+func (h *Heimdall) trustedForGeo(r *http.Request, clientIP string) bool {
+	remote := remoteIP(r)
+	if clientIP == remote {
+		return true
+	}
+
+	if len(h.trustedProxies) > 0 {
+		parsed := net.ParseIP(remote)
+		trusted := false
+		for _, network := range h.trustedProxies {
+			if parsed != nil && network.Contains(parsed) {
+				trusted = true
+				break
+			}
+		}
+		if !trusted {
+			return false
+		}
+	}
+
+	if max := h.config.MaxForwardedHopsForGeo; max > 0 && forwardedHops(r) > max {
+		return false
+	}
+
+	return true
 }
 
 // RegisterSession registers a new session for the user.
 //
-// concurrentLimit 0 means no limit.
-// Otherwise, if the number of active sessions equals or exceeds concurrentLimit,
-// the new session is NOT saved and LimitExceeded is set to true.
+// concurrentLimit 0 means no limit; negative limits are rejected with
+// ErrInvalidLimit, and limits above Config.MaxSessionsFetched are lowered
+// to it. Otherwise, if the number of active sessions equals or exceeds concurrentLimit,
+// the new session is NOT saved and LimitExceeded is set to true; with
+// Config.LimitExceededAsError, ErrSessionLimitExceeded is returned as well.
 // The caller should then prompt the user to invalidate an existing session.
 //
 // If the user is logging in from a new location (distance > NewLocationThresholdKM),
@@ -122,11 +264,128 @@ func (h *Heimdall) RegisterSession(
 	location LocationInfo,
 	concurrentLimit int,
 ) (*RegisterResult, error) {
+	return h.RegisterSessionWithOptions(userID, sessionID, device, location, concurrentLimit, RegisterOptions{})
+}
+
+// RegisterSessionWithOptions is like RegisterSession but accepts additional options.
+// See RegisterOptions for details.
+func (h *Heimdall) RegisterSessionWithOptions(
+	userID, sessionID string,
+	device DeviceInfo,
+	location LocationInfo,
+	concurrentLimit int,
+	opts RegisterOptions,
+) (*RegisterResult, error) {
+	if opts.IdempotencyKey != "" {
+		return h.registerIdempotent(userID, opts.IdempotencyKey, func() (*RegisterResult, error) {
+			opts.IdempotencyKey = ""
+			return h.RegisterSessionWithOptions(userID, sessionID, device, location, concurrentLimit, opts)
+		})
+	}
+
+	p, err := h.prepareSession(userID, sessionID, device, location, concurrentLimit, opts)
+	if p == nil || p.session == nil {
+		return p.resultOrNil(), err
+	}
+
+	if err := h.replaceSessions(p); err != nil {
+		return nil, err
+	}
+
+	err = h.storeExec("Save", func() error {
+		return h.sessions.Save(p.session)
+	})
+	if err != nil {
+		h.config.Logger.Error("heimdall: failed to save session", "user_id", userID, "error", err)
+		return nil, fmt.Errorf("heimdall: failed to save session: %w", err)
+	}
+
+	h.completeSession(p)
+	return p.result, nil
+}
+
+// pendingSession is a registration checked by prepareSession and not yet
+// saved.
+type pendingSession struct {
+	result   *RegisterResult
+	session  *store.Session // nil if nothing is to be saved
+	replaced []*Session     // sessions to invalidate
+	device   DeviceInfo
+	location LocationInfo
+}
+
+// resultOrNil returns the result of p, or nil if p is nil.
+func (p *pendingSession) resultOrNil() *RegisterResult {
+	if p == nil {
+		return nil
+	}
+	return p.result
+}
+
+// prepareSession performs the checks of RegisterSessionWithOptions without
+// changing any state. If the login is deduplicated or exceeds the limit the
+// returned session is nil and its result final, and the error is
+// ErrSessionLimitExceeded with Config.LimitExceededAsError. Otherwise the
+// caller replaces the sessions in replaced, saves the session and calls
+// completeSession.
+func (h *Heimdall) prepareSession(
+	userID, sessionID string,
+	device DeviceInfo,
+	location LocationInfo,
+	concurrentLimit int,
+	opts RegisterOptions,
+) (*pendingSession, error) {
+	if concurrentLimit < 0 {
+		return nil, ErrInvalidLimit
+	}
+	// Only MaxSessionsFetched sessions are counted, so a higher limit could never be reached
+	concurrentLimit = min(concurrentLimit, h.config.MaxSessionsFetched)
+
+	if h.config.SessionIDValidator != nil && !h.config.SessionIDValidator(sessionID) {
+		return nil, ErrInvalidSessionID
+	}
+	if h.config.RejectEmptyUserAgent && strings.TrimSpace(device.UserAgent) == "" {
+		return nil, ErrMissingUserAgent
+	}
+
+	now := time.Now()
+	createdAt := now
+	if !opts.CreatedAt.IsZero() {
+		if opts.CreatedAt.After(now) {
+			return nil, ErrFutureCreatedAt
+		}
+		createdAt = opts.CreatedAt
+	}
+
+	ttl, err := h.sessionTTL(opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+	ttl = h.jitterTTL(ttl, opts.TTL != 0)
+	storedID := h.storageID(sessionID)
+
+	if h.config.Enricher != nil {
+		ctx := opts.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		h.config.Enricher(ctx, &device, &location)
+	}
+	if device.Fingerprint == "" {
+		device.Fingerprint = h.config.DeviceFingerprinter(device)
+	}
+
+	if h.countryBlocked(location.CountryCode) {
+		h.config.Logger.Info("heimdall: login location blocked", "user_id", userID, "country_code", location.CountryCode)
+		return nil, ErrLocationBlocked
+	}
+
 	result := &RegisterResult{}
 
-	// Get all active sessions for the user
-	activeSessions, err := h.sessions.GetActiveByUser(userID)
+	// Get the user's active sessions, up to the safety cap
+	activeSessions, err := h.fetchActiveSessions(userID)
 	if err != nil {
+		h.config.Logger.Error("heimdall: failed to get active sessions", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("heimdall: failed to get active sessions: %w", err)
 	}
 
@@ -136,49 +395,109 @@ func (h *Heimdall) RegisterSession(
 		result.ActiveSessions[i] = storeToSession(s)
 	}
 
-	// Check for new location
-	if len(activeSessions) > 0 {
-		latestSession := activeSessions[0] // Already sorted by created_at desc
-		prevLocation := LocationInfo{
-			IP:        latestSession.DeviceIP,
-			City:      latestSession.LocCity,
-			Country:   latestSession.LocCountry,
-			Latitude:  latestSession.LocLat,
-			Longitude: latestSession.LocLng,
+	// A retried login gets the session created by the first attempt
+	if dup := h.findDuplicate(result.ActiveSessions, device, createdAt); dup != nil {
+		result.Session = dup
+		result.Deduplicated = true
+		h.capActiveSessions(result)
+		result.Event = newLoginEvent(result)
+		return &pendingSession{result: result}, nil
+	}
+
+	// Report sessions that expired since the user was last seen
+	if h.config.ExpiredSessionsWindow > 0 {
+		if expiredStore, ok := store.Optional[store.ExpiredSessionStore](h.sessions); ok {
+			expired, err := storeCall(h, "GetExpiredByUser", func() ([]*store.Session, error) {
+				return expiredStore.GetExpiredByUser(userID, now.Add(-h.config.ExpiredSessionsWindow))
+			})
+			if err != nil {
+				return nil, fmt.Errorf("heimdall: failed to get expired sessions: %w", err)
+			}
+			for _, s := range expired {
+				result.ExpiredSessions = append(result.ExpiredSessions, storeToSession(s))
+			}
 		}
+	}
 
-		if IsNewLocation(prevLocation, location, h.config.NewLocationThresholdKM) {
+	// Check for new location
+	if prevLocation, isNew := h.detectNewLocation(result.ActiveSessions, location); isNew && !h.inLocationGrace(result.ActiveSessions, createdAt) {
+		learning, err := h.learningLocations(userID, len(activeSessions))
+		if err != nil {
+			return nil, err
+		}
+		if !learning {
 			result.IsNewLocation = true
-			result.PreviousLocation = &prevLocation
+			result.PreviousLocation = prevLocation
 		}
 	}
 
+	result.IsNewDevice = isNewDevice(result.ActiveSessions, device)
+	result.IsNewCountry = isNewCountry(result.ActiveSessions, location)
+	result.IsNewASN = isNewASN(result.ActiveSessions, location)
+	if len(result.ActiveSessions) > 0 {
+		latest := latestSession(result.ActiveSessions)
+		score := ScoreLogin(latest.Location, location, latest.Device, device, createdAt.Sub(latest.CreatedAt), h.config.ScoreWeights)
+		result.Score = &score
+	}
+	result.RequiresStepUp = h.config.StepUpPolicy(result)
+
+	// Sessions on the same device are replaced and don't count towards the limit
+	var replaced, remaining []*Session
+	for _, s := range result.ActiveSessions {
+		if h.config.OneSessionPerDevice && s.SessionID != storedID && sameDevice(s.Device, device) {
+			replaced = append(replaced, s)
+		} else {
+			remaining = append(remaining, s)
+		}
+	}
+
+	groupExceeded, err := h.groupLimitExceeded(opts, replaced)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check concurrent session limit
-	if concurrentLimit > 0 && len(activeSessions) >= concurrentLimit {
+	if groupExceeded || concurrentLimit > 0 && len(activeSessions)-len(replaced) >= concurrentLimit {
 		result.LimitExceeded = true
-		return result, nil
+		h.config.Logger.Info("heimdall: session limit exceeded", "user_id", userID,
+			"active", len(activeSessions), "group_key", opts.GroupKey)
+		h.capActiveSessions(result)
+		result.Event = newLoginEvent(result)
+		h.emitAnalytics(userID, device, location, result)
+		p := &pendingSession{result: result}
+		if h.config.LimitExceededAsError {
+			return p, ErrSessionLimitExceeded
+		}
+		return p, nil
 	}
+	softLimit := h.config.SoftConcurrentLimit
+	result.LimitWarning = softLimit > 0 && len(activeSessions)-len(replaced) >= softLimit
 
-	// Create and save the new session
-	now := time.Now()
+	if len(replaced) > 0 {
+		result.ReplacedSessions = replaced
+		result.ActiveSessions = remaining
+	}
+
+	// Create the new session
 	storeSession := &store.Session{
-		SessionID:  sessionID,
-		UserID:     userID,
-		DeviceIP:   device.IP,
-		DeviceUA:   device.UserAgent,
-		Browser:    device.Browser,
-		OS:         device.OS,
-		DeviceType: device.DeviceType,
-		LocCity:    location.City,
-		LocCountry: location.Country,
-		LocLat:     location.Latitude,
-		LocLng:     location.Longitude,
-		TTLSeconds: int64(h.config.SessionTTL.Seconds()),
-		CreatedAt:  now,
-	}
-
-	if err := h.sessions.Save(storeSession); err != nil {
-		return nil, fmt.Errorf("heimdall: failed to save session: %w", err)
+		SessionID:         storedID,
+		UserID:            userID,
+		DeviceIP:          device.IP,
+		DeviceUA:          device.UserAgent,
+		Browser:           device.Browser,
+		OS:                device.OS,
+		DeviceType:        device.DeviceType.String(),
+		DeviceFingerprint: device.Fingerprint,
+		LocCity:           location.City,
+		LocCountry:        location.Country,
+		LocCountryCode:    location.CountryCode,
+		LocLat:            location.Latitude,
+		LocLng:            location.Longitude,
+		LocGeohash:        location.Geohash,
+		LocASN:            location.ASN,
+		GroupKey:          opts.GroupKey,
+		TTLSeconds:        int64(ttl.Seconds()),
+		CreatedAt:         createdAt,
 	}
 
 	// Build result session
@@ -187,44 +506,682 @@ func (h *Heimdall) RegisterSession(
 		UserID:     userID,
 		Device:     device,
 		Location:   location,
-		CreatedAt:  now,
-		TTLSeconds: int64(h.config.SessionTTL.Seconds()),
+		GroupKey:   opts.GroupKey,
+		CreatedAt:  createdAt,
+		TTLSeconds: int64(ttl.Seconds()),
 	}
 
+	return &pendingSession{
+		result:   result,
+		session:  storeSession,
+		replaced: replaced,
+		device:   device,
+		location: location,
+	}, nil
+}
+
+// replaceSessions invalidates the sessions p replaces.
+func (h *Heimdall) replaceSessions(p *pendingSession) error {
+	for _, s := range p.replaced {
+		if err := h.invalidateStored(s.SessionID); err != nil {
+			return fmt.Errorf("heimdall: failed to replace session: %w", err)
+		}
+	}
+	return nil
+}
+
+// completeSession finishes the result of p once its session is saved.
+func (h *Heimdall) completeSession(p *pendingSession) {
+	result := p.result
+
 	// Add new session to active sessions list
 	result.ActiveSessions = append([]*Session{result.Session}, result.ActiveSessions...)
 
-	return result, nil
+	h.capActiveSessions(result)
+	result.Event = newLoginEvent(result)
+	h.emitAnalytics(p.session.UserID, p.device, p.location, result)
+}
+
+// fetchActiveSessions returns the user's newest active sessions, at most
+// Config.MaxSessionsFetched of them.
+func (h *Heimdall) fetchActiveSessions(userID string) ([]*store.Session, error) {
+	limit := h.config.MaxSessionsFetched
+	if limitedStore, ok := store.Optional[store.LimitedFetchStore](h.sessions); ok {
+		sessions, err := storeCall(h, "GetActiveByUserLimit", func() ([]*store.Session, error) {
+			return limitedStore.GetActiveByUserLimit(userID, limit)
+		})
+		return sessions, err
+	}
+
+	sessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions[:min(len(sessions), limit)], nil
+}
+
+// learningLocations reports whether the user has fewer sessions than
+// Config.LocationLearningSessions, so new locations should not be flagged yet.
+// active is the number of the user's active sessions, used for stores that
+// cannot count their history.
+func (h *Heimdall) learningLocations(userID string, active int) (bool, error) {
+	if h.config.LocationLearningSessions <= 0 {
+		return false, nil
+	}
+
+	count := active
+	if countStore, ok := store.Optional[store.SessionCountStore](h.sessions); ok {
+		var err error
+		count, err = storeCall(h, "CountSessionsByUser", func() (int, error) {
+			return countStore.CountSessionsByUser(userID)
+		})
+		if err != nil {
+			return false, fmt.Errorf("heimdall: failed to count sessions: %w", err)
+		}
+	}
+	return count < h.config.LocationLearningSessions, nil
+}
+
+// groupLimitExceeded reports whether opts.GroupKey already has
+// opts.GroupLimit active sessions, not counting the user's sessions about to
+// be replaced.
+func (h *Heimdall) groupLimitExceeded(opts RegisterOptions, replaced []*Session) (bool, error) {
+	if opts.GroupKey == "" || opts.GroupLimit <= 0 {
+		return false, nil
+	}
+
+	countStore, ok := store.Optional[store.GroupCountStore](h.sessions)
+	if !ok {
+		return false, ErrUnsupportedStore
+	}
+
+	count, err := storeCall(h, "CountActiveByGroup", func() (int, error) {
+		return countStore.CountActiveByGroup(opts.GroupKey)
+	})
+	if err != nil {
+		return false, fmt.Errorf("heimdall: failed to count group sessions: %w", err)
+	}
+
+	for _, s := range replaced {
+		if s.GroupKey == opts.GroupKey {
+			count--
+		}
+	}
+	return count >= opts.GroupLimit, nil
+}
+
+// capActiveSessions records the number of active sessions in result and
+// truncates ActiveSessions to Config.MaxActiveSessionsInResult.
+func (h *Heimdall) capActiveSessions(result *RegisterResult) {
+	result.ActiveSessionCount = len(result.ActiveSessions)
+	if max := h.config.MaxActiveSessionsInResult; max > 0 && len(result.ActiveSessions) > max {
+		result.ActiveSessions = result.ActiveSessions[:max]
+	}
+}
+
+// findDuplicate returns the session among sessions that was created within
+// Config.DedupeWindow of createdAt from the same device and IP, or nil if
+// there is none or deduplication is disabled.
+// Stored sessions carry the hashed ID if Config.SessionIDHasher is set, which
+// the client cannot present, so deduplication is then disabled as well.
+func (h *Heimdall) findDuplicate(sessions []*Session, device DeviceInfo, createdAt time.Time) *Session {
+	window := h.config.DedupeWindow
+	if window <= 0 || h.config.SessionIDHasher != nil {
+		return nil
+	}
+
+	for _, s := range sessions {
+		age := createdAt.Sub(s.CreatedAt)
+		if s.Device.IP == device.IP && sameDevice(s.Device, device) && age > -window && age < window {
+			return s
+		}
+	}
+	return nil
+}
+
+// sessionTTL returns the TTL for a session requesting ttl, applying
+// MinSessionTTL and MaxSessionTTL. Zero requests Config.SessionTTL, which is
+// not subject to the bounds.
+func (h *Heimdall) sessionTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl == 0 {
+		return h.config.SessionTTL, nil
+	}
+
+	minTTL, maxTTL := h.config.MinSessionTTL, h.config.MaxSessionTTL
+	switch {
+	case ttl < 0:
+		return 0, fmt.Errorf("%w: %v is negative", ErrTTLOutOfRange, ttl)
+	case minTTL > 0 && ttl < minTTL:
+		if h.config.RejectOutOfRangeTTL {
+			return 0, fmt.Errorf("%w: %v is shorter than %v", ErrTTLOutOfRange, ttl, minTTL)
+		}
+		return minTTL, nil
+	case maxTTL > 0 && ttl > maxTTL:
+		if h.config.RejectOutOfRangeTTL {
+			return 0, fmt.Errorf("%w: %v is longer than %v", ErrTTLOutOfRange, ttl, maxTTL)
+		}
+		return maxTTL, nil
+	}
+	return ttl, nil
+}
+
+// jitterTTL moves ttl by a random amount of up to Config.TTLJitter either
+// way, keeping it at least one second and, if bounded, within MinSessionTTL
+// and MaxSessionTTL. Like in sessionTTL, the default SessionTTL is not
+// bounded.
+func (h *Heimdall) jitterTTL(ttl time.Duration, bounded bool) time.Duration {
+	jitter := h.config.TTLJitter
+	if jitter <= 0 {
+		return ttl
+	}
+
+	ttl += time.Duration((2*h.config.TTLJitterSource() - 1) * float64(jitter))
+	if !bounded {
+		return max(ttl, time.Second)
+	}
+	if minTTL := h.config.MinSessionTTL; minTTL > 0 && ttl < minTTL {
+		ttl = minTTL
+	}
+	if maxTTL := h.config.MaxSessionTTL; maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+	return max(ttl, time.Second)
+}
+
+// BeginSession registers a session with an ID created by
+// Config.SessionIDGenerator. The new ID is in result.Session.SessionID;
+// if the limit is exceeded, no session is created and result.Session is nil.
+func (h *Heimdall) BeginSession(
+	userID string,
+	device DeviceInfo,
+	location LocationInfo,
+	concurrentLimit int,
+) (*RegisterResult, error) {
+	sessionID := h.config.SessionIDGenerator()
+	return h.RegisterSession(userID, sessionID, device, location, concurrentLimit)
+}
+
+// detectNewLocation compares location against the user's active sessions
+// according to the configured LocationComparison. It returns the previous
+// location that was compared against and whether location counts as new.
+func (h *Heimdall) detectNewLocation(sessions []*Session, location LocationInfo) (*LocationInfo, bool) {
+	if len(sessions) == 0 {
+		return nil, false
+	}
+
+	threshold := h.config.NewLocationThresholdKM
+
+	switch h.config.NewLocationComparison {
+	case CompareNearest:
+		var nearest *LocationInfo
+		nearestKM := math.Inf(1)
+		for _, s := range sessions {
+			// Close to any active session means not new
+			if h.sameIPLocation(s, location) || !IsNewLocation(s.Location, location, threshold) {
+				return nil, false
+			}
+			if hasCoordinates(s.Location) && hasCoordinates(location) {
+				distance := HaversineDistance(
+					s.Location.Latitude, s.Location.Longitude,
+					location.Latitude, location.Longitude,
+				)
+				if distance < nearestKM {
+					prev := s.Location
+					nearest = &prev
+					nearestKM = distance
+				}
+			}
+		}
+		if nearest == nil {
+			prev := latestSession(sessions).Location
+			nearest = &prev
+		}
+		return nearest, true
+
+	case CompareCentroid:
+		if center, ok := h.sessionCentroid(sessions, 0); ok && hasCoordinates(location) {
+			for _, s := range sessions {
+				if h.sameIPLocation(s, location) {
+					return nil, false
+				}
+			}
+			if IsNewLocation(center, location, threshold) {
+				return &center, true
+			}
+			return nil, false
+		}
+		fallthrough
+
+	default:
+		latest := latestSession(sessions)
+		prev := latest.Location
+		if !h.sameIPLocation(latest, location) && IsNewLocation(prev, location, threshold) {
+			return &prev, true
+		}
+		return nil, false
+	}
+}
+
+// latestSession returns the most recently created of sessions, which must not
+// be empty. Stores return sessions newest first, but custom stores might not.
+func latestSession(sessions []*Session) *Session {
+	latest := sessions[0]
+	for _, s := range sessions[1:] {
+		if s.CreatedAt.After(latest.CreatedAt) {
+			latest = s
+		}
+	}
+	return latest
+}
+
+// sameIPLocation reports whether location is from the same IP as the session
+// and Config.SameIPNeverNewLocation makes that never a new location.
+func (h *Heimdall) sameIPLocation(s *Session, location LocationInfo) bool {
+	return h.config.SameIPNeverNewLocation && location.IP != "" && s.Device.IP == location.IP
+}
+
+// inLocationGrace reports whether the newest of sessions was created within
+// Config.NewLocationGrace of createdAt.
+func (h *Heimdall) inLocationGrace(sessions []*Session, createdAt time.Time) bool {
+	if h.config.NewLocationGrace <= 0 || len(sessions) == 0 {
+		return false
+	}
+	gap := createdAt.Sub(latestSession(sessions).CreatedAt)
+	if gap < 0 {
+		gap = -gap
+	}
+	return gap <= h.config.NewLocationGrace
 }
 
 // InvalidateSession marks a session as invalidated.
 // The session ID is stored in the invalidation cache with the configured TTL.
 // The session is also deleted from the session store.
+//
+// The invalidation is recorded before the session is deleted, so a failure
+// never leaves a session that is gone from the store but still accepted:
+// if the cache fails, nothing has changed; if the store fails, the session
+// is already rejected by IsSessionInvalidated but still listed as active.
+// Either way, calling InvalidateSession again completes the operation.
+// Invalidating a session that is already invalidated writes nothing, so
+// retried logouts are cheap.
 func (h *Heimdall) InvalidateSession(sessionID string) error {
-	// Delete from session store
-	if err := h.sessions.Delete(sessionID); err != nil {
-		return fmt.Errorf("heimdall: failed to delete session: %w", err)
+	_, err := h.InvalidateSessionOnce(sessionID)
+	return err
+}
+
+// InvalidateSessionOnce is like InvalidateSession but also reports whether
+// the session was already invalidated, in which case only a session left
+// behind in the store by a failed earlier call is deleted.
+func (h *Heimdall) InvalidateSessionOnce(sessionID string) (alreadyInvalidated bool, err error) {
+	storedID := h.storageID(sessionID)
+
+	invalidated, err := storeCall(h, "Exists", func() (bool, error) {
+		return h.invalidated.Exists(storedID)
+	})
+	if err != nil {
+		return false, fmt.Errorf("heimdall: failed to check invalidation: %w", err)
 	}
+	if !invalidated {
+		return false, h.invalidateStored(storedID)
+	}
+
+	exists, err := storeCall(h, "SessionExists", func() (bool, error) {
+		return h.sessions.SessionExists(storedID)
+	})
+	if err != nil {
+		return true, fmt.Errorf("heimdall: failed to check session: %w", err)
+	}
+	if exists {
+		err = h.storeExec("Delete", func() error {
+			return h.sessions.Delete(storedID)
+		})
+		if err != nil {
+			return true, fmt.Errorf("heimdall: failed to delete session: %w", err)
+		}
+	}
+	return true, nil
+}
 
+// invalidateStored invalidates a session by the ID it is stored under.
+func (h *Heimdall) invalidateStored(storedID string) error {
+	return h.invalidateStoredFor(storedID, h.config.InvalidationTTL)
+}
+
+// invalidateStoredFor is like invalidateStored but remembers the
+// invalidation for ttl instead of Config.InvalidationTTL.
+func (h *Heimdall) invalidateStoredFor(storedID string, ttl time.Duration) error {
 	// Add to invalidation cache
-	if err := h.invalidated.Set(sessionID, h.config.InvalidationTTL); err != nil {
+	err := h.storeExec("Set", func() error {
+		return h.invalidated.Set(storedID, ttl)
+	})
+	if err != nil {
+		h.config.Logger.Error("heimdall: failed to set invalidation", "error", err)
 		return fmt.Errorf("heimdall: failed to set invalidation: %w", err)
 	}
 
+	// Delete from session store
+	err = h.storeExec("Delete", func() error {
+		return h.sessions.Delete(storedID)
+	})
+	if err != nil {
+		h.config.Logger.Error("heimdall: failed to delete session", "error", err)
+		return fmt.Errorf("heimdall: failed to delete session: %w", err)
+	}
+
 	return nil
 }
 
+// storageID returns the ID a session is stored under, applying
+// Config.SessionIDHasher.
+func (h *Heimdall) storageID(sessionID string) string {
+	if h.config.SessionIDHasher == nil {
+		return sessionID
+	}
+	return h.config.SessionIDHasher(sessionID)
+}
+
+// InvalidateByDevice invalidates all of the user's active sessions on a
+// device, e.g. when the device is lost. The device is fingerprinted from the
+// User-Agent alone with Config.DeviceFingerprinter and compared as for
+// Config.OneSessionPerDevice; if the fingerprinter uses more than the
+// User-Agent, use InvalidateByFingerprint instead. It returns the number of
+// sessions invalidated; if an invalidation fails, the count so far is
+// returned with the error.
+func (h *Heimdall) InvalidateByDevice(userID, userAgent string) (int, error) {
+	device := DeviceInfo{UserAgent: userAgent}
+	device.Fingerprint = h.config.DeviceFingerprinter(device)
+	return h.invalidateByDevice(userID, device)
+}
+
+// InvalidateByFingerprint invalidates all of the user's active sessions on
+// the device with the given fingerprint, e.g. DeviceSummary.Device.Fingerprint
+// from ListDevices. Sessions fingerprinted by another version are not
+// matched. It returns the number of sessions invalidated; if an
+// invalidation fails, the count so far is returned with the error.
+func (h *Heimdall) InvalidateByFingerprint(userID, fingerprint string) (int, error) {
+	return h.invalidateByDevice(userID, DeviceInfo{Fingerprint: fingerprint})
+}
+
+// invalidateByDevice invalidates all of the user's active sessions on the
+// same device as device.
+func (h *Heimdall) invalidateByDevice(userID string, device DeviceInfo) (int, error) {
+	sessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("heimdall: failed to get active sessions: %w", err)
+	}
+
+	count := 0
+	for _, s := range sessions {
+		if !sameDevice(storeToSession(s).Device, device) {
+			continue
+		}
+		if err := h.invalidateStored(s.SessionID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// InvalidateByDeviceType invalidates all of the user's active sessions of a
+// device type, e.g. all mobile sessions after a compromised app release. It
+// returns the number of sessions invalidated; if an invalidation fails, the
+// count so far is returned with the error.
+func (h *Heimdall) InvalidateByDeviceType(userID string, dt DeviceType) (int, error) {
+	if !dt.Valid() {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidDeviceType, dt)
+	}
+	if userID == "" {
+		return 0, nil
+	}
+
+	if deviceTypeStore, ok := store.Optional[store.DeviceTypeStore](h.sessions); ok {
+		return h.invalidateByDeviceType(deviceTypeStore, userID, dt)
+	}
+
+	sessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("heimdall: failed to get active sessions: %w", err)
+	}
+
+	count := 0
+	for _, s := range sessions {
+		if ParseDeviceType(s.DeviceType) != dt {
+			continue
+		}
+		if err := h.invalidateStored(s.SessionID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// InvalidateAllByDeviceType is like InvalidateByDeviceType but invalidates
+// the active sessions of every user, for platform-wide incidents.
+// Requires a session store implementing store.DeviceTypeStore; otherwise
+// ErrUnsupportedStore is returned.
+func (h *Heimdall) InvalidateAllByDeviceType(dt DeviceType) (int, error) {
+	if !dt.Valid() {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidDeviceType, dt)
+	}
+
+	deviceTypeStore, ok := store.Optional[store.DeviceTypeStore](h.sessions)
+	if !ok {
+		return 0, ErrUnsupportedStore
+	}
+	return h.invalidateByDeviceType(deviceTypeStore, "", dt)
+}
+
+// invalidateByDeviceType invalidates the active sessions of a device type
+// selected by the store, of the user or, if userID is empty, of all users.
+func (h *Heimdall) invalidateByDeviceType(deviceTypeStore store.DeviceTypeStore, userID string, dt DeviceType) (int, error) {
+	sessions, err := storeCall(h, "GetActiveByDeviceType", func() ([]*store.Session, error) {
+		return deviceTypeStore.GetActiveByDeviceType(userID, dt.String())
+	})
+	if err != nil {
+		return 0, fmt.Errorf("heimdall: failed to get sessions by device type: %w", err)
+	}
+
+	count := 0
+	for _, s := range sessions {
+		if err := h.invalidateStored(s.SessionID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// DedupeSessions invalidates duplicate active sessions of the user, such as
+// those created by racing logins: sessions from the same device and IP as a
+// newer session created less than window before it. Only the newest of each
+// set of duplicates is kept. It returns the number of sessions invalidated;
+// if an invalidation fails, the count so far is returned with the error.
+func (h *Heimdall) DedupeSessions(userID string, window time.Duration) (int, error) {
+	sessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("heimdall: failed to get active sessions: %w", err)
+	}
+
+	// Sessions are newest first, so each is compared against newer ones kept
+	var kept []*Session
+	count := 0
+	for _, stored := range sessions {
+		s := storeToSession(stored)
+		duplicate := false
+		for _, k := range kept {
+			if k.Device.IP == s.Device.IP && sameDevice(k.Device, s.Device) && k.CreatedAt.Sub(s.CreatedAt) < window {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, s)
+			continue
+		}
+		if err := h.invalidateStored(stored.SessionID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
 // IsSessionInvalidated checks if a session has been invalidated.
 // Returns true if the session ID was explicitly invalidated and the
 // invalidation TTL has not expired.
 func (h *Heimdall) IsSessionInvalidated(sessionID string) (bool, error) {
-	return h.invalidated.Exists(sessionID)
+	return storeCall(h, "Exists", func() (bool, error) {
+		return h.invalidated.Exists(h.storageID(sessionID))
+	})
+}
+
+// IsSessionInvalidatedOr is like IsSessionInvalidated but never fails: if the
+// invalidation cache returns an error, Config.InvalidationFailMode decides the
+// answer. Use IsSessionInvalidated instead if you need to log or alert on
+// cache outages.
+func (h *Heimdall) IsSessionInvalidatedOr(sessionID string) bool {
+	invalidated, err := storeCall(h, "Exists", func() (bool, error) {
+		return h.invalidated.Exists(h.storageID(sessionID))
+	})
+	if err != nil {
+		return h.config.InvalidationFailMode == FailClosed
+	}
+	return invalidated
+}
+
+// FilterInvalidated returns the subset of sessionIDs that are currently
+// invalidated, in their original order, so services can prune local token
+// caches in one call. Caches implementing store.BatchCache are queried in
+// bulk; others are checked one ID at a time.
+func (h *Heimdall) FilterInvalidated(sessionIDs []string) ([]string, error) {
+	storedIDs := make([]string, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		storedIDs[i] = h.storageID(sessionID)
+	}
+
+	var exists []bool
+	if batchCache, ok := h.invalidated.(store.BatchCache); ok {
+		var err error
+		exists, err = storeCall(h, "ExistsMany", func() ([]bool, error) {
+			return batchCache.ExistsMany(storedIDs)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("heimdall: failed to check invalidations: %w", err)
+		}
+	} else {
+		exists = make([]bool, len(storedIDs))
+		for i, storedID := range storedIDs {
+			invalidated, err := storeCall(h, "Exists", func() (bool, error) {
+				return h.invalidated.Exists(storedID)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("heimdall: failed to check invalidations: %w", err)
+			}
+			exists[i] = invalidated
+		}
+	}
+
+	invalidated := []string{}
+	for i, sessionID := range sessionIDs {
+		if exists[i] {
+			invalidated = append(invalidated, sessionID)
+		}
+	}
+	return invalidated, nil
+}
+
+// ListInvalidated returns the IDs of sessions invalidated at or after since.
+// Other services can use it to propagate logouts they need to enforce locally.
+// Depending on the invalidation cache this may be expensive; see the
+// backend's documentation.
+func (h *Heimdall) ListInvalidated(since time.Time) ([]string, error) {
+	ids, err := storeCall(h, "ListInvalidated", func() ([]string, error) {
+		return h.invalidated.ListInvalidated(since)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to list invalidations: %w", err)
+	}
+	return ids, nil
+}
+
+// InvalidationCount returns the number of sessions invalidated at or after
+// since, for alerting on unusual logout rates. It is answered by the
+// invalidation cache or, failing that, the session store, if either
+// implements store.InvalidationCounter (the SQLite and MySQL stores and the
+// memory cache do). Otherwise, e.g. with a Redis cache and a non-SQL session
+// store, ErrUnsupportedStore is returned.
+func (h *Heimdall) InvalidationCount(since time.Time) (int, error) {
+	counter, ok := h.invalidated.(store.InvalidationCounter)
+	if !ok {
+		if counter, ok = store.Optional[store.InvalidationCounter](h.sessions); !ok {
+			return 0, ErrUnsupportedStore
+		}
+	}
+
+	count, err := storeCall(h, "CountInvalidated", func() (int, error) {
+		return counter.CountInvalidated(since)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("heimdall: failed to count invalidations: %w", err)
+	}
+	return count, nil
+}
+
+// GetSession returns the active session with the given ID. It returns
+// ErrSessionInvalidated if the session was invalidated and the invalidation
+// has not expired, and ErrSessionNotFound if it is unknown or expired, so
+// middleware can tell a revoked session from a bogus one. The session has
+// SessionID as passed, also with Config.SessionIDHasher set.
+// Requires a session store implementing store.SessionGetter; otherwise
+// ErrUnsupportedStore is returned.
+func (h *Heimdall) GetSession(sessionID string) (*Session, error) {
+	getter, ok := store.Optional[store.SessionGetter](h.sessions)
+	if !ok {
+		return nil, ErrUnsupportedStore
+	}
+	storedID := h.storageID(sessionID)
+
+	invalidated, err := storeCall(h, "Exists", func() (bool, error) {
+		return h.invalidated.Exists(storedID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to check invalidation: %w", err)
+	}
+	if invalidated {
+		return nil, ErrSessionInvalidated
+	}
+
+	session, err := storeCall(h, "GetSession", func() (*store.Session, error) {
+		return getter.GetSession(storedID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to get session: %w", err)
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	result := storeToSession(session)
+	result.SessionID = sessionID
+	return result, nil
 }
 
 // ListSessions returns all active (non-expired) sessions for a user.
 // Sessions are ordered by creation time, newest first.
 func (h *Heimdall) ListSessions(userID string) ([]*Session, error) {
-	storeSessions, err := h.sessions.GetActiveByUser(userID)
+	storeSessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("heimdall: failed to list sessions: %w", err)
 	}
@@ -234,6 +1191,180 @@ func (h *Heimdall) ListSessions(userID string) ([]*Session, error) {
 		sessions[i] = storeToSession(s)
 	}
 
+	h.notifyExpired(userID)
+
+	return sessions, nil
+}
+
+// HasActiveSession reports whether the user has any active session, e.g. for
+// presence checks. Stores implementing store.PresenceStore answer without
+// fetching sessions; others fetch at most one.
+func (h *Heimdall) HasActiveSession(userID string) (bool, error) {
+	if presenceStore, ok := store.Optional[store.PresenceStore](h.sessions); ok {
+		active, err := storeCall(h, "HasActiveByUser", func() (bool, error) {
+			return presenceStore.HasActiveByUser(userID)
+		})
+		if err != nil {
+			return false, fmt.Errorf("heimdall: failed to check active sessions: %w", err)
+		}
+		return active, nil
+	}
+
+	var sessions []*store.Session
+	var err error
+	if limitedStore, ok := store.Optional[store.LimitedFetchStore](h.sessions); ok {
+		sessions, err = storeCall(h, "GetActiveByUserLimit", func() ([]*store.Session, error) {
+			return limitedStore.GetActiveByUserLimit(userID, 1)
+		})
+	} else {
+		sessions, err = storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+			return h.sessions.GetActiveByUser(userID)
+		})
+	}
+	if err != nil {
+		return false, fmt.Errorf("heimdall: failed to check active sessions: %w", err)
+	}
+	return len(sessions) > 0, nil
+}
+
+// ListSessionsByProximity returns the user's active sessions ordered by
+// distance from the reference coordinates, nearest first, e.g. to review
+// sessions against a known-good location during an incident. Sessions
+// without coordinates come last, newest first.
+func (h *Heimdall) ListSessionsByProximity(userID string, refLat, refLng float64) ([]*Session, error) {
+	sessions, err := h.ListSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make(map[*Session]float64, len(sessions))
+	for _, s := range sessions {
+		distance := math.Inf(1)
+		if hasCoordinates(s.Location) {
+			distance = HaversineDistance(refLat, refLng, s.Location.Latitude, s.Location.Longitude)
+		}
+		distances[s] = distance
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return distances[sessions[i]] < distances[sessions[j]]
+	})
+	return sessions, nil
+}
+
+// DistinctIPCount returns the number of distinct IPs the user has logged in
+// from within the last window. A sudden spike is a credential-stuffing signal.
+// Stores implementing store.DistinctIPStore also count expired and invalidated
+// sessions; for other stores only active sessions are considered.
+func (h *Heimdall) DistinctIPCount(userID string, window time.Duration) (int, error) {
+	since := time.Now().Add(-window)
+
+	if ipStore, ok := store.Optional[store.DistinctIPStore](h.sessions); ok {
+		count, err := storeCall(h, "CountDistinctIPs", func() (int, error) {
+			return ipStore.CountDistinctIPs(userID, since)
+		})
+		if err != nil {
+			return 0, fmt.Errorf("heimdall: failed to count distinct IPs: %w", err)
+		}
+		return count, nil
+	}
+
+	sessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("heimdall: failed to count distinct IPs: %w", err)
+	}
+	ips := make(map[string]bool)
+	for _, s := range sessions {
+		if !s.CreatedAt.Before(since) {
+			ips[s.DeviceIP] = true
+		}
+	}
+	return len(ips), nil
+}
+
+// LastLoginAt returns when the user last logged in, for "welcome back"
+// messages and dormant-account detection. The bool is false if the user has
+// no login history. Stores implementing store.LastLoginStore also consider
+// expired and invalidated sessions; for other stores only active sessions
+// are considered.
+func (h *Heimdall) LastLoginAt(userID string) (time.Time, bool, error) {
+	if lastLoginStore, ok := store.Optional[store.LastLoginStore](h.sessions); ok {
+		var last time.Time
+		found, err := storeCall(h, "LastLoginAt", func() (bool, error) {
+			var found bool
+			var err error
+			last, found, err = lastLoginStore.LastLoginAt(userID)
+			return found, err
+		})
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("heimdall: failed to get last login: %w", err)
+		}
+		return last, found, nil
+	}
+
+	sessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+		return h.sessions.GetActiveByUser(userID)
+	})
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("heimdall: failed to get last login: %w", err)
+	}
+	if len(sessions) == 0 {
+		return time.Time{}, false, nil
+	}
+	// Stores are not required to return sessions newest first
+	active := make([]*Session, len(sessions))
+	for i, s := range sessions {
+		active[i] = storeToSession(s)
+	}
+	return latestSession(active).CreatedAt, true, nil
+}
+
+// SessionsActiveAt returns the user's sessions that were active at t, for
+// incident forensics. Sessions invalidated after t are included.
+// Requires a session store implementing store.HistoryStore; otherwise
+// ErrUnsupportedStore is returned.
+func (h *Heimdall) SessionsActiveAt(userID string, t time.Time) ([]*Session, error) {
+	historyStore, ok := store.Optional[store.HistoryStore](h.sessions)
+	if !ok {
+		return nil, ErrUnsupportedStore
+	}
+
+	storeSessions, err := storeCall(h, "GetActiveByUserAt", func() ([]*store.Session, error) {
+		return historyStore.GetActiveByUserAt(userID, t)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to get sessions at %v: %w", t, err)
+	}
+
+	sessions := make([]*Session, len(storeSessions))
+	for i, s := range storeSessions {
+		sessions[i] = storeToSession(s)
+	}
+	return sessions, nil
+}
+
+// ExpiringSoon returns the active sessions of all users that expire within
+// the given duration, soonest first, e.g. to warn users before they are
+// signed out. Requires a session store implementing store.ExpiringStore;
+// otherwise ErrUnsupportedStore is returned.
+func (h *Heimdall) ExpiringSoon(within time.Duration) ([]*Session, error) {
+	expiringStore, ok := store.Optional[store.ExpiringStore](h.sessions)
+	if !ok {
+		return nil, ErrUnsupportedStore
+	}
+
+	storeSessions, err := storeCall(h, "GetExpiringSoon", func() ([]*store.Session, error) {
+		return expiringStore.GetExpiringSoon(within)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to get expiring sessions: %w", err)
+	}
+
+	sessions := make([]*Session, len(storeSessions))
+	for i, s := range storeSessions {
+		sessions[i] = storeToSession(s)
+	}
 	return sessions, nil
 }
 
@@ -243,20 +1374,26 @@ func storeToSession(s *store.Session) *Session {
 		SessionID: s.SessionID,
 		UserID:    s.UserID,
 		Device: DeviceInfo{
-			IP:         s.DeviceIP,
-			UserAgent:  s.DeviceUA,
-			Browser:    s.Browser,
-			OS:         s.OS,
-			DeviceType: s.DeviceType,
+			IP:          s.DeviceIP,
+			UserAgent:   s.DeviceUA,
+			Browser:     s.Browser,
+			OS:          s.OS,
+			DeviceType:  ParseDeviceType(s.DeviceType),
+			Fingerprint: s.DeviceFingerprint,
 		},
 		Location: LocationInfo{
-			IP:        s.DeviceIP,
-			City:      s.LocCity,
-			Country:   s.LocCountry,
-			Latitude:  s.LocLat,
-			Longitude: s.LocLng,
+			IP:          s.DeviceIP,
+			City:        s.LocCity,
+			Country:     s.LocCountry,
+			CountryCode: s.LocCountryCode,
+			Latitude:    s.LocLat,
+			Longitude:   s.LocLng,
+			Geohash:     s.LocGeohash,
+			ASN:         s.LocASN,
 		},
-		CreatedAt:  s.CreatedAt,
-		TTLSeconds: s.TTLSeconds,
+		GroupKey:        s.GroupKey,
+		CreatedAt:       s.CreatedAt,
+		TTLSeconds:      s.TTLSeconds,
+		StoredExpiresAt: s.StoredExpiresAt,
 	}
 }
@@ -1,7 +1,14 @@
 package heimdall
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"slices"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -99,6 +106,50 @@ func TestHeimdallBasicFlow(t *testing.T) {
 	}
 }
 
+// drainingStore is a SessionStore whose Close waits for delay, like a backend
+// finishing in-flight work.
+type drainingStore struct {
+	store.SessionStore
+	delay  time.Duration
+	closed *atomic.Bool
+}
+
+func (s drainingStore) Close() error {
+	time.Sleep(s.delay)
+	s.closed.Store(true)
+	return s.SessionStore.Close()
+}
+
+func TestCloseWithTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"drains within timeout", time.Second, false},
+		{"gives up after timeout", time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		closed := &atomic.Bool{}
+		h, err := New(Config{
+			SessionStore:      drainingStore{store.NewMemorySessionStore(), 50 * time.Millisecond, closed},
+			InvalidationCache: store.NewMemoryCache(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create Heimdall: %v", err)
+		}
+
+		err = h.CloseWithTimeout(tt.timeout)
+		if errors.Is(err, ErrCloseTimeout) != tt.wantErr {
+			t.Errorf("%s: expected ErrCloseTimeout %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if closed.Load() == tt.wantErr {
+			t.Errorf("%s: expected the store to be closed %v on return", tt.name, !tt.wantErr)
+		}
+	}
+}
+
 func TestConcurrentSessionLimit(t *testing.T) {
 	h, err := newTestHeimdall()
 	if err != nil {
@@ -140,6 +191,223 @@ func TestConcurrentSessionLimit(t *testing.T) {
 	}
 }
 
+func TestGroupSessionLimit(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	acme := RegisterOptions{GroupKey: "acme", GroupLimit: 2}
+
+	logins := []struct {
+		userID, sessionID string
+		opts              RegisterOptions
+		wantExceeded      bool
+	}{
+		{"alice", "alice1", acme, false},
+		{"bob", "bob1", acme, false},
+		{"carol", "carol1", acme, true}, // acme is full across users
+		{"dave", "dave1", RegisterOptions{GroupKey: "globex", GroupLimit: 2}, false}, // other orgs are unaffected
+		{"carol", "carol2", RegisterOptions{}, false},                                // sessions outside a group are unlimited
+	}
+
+	for _, l := range logins {
+		result, err := h.RegisterSessionWithOptions(l.userID, l.sessionID, device, location, 0, l.opts)
+		if err != nil {
+			t.Fatalf("Failed to register %s: %v", l.sessionID, err)
+		}
+		if result.LimitExceeded != l.wantExceeded {
+			t.Errorf("%s: expected LimitExceeded %v, got %v", l.sessionID, l.wantExceeded, result.LimitExceeded)
+		}
+		if !l.wantExceeded && result.Session.GroupKey != l.opts.GroupKey {
+			t.Errorf("%s: expected GroupKey %q, got %q", l.sessionID, l.opts.GroupKey, result.Session.GroupKey)
+		}
+	}
+
+	// Logging out frees a seat for the group
+	if err := h.InvalidateSession("alice1"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+	result, err := h.RegisterSessionWithOptions("carol", "carol3", device, location, 0, acme)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.LimitExceeded {
+		t.Error("Expected a seat to be free after alice logged out")
+	}
+}
+
+func TestLimitExceededAsError(t *testing.T) {
+	for _, asError := range []bool{false, true} {
+		h, err := newTestHeimdallWithConfig(Config{LimitExceededAsError: asError})
+		if err != nil {
+			t.Fatalf("Failed to create Heimdall: %v", err)
+		}
+		defer h.Close()
+
+		device := DeviceInfo{IP: "8.8.8.8"}
+		location := LocationInfo{IP: "8.8.8.8"}
+		if _, err := h.RegisterSession("user123", "session1", device, location, 1); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+
+		result, err := h.RegisterSession("user123", "session2", device, location, 1)
+		if errors.Is(err, ErrSessionLimitExceeded) != asError {
+			t.Errorf("LimitExceededAsError %v: expected ErrSessionLimitExceeded %v, got %v", asError, asError, err)
+		}
+		if result == nil || !result.LimitExceeded {
+			t.Errorf("LimitExceededAsError %v: expected a result with LimitExceeded set, got %+v", asError, result)
+		}
+	}
+}
+
+func TestSoftConcurrentLimit(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{SoftConcurrentLimit: 2})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	logins := []struct {
+		sessionID    string
+		wantWarning  bool
+		wantExceeded bool
+	}{
+		{"session1", false, false},
+		{"session2", false, false},
+		{"session3", true, false},
+		{"session4", true, false},
+		{"session5", false, true},
+	}
+	for _, l := range logins {
+		result, err := h.RegisterSession("user123", l.sessionID, device, location, 4)
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+		if result.LimitWarning != l.wantWarning || result.LimitExceeded != l.wantExceeded {
+			t.Errorf("%s: expected LimitWarning %v, LimitExceeded %v, got %v, %v",
+				l.sessionID, l.wantWarning, l.wantExceeded, result.LimitWarning, result.LimitExceeded)
+		}
+		if l.wantWarning && result.Session == nil {
+			t.Errorf("%s: expected session to be saved despite warning", l.sessionID)
+		}
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 4 {
+		t.Errorf("Expected 4 sessions, got %d", len(sessions))
+	}
+}
+
+func TestRegisterSessionNegativeLimit(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	_, err = h.RegisterSession("user123", "session1", DeviceInfo{IP: "8.8.8.8"}, LocationInfo{IP: "8.8.8.8"}, -1)
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected ErrInvalidLimit, got %v", err)
+	}
+	if sessions, _ := h.ListSessions("user123"); len(sessions) != 0 {
+		t.Errorf("Expected no session to be saved, got %d", len(sessions))
+	}
+}
+
+func TestMaxSessionsFetched(t *testing.T) {
+	backends := map[string]func(cfg Config) (*Heimdall, error){
+		"sqlite": newTestHeimdallWithConfig,
+		"memory": func(cfg Config) (*Heimdall, error) {
+			cfg.SessionStore = slowStore{SessionStore: store.NewMemorySessionStore()} // hides LimitedFetchStore
+			cfg.InvalidationCache = store.NewMemoryCache()
+			return New(cfg)
+		},
+	}
+	for name, newHeimdall := range backends {
+		t.Run(name, func(t *testing.T) {
+			h, err := newHeimdall(Config{MaxSessionsFetched: 3})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			device := DeviceInfo{IP: "8.8.8.8"}
+			location := LocationInfo{IP: "8.8.8.8"}
+			now := time.Now()
+			for i := 0; i < 5; i++ {
+				opts := RegisterOptions{CreatedAt: now.Add(time.Duration(i-5) * time.Minute)}
+				if _, err := h.RegisterSessionWithOptions("user123", fmt.Sprintf("session%d", i), device, location, 0, opts); err != nil {
+					t.Fatalf("Failed to register session: %v", err)
+				}
+			}
+
+			// The huge limit is lowered to the cap, which the user has reached
+			result, err := h.RegisterSession("user123", "session5", device, location, 1_000_000)
+			if err != nil {
+				t.Fatalf("Failed to register session: %v", err)
+			}
+			if !result.LimitExceeded {
+				t.Error("Expected the limit to be lowered to MaxSessionsFetched and exceeded")
+			}
+			if result.ActiveSessionCount != 3 || len(result.ActiveSessions) != 3 {
+				t.Errorf("Expected 3 fetched sessions, got %d (%d listed)", result.ActiveSessionCount, len(result.ActiveSessions))
+			}
+			if result.ActiveSessions[0].SessionID != "session4" {
+				t.Errorf("Expected the newest sessions to be fetched, got %s first", result.ActiveSessions[0].SessionID)
+			}
+		})
+	}
+}
+
+func TestMaxActiveSessionsInResult(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{MaxActiveSessionsInResult: 2})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	now := time.Now()
+
+	var result *RegisterResult
+	for i, sessionID := range []string{"session1", "session2", "session3", "session4"} {
+		opts := RegisterOptions{CreatedAt: now.Add(time.Duration(i-4) * time.Minute)}
+		result, err = h.RegisterSessionWithOptions("user123", sessionID, device, location, 0, opts)
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	if result.ActiveSessionCount != 4 {
+		t.Errorf("Expected 4 active sessions, got %d", result.ActiveSessionCount)
+	}
+	if len(result.ActiveSessions) != 2 || result.ActiveSessions[0].SessionID != "session4" || result.ActiveSessions[1].SessionID != "session3" {
+		t.Errorf("Expected [session4 session3], got %v", result.ActiveSessions)
+	}
+
+	// The limit is checked against all sessions, not the capped slice
+	result, err = h.RegisterSession("user123", "session5", device, location, 4)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !result.LimitExceeded {
+		t.Error("Expected the limit of 4 sessions to be exceeded")
+	}
+	if result.ActiveSessionCount != 4 || len(result.ActiveSessions) != 2 {
+		t.Errorf("Expected 2 of 4 active sessions, got %d of %d", len(result.ActiveSessions), result.ActiveSessionCount)
+	}
+}
+
 func TestNewLocationDetection(t *testing.T) {
 	h, err := newTestHeimdall()
 	if err != nil {
@@ -195,24 +463,1865 @@ func TestNewLocationDetection(t *testing.T) {
 	}
 }
 
-// newTestHeimdall creates a Heimdall instance with in-memory stores for testing.
-func newTestHeimdall() (*Heimdall, error) {
-	// Create temp directory for SQLite
-	tmpDir, err := os.MkdirTemp("", "heimdall-test-*")
+func TestRegisterSessionWithCreatedAt(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{SessionTTL: 24 * time.Hour})
 	if err != nil {
-		return nil, err
+		t.Fatalf("Failed to create Heimdall: %v", err)
 	}
+	defer h.Close()
 
-	sqliteStore, err := store.NewSQLite(tmpDir + "/test.db")
+	device := DeviceInfo{IP: "8.8.8.8", Browser: "Chrome", OS: "Windows"}
+	location := LocationInfo{IP: "8.8.8.8", City: "NYC", Country: "US"}
+	createdAt := time.Now().Add(-1 * time.Hour).Truncate(time.Second)
+
+	result, err := h.RegisterSessionWithOptions("user123", "session1", device, location, 0, RegisterOptions{
+		CreatedAt: createdAt,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	if !result.Session.CreatedAt.Equal(createdAt) {
+		t.Errorf("Expected CreatedAt %v, got %v", createdAt, result.Session.CreatedAt)
+	}
+
+	wantExpiry := createdAt.Add(24 * time.Hour)
+	if !result.Session.ExpiresAt().Equal(wantExpiry) {
+		t.Errorf("Expected ExpiresAt %v, got %v", wantExpiry, result.Session.ExpiresAt())
+	}
+
+	// The stored session should carry the same creation time
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %d", len(sessions))
+	}
+	if !sessions[0].ExpiresAt().Equal(wantExpiry) {
+		t.Errorf("Expected stored ExpiresAt %v, got %v", wantExpiry, sessions[0].ExpiresAt())
+	}
+}
+
+func TestRegisterSessionRejectsFutureCreatedAt(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+
+	_, err = h.RegisterSessionWithOptions("user123", "session1", device, location, 0, RegisterOptions{
+		CreatedAt: time.Now().Add(1 * time.Hour),
+	})
+	if !errors.Is(err, ErrFutureCreatedAt) {
+		t.Errorf("Expected ErrFutureCreatedAt, got %v", err)
+	}
+}
+
+func TestDiagnosticsCountsInvalidations(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	for _, id := range []string{"session1", "session2"} {
+		if _, err := h.RegisterSession("user123", id, device, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("session1"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	d, err := h.Diagnostics()
+	if err != nil {
+		t.Fatalf("Failed to get diagnostics: %v", err)
+	}
+	if d.InvalidatedEntries != 1 {
+		t.Errorf("Expected 1 invalidated entry, got %d", d.InvalidatedEntries)
+	}
+	if d.GeoIPEnabled {
+		t.Error("GeoIP should not be enabled")
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	for _, sessionID := range []string{"session1", "session2"} {
+		if _, err := h.RegisterSession("user123", sessionID, device, LocationInfo{IP: "8.8.8.8"}, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("session1"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	if err := h.Maintain(); err != nil {
+		t.Fatalf("Maintain failed: %v", err)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "session2" {
+		t.Errorf("Expected [session2] after Maintain, got %v", sessions)
+	}
+}
+
+func TestNewLocationCompareNearest(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{NewLocationComparison: CompareNearest})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	userID := "user123"
+	device := DeviceInfo{IP: "8.8.8.8", Browser: "Chrome", OS: "Windows"}
+
+	prior := []LocationInfo{
+		{City: "New York", Country: "United States", Latitude: 40.7128, Longitude: -74.0060},
+		{City: "London", Country: "United Kingdom", Latitude: 51.5074, Longitude: -0.1278},
+		{City: "Tokyo", Country: "Japan", Latitude: 35.6762, Longitude: 139.6503},
+	}
+	for i, loc := range prior {
+		if _, err := h.RegisterSession(userID, "session"+string(rune('1'+i)), device, loc, 0); err != nil {
+			t.Fatalf("Failed to register session %d: %v", i+1, err)
+		}
+	}
+
+	// Reading is ~60 km from London, but far from Tokyo (the latest session)
+	reading := LocationInfo{City: "Reading", Country: "United Kingdom", Latitude: 51.4543, Longitude: -0.9781}
+	result, err := h.RegisterSession(userID, "session4", device, reading, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.IsNewLocation {
+		t.Error("Login near an active session should not be flagged as new location")
+	}
+
+	// Sydney is far from every active session; Tokyo is the nearest
+	sydney := LocationInfo{City: "Sydney", Country: "Australia", Latitude: -33.8688, Longitude: 151.2093}
+	result, err = h.RegisterSession(userID, "session5", device, sydney, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !result.IsNewLocation {
+		t.Fatal("Login far from all active sessions should be flagged as new location")
+	}
+	if result.PreviousLocation == nil || result.PreviousLocation.City != "Tokyo" {
+		t.Errorf("PreviousLocation should be the nearest session (Tokyo), got %+v", result.PreviousLocation)
+	}
+}
+
+func TestNewLocationCompareLatestIsDefault(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	userID := "user123"
+	device := DeviceInfo{IP: "8.8.8.8", Browser: "Chrome", OS: "Windows"}
+
+	london := LocationInfo{City: "London", Country: "United Kingdom", Latitude: 51.5074, Longitude: -0.1278}
+	tokyo := LocationInfo{City: "Tokyo", Country: "Japan", Latitude: 35.6762, Longitude: 139.6503}
+	for i, loc := range []LocationInfo{london, tokyo} {
+		if _, err := h.RegisterSession(userID, "session"+string(rune('1'+i)), device, loc, 0); err != nil {
+			t.Fatalf("Failed to register session %d: %v", i+1, err)
+		}
+	}
+
+	// Compared only against Tokyo, a login from London is new
+	result, err := h.RegisterSession(userID, "session3", device, london, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !result.IsNewLocation {
+		t.Error("Login far from the latest session should be flagged as new location")
+	}
+	if result.PreviousLocation == nil || result.PreviousLocation.City != "Tokyo" {
+		t.Errorf("PreviousLocation should be the latest session (Tokyo), got %+v", result.PreviousLocation)
+	}
+}
+
+func TestLocationLearningSessions(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{LocationLearningSessions: 3})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	logins := []struct {
+		sessionID string
+		location  LocationInfo
+		wantNew   bool
+	}{
+		{"session1", LocationInfo{City: "New York", Latitude: 40.7128, Longitude: -74.0060}, false},
+		{"session2", LocationInfo{City: "London", Latitude: 51.5074, Longitude: -0.1278}, false},
+		{"session3", LocationInfo{City: "Tokyo", Latitude: 35.6762, Longitude: 139.6503}, false},
+		{"session4", LocationInfo{City: "Sydney", Latitude: -33.8688, Longitude: 151.2093}, true},
+	}
+
+	for _, l := range logins {
+		result, err := h.RegisterSession("user123", l.sessionID, device, l.location, 0)
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+		if result.IsNewLocation != l.wantNew {
+			t.Errorf("%s from %s: expected IsNewLocation %v, got %v", l.sessionID, l.location.City, l.wantNew, result.IsNewLocation)
+		}
+	}
+}
+
+func TestSameIPNeverNewLocation(t *testing.T) {
+	for _, comparison := range []LocationComparison{CompareLatest, CompareNearest, CompareCentroid} {
+		h, err := newTestHeimdallWithConfig(Config{SameIPNeverNewLocation: true, NewLocationComparison: comparison})
+		if err != nil {
+			t.Fatalf("Failed to create Heimdall: %v", err)
+		}
+		defer h.Close()
+
+		logins := []struct {
+			sessionID string
+			ip        string
+			location  LocationInfo
+			wantNew   bool
+		}{
+			{"session1", "8.8.8.8", LocationInfo{City: "New York", Latitude: 40.7128, Longitude: -74.0060}, false},
+			// Same IP, coordinates moved by a GeoIP update
+			{"session2", "8.8.8.8", LocationInfo{City: "Boston", Latitude: 42.3601, Longitude: -71.0589}, false},
+			{"session3", "8.8.4.4", LocationInfo{City: "London", Latitude: 51.5074, Longitude: -0.1278}, true},
+		}
+
+		for _, l := range logins {
+			l.location.IP = l.ip
+			device := DeviceInfo{IP: l.ip, UserAgent: "test"}
+			result, err := h.RegisterSession("user123", l.sessionID, device, l.location, 0)
+			if err != nil {
+				t.Fatalf("Failed to register session: %v", err)
+			}
+			if result.IsNewLocation != l.wantNew {
+				t.Errorf("comparison %v, %s from %s: expected IsNewLocation %v, got %v",
+					comparison, l.sessionID, l.ip, l.wantNew, result.IsNewLocation)
+			}
+		}
+	}
+}
+
+// unsortedStore is a SessionStore returning active sessions oldest first,
+// breaking the newest-first order of the built-in stores.
+type unsortedStore struct {
+	store.SessionStore
+}
+
+func (s unsortedStore) GetActiveByUser(userID string) ([]*store.Session, error) {
+	sessions, err := s.SessionStore.GetActiveByUser(userID)
 	if err != nil {
 		return nil, err
 	}
+	slices.Reverse(sessions)
+	return sessions, nil
+}
 
-	return New(Config{
-		SessionStore:           sqliteStore,
-		InvalidationCache:      sqliteStore,
-		SessionTTL:             1 * time.Hour,
-		InvalidationTTL:        24 * time.Hour,
-		NewLocationThresholdKM: 100,
+func TestNewLocationUnsortedStore(t *testing.T) {
+	h, err := New(Config{
+		SessionStore:      unsortedStore{store.NewMemorySessionStore()},
+		InvalidationCache: store.NewMemoryCache(),
 	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	logins := []struct {
+		sessionID string
+		location  LocationInfo
+		createdAt time.Time
+	}{
+		{"session1", LocationInfo{City: "New York", Latitude: 40.7128, Longitude: -74.0060}, now.Add(-2 * time.Hour)},
+		{"session2", LocationInfo{City: "London", Latitude: 51.5074, Longitude: -0.1278}, now.Add(-time.Hour)},
+	}
+	for _, l := range logins {
+		opts := RegisterOptions{CreatedAt: l.createdAt}
+		if _, err := h.RegisterSessionWithOptions("user123", l.sessionID, DeviceInfo{IP: "8.8.8.8"}, l.location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	// Near the latest session (London), far from the first one listed (New York)
+	reading := LocationInfo{City: "Reading", Latitude: 51.4543, Longitude: -0.9781}
+	result, err := h.RegisterSession("user123", "session3", DeviceInfo{IP: "8.8.8.8"}, reading, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.IsNewLocation {
+		t.Errorf("Expected Reading not to be new next to London, compared against %+v", result.PreviousLocation)
+	}
+
+	tokyo := LocationInfo{City: "Tokyo", Latitude: 35.6762, Longitude: 139.6503}
+	result, err = h.RegisterSession("user123", "session4", DeviceInfo{IP: "8.8.8.8"}, tokyo, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !result.IsNewLocation {
+		t.Fatal("Expected Tokyo to be a new location")
+	}
+	if result.PreviousLocation == nil || result.PreviousLocation.City != "Reading" {
+		t.Errorf("Expected previous location Reading, got %+v", result.PreviousLocation)
+	}
+}
+
+func TestNewLocationGrace(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{NewLocationGrace: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	newYork := LocationInfo{IP: "8.8.8.8", City: "New York", Latitude: 40.7128, Longitude: -74.0060}
+	boston := LocationInfo{IP: "8.8.4.4", City: "Boston", Latitude: 42.3601, Longitude: -71.0589}
+	now := time.Now()
+
+	logins := []struct {
+		sessionID string
+		location  LocationInfo
+		createdAt time.Time
+		wantNew   bool
+	}{
+		{"session1", newYork, now.Add(-time.Hour), false},
+		// GeoIP flipped within the grace period
+		{"session2", boston, now.Add(-time.Hour + 10*time.Second), false},
+		{"session3", newYork, now, true},
+	}
+
+	for _, l := range logins {
+		device := DeviceInfo{IP: l.location.IP, UserAgent: "test-" + l.sessionID}
+		result, err := h.RegisterSessionWithOptions("user123", l.sessionID, device, l.location, 0, RegisterOptions{
+			CreatedAt: l.createdAt,
+		})
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+		if result.IsNewLocation != l.wantNew {
+			t.Errorf("%s: expected IsNewLocation %v, got %v", l.sessionID, l.wantNew, result.IsNewLocation)
+		}
+	}
+}
+
+func TestRegisterSessionReportsExpiredSessions(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		SessionTTL:            1 * time.Hour,
+		ExpiredSessionsWindow: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	userID := "user123"
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+
+	backdated := map[string]time.Duration{
+		"recently-expired": 2 * time.Hour,  // expired an hour ago
+		"long-expired":     30 * time.Hour, // expired outside the window
+		"invalidated":      2 * time.Hour,  // expired, but was invalidated first
+	}
+	for id, age := range backdated {
+		_, err := h.RegisterSessionWithOptions(userID, id, device, location, 0, RegisterOptions{
+			CreatedAt: time.Now().Add(-age),
+		})
+		if err != nil {
+			t.Fatalf("Failed to register session %s: %v", id, err)
+		}
+	}
+	if err := h.InvalidateSession("invalidated"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	result, err := h.RegisterSession(userID, "current", device, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	if len(result.ExpiredSessions) != 1 {
+		t.Fatalf("Expected 1 expired session, got %d", len(result.ExpiredSessions))
+	}
+	if result.ExpiredSessions[0].SessionID != "recently-expired" {
+		t.Errorf("Expected recently-expired, got %s", result.ExpiredSessions[0].SessionID)
+	}
+	if len(result.ActiveSessions) != 1 {
+		t.Errorf("Expected only the new session to be active, got %d", len(result.ActiveSessions))
+	}
+}
+
+func TestListInvalidated(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	for _, id := range []string{"session1", "session2", "session3"} {
+		if _, err := h.RegisterSession("user123", id, device, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	since := time.Now().Add(-time.Minute)
+	for _, id := range []string{"session1", "session3"} {
+		if err := h.InvalidateSession(id); err != nil {
+			t.Fatalf("Failed to invalidate session: %v", err)
+		}
+	}
+
+	ids, err := h.ListInvalidated(since)
+	if err != nil {
+		t.Fatalf("Failed to list invalidations: %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, id := range ids {
+		got[id] = true
+	}
+	if len(ids) != 2 || !got["session1"] || !got["session3"] {
+		t.Errorf("Expected [session1 session3], got %v", ids)
+	}
+
+	ids, err = h.ListInvalidated(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to list invalidations: %v", err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("Expected no invalidations after a future timestamp, got %v", ids)
+	}
+}
+
+func TestDistinctIPCount(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	logins := []struct {
+		sessionID string
+		ip        string
+		age       time.Duration
+	}{
+		{"session1", "1.1.1.1", 0},
+		{"session2", "2.2.2.2", 0},
+		{"session3", "1.1.1.1", 0},             // repeated IP
+		{"session4", "3.3.3.3", 0},             // invalidated below, still counted
+		{"session5", "4.4.4.4", 2 * time.Hour}, // outside the window
+		{"session6", "5.5.5.5", 0},             // another user
+	}
+	for _, l := range logins {
+		userID := "user123"
+		if l.sessionID == "session6" {
+			userID = "user456"
+		}
+		device := DeviceInfo{IP: l.ip}
+		location := LocationInfo{IP: l.ip}
+		opts := RegisterOptions{CreatedAt: time.Now().Add(-l.age)}
+		if _, err := h.RegisterSessionWithOptions(userID, l.sessionID, device, location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("session4"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	count, err := h.DistinctIPCount("user123", time.Hour)
+	if err != nil {
+		t.Fatalf("DistinctIPCount failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 distinct IPs, got %d", count)
+	}
+
+	count, err = h.DistinctIPCount("unknown", time.Hour)
+	if err != nil {
+		t.Fatalf("DistinctIPCount failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected 0 distinct IPs for an unknown user, got %d", count)
+	}
+}
+
+// failingCache is an InvalidationCache whose writes and lookups always fail.
+type failingCache struct {
+	store.InvalidationCache
+}
+
+func (failingCache) Set(string, time.Duration) error {
+	return errors.New("cache unavailable")
+}
+
+func (failingCache) Exists(string) (bool, error) {
+	return false, errors.New("cache unavailable")
+}
+
+func TestInvalidateSessionCacheFailureKeepsSession(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		InvalidationCache: failingCache{store.NewMemoryCache()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	if _, err := h.RegisterSession("user123", "session1", device, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	if err := h.InvalidateSession("session1"); err == nil {
+		t.Fatal("Expected InvalidateSession to fail when the cache fails")
+	}
+
+	// Nothing was deleted, so the invalidation can simply be retried
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Errorf("Expected the session to remain active after a failed invalidation, got %d sessions", len(sessions))
+	}
+}
+
+func TestInvalidationCount(t *testing.T) {
+	backends := map[string]func(cfg Config) (*Heimdall, error){
+		"sqlite": newTestHeimdallWithConfig,
+		"memory": func(cfg Config) (*Heimdall, error) {
+			cfg.SessionStore = store.NewMemorySessionStore()
+			cfg.InvalidationCache = store.NewMemoryCache()
+			return New(cfg)
+		},
+	}
+	for name, newHeimdall := range backends {
+		t.Run(name, func(t *testing.T) {
+			h, err := newHeimdall(Config{})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			since := time.Now().Add(-time.Minute)
+			device := DeviceInfo{IP: "8.8.8.8"}
+			location := LocationInfo{IP: "8.8.8.8"}
+			for i := range 4 {
+				if _, err := h.RegisterSession("user123", fmt.Sprintf("session%d", i), device, location, 0); err != nil {
+					t.Fatalf("Failed to register session: %v", err)
+				}
+			}
+			for _, id := range []string{"session0", "session1", "session2"} {
+				if err := h.InvalidateSession(id); err != nil {
+					t.Fatalf("Failed to invalidate session: %v", err)
+				}
+			}
+
+			count, err := h.InvalidationCount(since)
+			if err != nil {
+				t.Fatalf("InvalidationCount failed: %v", err)
+			}
+			if count != 3 {
+				t.Errorf("Expected 3 invalidations, got %d", count)
+			}
+
+			count, err = h.InvalidationCount(time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatalf("InvalidationCount failed: %v", err)
+			}
+			if count != 0 {
+				t.Errorf("Expected no invalidations after a future timestamp, got %d", count)
+			}
+		})
+	}
+}
+
+func TestInvalidationCountUnsupported(t *testing.T) {
+	h, err := New(Config{
+		SessionStore:      slowStore{SessionStore: store.NewMemorySessionStore()},
+		InvalidationCache: countingCache{InvalidationCache: store.NewMemoryCache(), sets: new(atomic.Int32)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.InvalidationCount(time.Now()); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("Expected ErrUnsupportedStore, got %v", err)
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	for _, sessionID := range []string{"active", "loggedout"} {
+		if _, err := h.RegisterSession("user123", sessionID, device, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("loggedout"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+	opts := RegisterOptions{CreatedAt: time.Now().Add(-48 * time.Hour)}
+	if _, err := h.RegisterSessionWithOptions("user123", "expired", device, location, 0, opts); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	session, err := h.GetSession("active")
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if session.SessionID != "active" || session.UserID != "user123" {
+		t.Errorf("Expected the active session, got %+v", session)
+	}
+
+	tests := []struct {
+		sessionID string
+		wantErr   error
+	}{
+		{"loggedout", ErrSessionInvalidated},
+		{"expired", ErrSessionNotFound},
+		{"unknown", ErrSessionNotFound},
+	}
+	for _, tt := range tests {
+		session, err := h.GetSession(tt.sessionID)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("GetSession(%s): expected %v, got %v", tt.sessionID, tt.wantErr, err)
+		}
+		if session != nil {
+			t.Errorf("GetSession(%s): expected no session, got %+v", tt.sessionID, session)
+		}
+	}
+}
+
+func TestIsSessionInvalidatedOr(t *testing.T) {
+	tests := []struct {
+		name string
+		mode InvalidationFailMode
+		want bool
+	}{
+		{"FailClosed", FailClosed, true},
+		{"FailOpen", FailOpen, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := newTestHeimdallWithConfig(Config{
+				InvalidationFailMode: tt.mode,
+				InvalidationCache:    failingCache{store.NewMemoryCache()},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			if _, err := h.IsSessionInvalidated("session1"); err == nil {
+				t.Error("Expected IsSessionInvalidated to propagate the cache error")
+			}
+			if got := h.IsSessionInvalidatedOr("session1"); got != tt.want {
+				t.Errorf("IsSessionInvalidatedOr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOneSessionPerDevice(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{OneSessionPerDevice: true})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	phone := DeviceInfo{IP: "8.8.4.4", UserAgent: "Mozilla/5.0 (iPhone)"}
+	location := LocationInfo{IP: "8.8.8.8"}
+
+	for _, login := range []struct {
+		sessionID string
+		device    DeviceInfo
+	}{{"session1", laptop}, {"session2", phone}} {
+		if _, err := h.RegisterSession("user123", login.sessionID, login.device, location, 2); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	// Re-login on the laptop replaces session1 even though the limit is reached
+	result, err := h.RegisterSession("user123", "session3", laptop, location, 2)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.LimitExceeded {
+		t.Fatal("Re-login on the same device should not exceed the limit")
+	}
+	if len(result.ReplacedSessions) != 1 || result.ReplacedSessions[0].SessionID != "session1" {
+		t.Errorf("Expected session1 to be replaced, got %v", result.ReplacedSessions)
+	}
+	if len(result.ActiveSessions) != 2 {
+		t.Errorf("Expected 2 active sessions, got %d", len(result.ActiveSessions))
+	}
+
+	invalidated, err := h.IsSessionInvalidated("session1")
+	if err != nil {
+		t.Fatalf("Failed to check invalidation: %v", err)
+	}
+	if !invalidated {
+		t.Error("Replaced session should be invalidated")
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].SessionID != "session3" || sessions[1].SessionID != "session2" {
+		t.Errorf("Expected [session3 session2], got %v", sessions)
+	}
+}
+
+func TestRegisterSessionDedupeWindow(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{DedupeWindow: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	location := LocationInfo{IP: "8.8.8.8"}
+
+	first, err := h.RegisterSession("user123", "session1", laptop, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if first.Deduplicated {
+		t.Error("First login should not be deduplicated")
+	}
+
+	// A double-submit milliseconds later gets the first session back
+	second, err := h.RegisterSession("user123", "session2", laptop, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !second.Deduplicated {
+		t.Error("Expected the repeated login to be deduplicated")
+	}
+	if second.Session == nil || second.Session.SessionID != "session1" {
+		t.Errorf("Expected session1 to be returned, got %v", second.Session)
+	}
+
+	// The same device from another IP is a separate login
+	otherIP := laptop
+	otherIP.IP = "8.8.4.4"
+	third, err := h.RegisterSession("user123", "session3", otherIP, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if third.Deduplicated {
+		t.Error("Login from another IP should not be deduplicated")
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].SessionID != "session3" || sessions[1].SessionID != "session1" {
+		t.Errorf("Expected [session3 session1], got %v", sessions)
+	}
+
+	// Outside the window the device gets a new session
+	opts := RegisterOptions{CreatedAt: time.Now().Add(-time.Minute)}
+	older, err := h.RegisterSessionWithOptions("user123", "session4", laptop, location, 0, opts)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if older.Deduplicated {
+		t.Error("Login outside the window should not be deduplicated")
+	}
+}
+
+func TestRegisterSessionDedupeWindowWithHasher(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{DedupeWindow: time.Second, SessionIDHasher: SHA256SessionIDHasher})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	location := LocationInfo{IP: "8.8.8.8"}
+
+	if _, err := h.RegisterSession("user123", "session1", laptop, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	// Only the hash of session1 is stored, so the repeat gets its own session
+	second, err := h.RegisterSession("user123", "session2", laptop, location, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if second.Deduplicated || second.Session == nil || second.Session.SessionID != "session2" {
+		t.Errorf("Expected session2 to be saved, got Deduplicated %v, %+v", second.Deduplicated, second.Session)
+	}
+	if session, err := h.GetSession("session2"); err != nil || session.SessionID != "session2" {
+		t.Errorf("Expected session2 to be valid, got %+v, %v", session, err)
+	}
+}
+
+func TestInvalidateByDevice(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	phone := DeviceInfo{IP: "8.8.4.4", UserAgent: "Mozilla/5.0 (iPhone)"}
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	for _, login := range []struct {
+		sessionID string
+		device    DeviceInfo
+	}{{"phone1", phone}, {"phone2", phone}, {"laptop", laptop}} {
+		if _, err := h.RegisterSession("user123", login.sessionID, login.device, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	count, err := h.InvalidateByDevice("user123", phone.UserAgent)
+	if err != nil {
+		t.Fatalf("InvalidateByDevice failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 sessions invalidated, got %d", count)
+	}
+
+	for _, id := range []string{"phone1", "phone2"} {
+		invalidated, err := h.IsSessionInvalidated(id)
+		if err != nil {
+			t.Fatalf("Failed to check invalidation: %v", err)
+		}
+		if !invalidated {
+			t.Errorf("Expected %s to be invalidated", id)
+		}
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "laptop" {
+		t.Errorf("Expected only the laptop session to remain, got %v", sessions)
+	}
+}
+
+func TestInvalidateByDeviceType(t *testing.T) {
+	backends := map[string]func(cfg Config) (*Heimdall, error){
+		"sqlite": newTestHeimdallWithConfig,
+		"memory": func(cfg Config) (*Heimdall, error) {
+			cfg.SessionStore = store.NewMemorySessionStore()
+			cfg.InvalidationCache = store.NewMemoryCache()
+			return New(cfg)
+		},
+		"fallback": func(cfg Config) (*Heimdall, error) {
+			cfg.SessionStore = slowStore{SessionStore: store.NewMemorySessionStore()} // hides DeviceTypeStore
+			cfg.InvalidationCache = store.NewMemoryCache()
+			return New(cfg)
+		},
+	}
+	for name, newHeimdall := range backends {
+		t.Run(name, func(t *testing.T) {
+			h, err := newHeimdall(Config{})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			phone := DeviceInfo{IP: "8.8.4.4", UserAgent: "Mozilla/5.0 (iPhone)", DeviceType: DeviceMobile}
+			laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)", DeviceType: DeviceDesktop}
+			location := LocationInfo{IP: "8.8.8.8"}
+			for _, login := range []struct {
+				userID, sessionID string
+				device            DeviceInfo
+			}{
+				{"user123", "phone1", phone},
+				{"user123", "laptop1", laptop},
+				{"user456", "phone2", phone},
+				{"user456", "laptop2", laptop},
+			} {
+				if _, err := h.RegisterSession(login.userID, login.sessionID, login.device, location, 0); err != nil {
+					t.Fatalf("Failed to register session: %v", err)
+				}
+			}
+
+			count, err := h.InvalidateByDeviceType("user123", DeviceMobile)
+			if err != nil {
+				t.Fatalf("InvalidateByDeviceType failed: %v", err)
+			}
+			if count != 1 {
+				t.Errorf("Expected 1 session invalidated, got %d", count)
+			}
+
+			for id, want := range map[string]bool{"phone1": true, "laptop1": false, "phone2": false, "laptop2": false} {
+				invalidated, err := h.IsSessionInvalidated(id)
+				if err != nil {
+					t.Fatalf("Failed to check invalidation: %v", err)
+				}
+				if invalidated != want {
+					t.Errorf("IsSessionInvalidated(%s) = %v, want %v", id, invalidated, want)
+				}
+			}
+
+			if _, err := h.InvalidateByDeviceType("user123", DeviceType("phone")); !errors.Is(err, ErrInvalidDeviceType) {
+				t.Errorf("Expected ErrInvalidDeviceType, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidateAllByDeviceType(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	phone := DeviceInfo{IP: "8.8.4.4", UserAgent: "Mozilla/5.0 (iPhone)", DeviceType: DeviceMobile}
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)", DeviceType: DeviceDesktop}
+	location := LocationInfo{IP: "8.8.8.8"}
+	for _, userID := range []string{"user123", "user456"} {
+		if _, err := h.RegisterSession(userID, userID+"-phone", phone, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+		if _, err := h.RegisterSession(userID, userID+"-laptop", laptop, location, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	count, err := h.InvalidateAllByDeviceType(DeviceMobile)
+	if err != nil {
+		t.Fatalf("InvalidateAllByDeviceType failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 sessions invalidated, got %d", count)
+	}
+
+	for _, userID := range []string{"user123", "user456"} {
+		sessions, err := h.ListSessions(userID)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].Device.DeviceType != DeviceDesktop {
+			t.Errorf("Expected only the desktop session to remain for %s, got %v", userID, sessions)
+		}
+	}
+
+	h2, err := New(Config{
+		SessionStore:      slowStore{SessionStore: store.NewMemorySessionStore()},
+		InvalidationCache: store.NewMemoryCache(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h2.Close()
+	if _, err := h2.InvalidateAllByDeviceType(DeviceMobile); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("Expected ErrUnsupportedStore, got %v", err)
+	}
+}
+
+// countingStore counts Delete calls.
+type countingStore struct {
+	store.SessionStore
+	deletes *atomic.Int32
+}
+
+func (s countingStore) Delete(sessionID string) error {
+	s.deletes.Add(1)
+	return s.SessionStore.Delete(sessionID)
+}
+
+// countingCache counts Set calls.
+type countingCache struct {
+	store.InvalidationCache
+	sets *atomic.Int32
+}
+
+func (c countingCache) Set(sessionID string, ttl time.Duration) error {
+	c.sets.Add(1)
+	return c.InvalidationCache.Set(sessionID, ttl)
+}
+
+func TestInvalidateSessionOnce(t *testing.T) {
+	var deletes, sets atomic.Int32
+	sessions := store.NewMemorySessionStore()
+	cache := store.NewMemoryCache()
+	h, err := New(Config{
+		SessionStore:      countingStore{sessions, &deletes},
+		InvalidationCache: countingCache{cache, &sets},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	if _, err := h.RegisterSession("user123", "session1", device, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	already, err := h.InvalidateSessionOnce("session1")
+	if err != nil || already {
+		t.Fatalf("Expected first invalidation to succeed, got %v, %v", already, err)
+	}
+	if sets.Load() != 1 || deletes.Load() != 1 {
+		t.Errorf("Expected 1 cache write and 1 store write, got %d and %d", sets.Load(), deletes.Load())
+	}
+
+	// A retried logout writes nothing
+	already, err = h.InvalidateSessionOnce("session1")
+	if err != nil || !already {
+		t.Fatalf("Expected retry to report already invalidated, got %v, %v", already, err)
+	}
+	if err := h.InvalidateSession("session1"); err != nil {
+		t.Fatalf("InvalidateSession failed: %v", err)
+	}
+	if sets.Load() != 1 || deletes.Load() != 1 {
+		t.Errorf("Expected no additional writes, got %d cache and %d store writes", sets.Load(), deletes.Load())
+	}
+
+	// A session left in the store by a failed delete is still removed
+	if _, err := h.RegisterSession("user123", "session2", device, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if err := cache.Set("session2", time.Hour); err != nil {
+		t.Fatalf("Failed to set invalidation: %v", err)
+	}
+	already, err = h.InvalidateSessionOnce("session2")
+	if err != nil || !already {
+		t.Fatalf("Expected already invalidated, got %v, %v", already, err)
+	}
+	if exists, _ := sessions.SessionExists("session2"); exists {
+		t.Error("Expected the leftover session to be deleted")
+	}
+}
+
+func TestDedupeSessions(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	otherIP := DeviceInfo{IP: "8.8.4.4", UserAgent: laptop.UserAgent}
+	location := LocationInfo{IP: "8.8.8.8"}
+	now := time.Now()
+	for _, login := range []struct {
+		sessionID string
+		device    DeviceInfo
+		age       time.Duration
+	}{
+		{"old", laptop, time.Hour},
+		{"dup1", laptop, 2 * time.Second},
+		{"dup2", laptop, time.Second},
+		{"newest", laptop, 0},
+		{"other-ip", otherIP, time.Second},
+	} {
+		opts := RegisterOptions{CreatedAt: now.Add(-login.age)}
+		if _, err := h.RegisterSessionWithOptions("user123", login.sessionID, login.device, location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	count, err := h.DedupeSessions("user123", 10*time.Second)
+	if err != nil {
+		t.Fatalf("DedupeSessions failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 duplicates merged, got %d", count)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	remaining := map[string]bool{}
+	for _, s := range sessions {
+		remaining[s.SessionID] = true
+	}
+	for _, id := range []string{"newest", "other-ip", "old"} {
+		if !remaining[id] {
+			t.Errorf("Expected %s to remain", id)
+		}
+	}
+	if len(sessions) != 3 {
+		t.Errorf("Expected 3 sessions to remain, got %d", len(sessions))
+	}
+
+	// A second pass finds nothing left to merge
+	if count, err := h.DedupeSessions("user123", 10*time.Second); err != nil || count != 0 {
+		t.Errorf("Expected no duplicates on second pass, got %d, %v", count, err)
+	}
+}
+
+func TestRegisterSessionAddsSessionsPerDeviceByDefault(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	for _, id := range []string{"session1", "session2"} {
+		result, err := h.RegisterSession("user123", id, laptop, LocationInfo{IP: "8.8.8.8"}, 0)
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+		if len(result.ReplacedSessions) != 0 {
+			t.Errorf("Expected no replaced sessions, got %d", len(result.ReplacedSessions))
+		}
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("Expected 2 sessions, got %d", len(sessions))
+	}
+}
+
+func TestLastLoginAt(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	_, found, err := h.LastLoginAt("user123")
+	if err != nil {
+		t.Fatalf("LastLoginAt failed: %v", err)
+	}
+	if found {
+		t.Error("Expected no login history for a new user")
+	}
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	lastLogin := time.Now().Add(-3 * 24 * time.Hour).Truncate(time.Second)
+	for i, createdAt := range []time.Time{lastLogin, lastLogin.Add(-time.Hour)} {
+		opts := RegisterOptions{CreatedAt: createdAt}
+		sessionID := fmt.Sprintf("session%d", i+1)
+		if _, err := h.RegisterSessionWithOptions("user123", sessionID, device, location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	// The sessions have long expired, but still count as login history
+	got, found, err := h.LastLoginAt("user123")
+	if err != nil {
+		t.Fatalf("LastLoginAt failed: %v", err)
+	}
+	if !found {
+		t.Fatal("Expected login history")
+	}
+	if !got.Equal(lastLogin) {
+		t.Errorf("Expected last login at %v, got %v", lastLogin, got)
+	}
+}
+
+func TestLastLoginAtUnsortedStore(t *testing.T) {
+	h, err := New(Config{
+		SessionStore:      unsortedStore{store.NewMemorySessionStore()},
+		InvalidationCache: store.NewMemoryCache(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	lastLogin := time.Now().Add(-time.Minute).Truncate(time.Second)
+	for i, createdAt := range []time.Time{lastLogin.Add(-time.Hour), lastLogin} {
+		opts := RegisterOptions{CreatedAt: createdAt}
+		sessionID := fmt.Sprintf("session%d", i+1)
+		if _, err := h.RegisterSessionWithOptions("user123", sessionID, device, location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	got, found, err := h.LastLoginAt("user123")
+	if err != nil {
+		t.Fatalf("LastLoginAt failed: %v", err)
+	}
+	if !found || !got.Equal(lastLogin) {
+		t.Errorf("Expected last login at %v, got %v (found %v)", lastLogin, got, found)
+	}
+}
+
+func TestSessionsActiveAt(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	logins := []struct {
+		sessionID string
+		createdAt time.Time
+	}{
+		{"expired", now.Add(-3 * time.Hour)}, // expired 2 hours ago
+		{"active", now.Add(-30 * time.Minute)},
+		{"invalidated", now.Add(-20 * time.Minute)},
+	}
+	for _, l := range logins {
+		opts := RegisterOptions{CreatedAt: l.createdAt}
+		if _, err := h.RegisterSessionWithOptions("user123", l.sessionID, device, location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("invalidated"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want []string
+	}{
+		{"before any login", now.Add(-4 * time.Hour), nil},
+		{"during first session", now.Add(-150 * time.Minute), []string{"expired"}},
+		{"after first expired", now.Add(-25 * time.Minute), []string{"active"}},
+		{"before invalidation", now.Add(-10 * time.Minute), []string{"invalidated", "active"}},
+		{"after invalidation", now.Add(2 * time.Second), []string{"active"}},
+	}
+
+	for _, tt := range tests {
+		sessions, err := h.SessionsActiveAt("user123", tt.at)
+		if err != nil {
+			t.Fatalf("%s: SessionsActiveAt failed: %v", tt.name, err)
+		}
+		var got []string
+		for _, s := range sessions {
+			got = append(got, s.SessionID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSessionsActiveAtUnsupportedStore(t *testing.T) {
+	h, err := New(Config{
+		SessionStore:      store.NewMemorySessionStore(),
+		InvalidationCache: store.NewMemoryCache(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.SessionsActiveAt("user123", time.Now()); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("Expected ErrUnsupportedStore, got %v", err)
+	}
+}
+
+func TestExpiringSoon(t *testing.T) {
+	backends := map[string]func() (*Heimdall, error){
+		"sqlite": newTestHeimdall,
+		"memory": func() (*Heimdall, error) {
+			mem := store.NewMemoryStore(time.Hour)
+			return New(Config{SessionStore: mem, InvalidationCache: mem})
+		},
+	}
+	for name, newHeimdall := range backends {
+		t.Run(name, func(t *testing.T) {
+			h, err := newHeimdall()
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			device := DeviceInfo{IP: "8.8.8.8"}
+			location := LocationInfo{IP: "8.8.8.8"}
+			logins := []struct {
+				userID, sessionID string
+				ttl               time.Duration
+			}{
+				{"user1", "five-minutes", 5 * time.Minute},
+				{"user1", "half-hour", 30 * time.Minute},
+				{"user1", "two-hours", 2 * time.Hour},
+				{"user1", "invalidated", 5 * time.Minute},
+				{"user2", "eight-minutes", 8 * time.Minute},
+			}
+			for _, l := range logins {
+				opts := RegisterOptions{TTL: l.ttl}
+				if _, err := h.RegisterSessionWithOptions(l.userID, l.sessionID, device, location, 0, opts); err != nil {
+					t.Fatalf("Failed to register session: %v", err)
+				}
+			}
+			if err := h.InvalidateSession("invalidated"); err != nil {
+				t.Fatalf("Failed to invalidate session: %v", err)
+			}
+
+			sessions, err := h.ExpiringSoon(10 * time.Minute)
+			if err != nil {
+				t.Fatalf("ExpiringSoon failed: %v", err)
+			}
+			var ids []string
+			for _, s := range sessions {
+				ids = append(ids, s.SessionID)
+			}
+			if len(ids) != 2 || ids[0] != "five-minutes" || ids[1] != "eight-minutes" {
+				t.Errorf("Expected [five-minutes eight-minutes], got %v", ids)
+			}
+		})
+	}
+}
+
+func TestFieldCipher(t *testing.T) {
+	cipher, err := store.NewAESGCMCipher([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher failed: %v", err)
+	}
+	h, err := newTestHeimdallWithConfig(Config{FieldCipher: cipher})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "203.0.113.7", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	location := LocationInfo{IP: "203.0.113.7", City: "London", CountryCode: "GB", Latitude: 51.5074, Longitude: -0.1278}
+	if _, err := h.RegisterSession("user123", "session1", device, location, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %d", len(sessions))
+	}
+	got := sessions[0]
+	if got.Device.IP != device.IP || got.Device.UserAgent != device.UserAgent ||
+		got.Location.City != location.City || got.Location.Latitude != location.Latitude {
+		t.Errorf("Expected decrypted device and location, got %+v, %+v", got.Device, got.Location)
+	}
+
+	// Optional store interfaces that need no plaintext keep working
+	opts := RegisterOptions{GroupKey: "org1", GroupLimit: 1}
+	if _, err := h.RegisterSessionWithOptions("user456", "session2", device, location, 0, opts); err != nil {
+		t.Fatalf("Failed to register group session: %v", err)
+	}
+	result, err := h.RegisterSessionWithOptions("user789", "session3", device, location, 0, opts)
+	if err != nil {
+		t.Fatalf("Failed to register group session: %v", err)
+	}
+	if !result.LimitExceeded {
+		t.Error("Expected the group limit to be enforced through the encrypted store")
+	}
+}
+
+func TestRegisterSessionTTLBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		reject  bool
+		ttl     time.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		{"default TTL", false, 0, time.Hour, false},
+		{"within range", false, 2 * time.Hour, 2 * time.Hour, false},
+		{"too short clamped", false, time.Second, 5 * time.Minute, false},
+		{"too long clamped", false, 10 * 365 * 24 * time.Hour, 30 * 24 * time.Hour, false},
+		{"too short rejected", true, time.Second, 0, true},
+		{"too long rejected", true, 10 * 365 * 24 * time.Hour, 0, true},
+		{"negative rejected", false, -time.Hour, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := newTestHeimdallWithConfig(Config{
+				SessionTTL:          time.Hour,
+				MinSessionTTL:       5 * time.Minute,
+				MaxSessionTTL:       30 * 24 * time.Hour,
+				RejectOutOfRangeTTL: tt.reject,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			opts := RegisterOptions{TTL: tt.ttl}
+			result, err := h.RegisterSessionWithOptions("user123", "session1", DeviceInfo{IP: "8.8.8.8"}, LocationInfo{IP: "8.8.8.8"}, 0, opts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTTLOutOfRange) {
+					t.Errorf("Expected ErrTTLOutOfRange, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to register session: %v", err)
+			}
+			if got := time.Duration(result.Session.TTLSeconds) * time.Second; got != tt.want {
+				t.Errorf("Expected TTL %v, got %v", tt.want, got)
+			}
+
+			sessions, err := h.ListSessions("user123")
+			if err != nil {
+				t.Fatalf("Failed to list sessions: %v", err)
+			}
+			if len(sessions) != 1 || time.Duration(sessions[0].TTLSeconds)*time.Second != tt.want {
+				t.Errorf("Expected stored TTL %v, got %v", tt.want, sessions)
+			}
+		})
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	values := []float64{0.25, 0.75, 0, 0.9999, 0.9999}
+	h, err := newTestHeimdallWithConfig(Config{
+		SessionTTL:    time.Hour,
+		MaxSessionTTL: time.Hour + 5*time.Minute,
+		TTLJitter:     10 * time.Minute,
+		TTLJitterSource: func() float64 {
+			v := values[0]
+			values = values[1:]
+			return v
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	createdAt := time.Now().Add(-time.Minute)
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{0, 55 * time.Minute},
+		{0, 65 * time.Minute},
+		{0, 50 * time.Minute},
+		{time.Hour, time.Hour + 5*time.Minute}, // clamped to MaxSessionTTL
+		{0, 70*time.Minute - time.Second},      // the default TTL is not clamped
+	}
+	for i, tt := range tests {
+		opts := RegisterOptions{CreatedAt: createdAt, TTL: tt.ttl}
+		result, err := h.RegisterSessionWithOptions("user123", fmt.Sprintf("session%d", i), DeviceInfo{IP: "8.8.8.8"}, LocationInfo{IP: "8.8.8.8"}, 0, opts)
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+		if got := time.Duration(result.Session.TTLSeconds) * time.Second; got != tt.want {
+			t.Errorf("session%d: expected TTL %v, got %v", i, tt.want, got)
+		}
+	}
+}
+
+func TestTTLJitterDefaultSource(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{SessionTTL: time.Hour, TTLJitter: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	createdAt := time.Now()
+	for i := range 10 {
+		opts := RegisterOptions{CreatedAt: createdAt}
+		result, err := h.RegisterSessionWithOptions("user123", fmt.Sprintf("session%d", i), DeviceInfo{IP: "8.8.8.8"}, LocationInfo{IP: "8.8.8.8"}, 0, opts)
+		if err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+		expiresAt := result.Session.ExpiresAt()
+		if offset := expiresAt.Sub(createdAt.Add(time.Hour)); offset < -10*time.Minute || offset > 10*time.Minute {
+			t.Errorf("Expected expiry within 10m of the TTL, got %v off", offset)
+		}
+	}
+}
+
+func TestHasActiveSession(t *testing.T) {
+	backends := map[string]func(cfg Config) (*Heimdall, error){
+		"sqlite": newTestHeimdallWithConfig,
+		"memory": func(cfg Config) (*Heimdall, error) {
+			cfg.SessionStore = store.NewMemorySessionStore()
+			cfg.InvalidationCache = store.NewMemoryCache()
+			return New(cfg)
+		},
+		"fallback": func(cfg Config) (*Heimdall, error) {
+			cfg.SessionStore = slowStore{SessionStore: store.NewMemorySessionStore()} // hides PresenceStore
+			cfg.InvalidationCache = store.NewMemoryCache()
+			return New(cfg)
+		},
+	}
+	for name, newHeimdall := range backends {
+		t.Run(name, func(t *testing.T) {
+			h, err := newHeimdall(Config{})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			device := DeviceInfo{IP: "8.8.8.8"}
+			location := LocationInfo{IP: "8.8.8.8"}
+			if _, err := h.RegisterSession("active", "session1", device, location, 0); err != nil {
+				t.Fatalf("Failed to register session: %v", err)
+			}
+			if _, err := h.RegisterSession("loggedout", "session2", device, location, 0); err != nil {
+				t.Fatalf("Failed to register session: %v", err)
+			}
+			if err := h.InvalidateSession("session2"); err != nil {
+				t.Fatalf("Failed to invalidate session: %v", err)
+			}
+
+			for userID, want := range map[string]bool{"active": true, "loggedout": false, "nobody": false} {
+				got, err := h.HasActiveSession(userID)
+				if err != nil {
+					t.Fatalf("HasActiveSession(%s) failed: %v", userID, err)
+				}
+				if got != want {
+					t.Errorf("HasActiveSession(%s) = %v, want %v", userID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestListSessionsEmptyEncodesAsArray(t *testing.T) {
+	stores := map[string]store.SessionStore{
+		"memory": store.NewMemorySessionStore(),
+	}
+	sqliteStore, err := store.NewSQLiteMemory()
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	stores["sqlite"] = sqliteStore
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			h, err := New(Config{SessionStore: s, InvalidationCache: store.NewMemoryCache()})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			sessions, err := h.ListSessions("nobody")
+			if err != nil {
+				t.Fatalf("Failed to list sessions: %v", err)
+			}
+			if sessions == nil {
+				t.Fatal("Expected an empty, non-nil slice")
+			}
+
+			encoded, err := json.Marshal(sessions)
+			if err != nil {
+				t.Fatalf("Failed to encode sessions: %v", err)
+			}
+			if string(encoded) != "[]" {
+				t.Errorf("Expected [], got %s", encoded)
+			}
+		})
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	type ctxKey struct{}
+
+	h, err := newTestHeimdallWithConfig(Config{
+		Enricher: func(ctx context.Context, device *DeviceInfo, location *LocationInfo) {
+			if registry, ok := ctx.Value(ctxKey{}).(map[string]DeviceType); ok {
+				device.DeviceType = registry[device.UserAgent]
+			}
+			if location.City == "" {
+				location.City = "Headquarters"
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	registry := map[string]DeviceType{"CorpKiosk/1.0": DeviceConsole}
+	opts := RegisterOptions{Context: context.WithValue(context.Background(), ctxKey{}, registry)}
+	device := DeviceInfo{IP: "10.0.0.5", UserAgent: "CorpKiosk/1.0", DeviceType: "desktop"}
+	if _, err := h.RegisterSessionWithOptions("user123", "session1", device, LocationInfo{IP: "10.0.0.5"}, 0, opts); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %d", len(sessions))
+	}
+	if sessions[0].Device.DeviceType != DeviceConsole {
+		t.Errorf("Expected enriched DeviceType console, got %q", sessions[0].Device.DeviceType)
+	}
+	if sessions[0].Location.City != "Headquarters" {
+		t.Errorf("Expected enriched City Headquarters, got %q", sessions[0].Location.City)
+	}
+}
+
+func TestFilterInvalidated(t *testing.T) {
+	caches := map[string]func() store.InvalidationCache{
+		"batch":  func() store.InvalidationCache { return nil }, // SQLite store, implements ExistsMany
+		"memory": func() store.InvalidationCache { return store.NewMemoryCache() },
+		"single": func() store.InvalidationCache { return singleCache{store.NewMemoryCache()} },
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			h, err := newTestHeimdallWithConfig(Config{InvalidationCache: newCache()})
+			if err != nil {
+				t.Fatalf("Failed to create Heimdall: %v", err)
+			}
+			defer h.Close()
+
+			ids := []string{"session1", "session2", "session3", "session4"}
+			for _, id := range ids {
+				if _, err := h.RegisterSession("user123", id, DeviceInfo{IP: "8.8.8.8"}, LocationInfo{IP: "8.8.8.8"}, 0); err != nil {
+					t.Fatalf("Failed to register session: %v", err)
+				}
+			}
+			for _, id := range []string{"session4", "session2"} {
+				if err := h.InvalidateSession(id); err != nil {
+					t.Fatalf("Failed to invalidate session: %v", err)
+				}
+			}
+
+			got, err := h.FilterInvalidated(append(ids, "unknown"))
+			if err != nil {
+				t.Fatalf("FilterInvalidated failed: %v", err)
+			}
+			if fmt.Sprint(got) != "[session2 session4]" {
+				t.Errorf("Expected [session2 session4], got %v", got)
+			}
+		})
+	}
+}
+
+// singleCache hides the ExistsMany method of the cache it wraps.
+type singleCache struct {
+	store.InvalidationCache
+}
+
+func TestRegisterSessionRejectEmptyUserAgent(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{RejectEmptyUserAgent: true})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	location := LocationInfo{IP: "8.8.8.8"}
+
+	_, err = h.RegisterSession("user123", "session1", DeviceInfo{IP: "8.8.8.8", UserAgent: " "}, location, 0)
+	if !errors.Is(err, ErrMissingUserAgent) {
+		t.Errorf("Expected ErrMissingUserAgent, got %v", err)
+	}
+
+	_, err = h.RegisterSession("user123", "session2", DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0"}, location, 0)
+	if err != nil {
+		t.Errorf("Registration with a User-Agent should succeed, got %v", err)
+	}
+}
+
+func TestExtractRequestInfoTrustedProxiesForGeo(t *testing.T) {
+	geoDB := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+
+	h, err := newTestHeimdallWithConfig(Config{
+		GeoIPDatabasePath:      geoDB,
+		TrustedProxies:         []string{"10.0.0.0/8"},
+		MaxForwardedHopsForGeo: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		wantIP     string
+		wantCity   string
+	}{
+		{"direct connection is geolocated", "81.2.69.160:443", "", "81.2.69.160", "London"},
+		{"trusted proxy is geolocated", "10.0.0.5:443", "81.2.69.160", "81.2.69.160", "London"},
+		{"trusted proxy with short chain is geolocated", "10.0.0.5:443", "81.2.69.160, 10.1.1.1", "81.2.69.160", "London"},
+		{"untrusted proxy is logged but not geolocated", "198.51.100.9:443", "81.2.69.160", "81.2.69.160", ""},
+		{"long chain is logged but not geolocated", "10.0.0.5:443", "81.2.69.160, 10.1.1.1, 10.2.2.2", "81.2.69.160", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}, RemoteAddr: tt.remoteAddr}
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			device, location, err := h.ExtractRequestInfo(r)
+			if err != nil {
+				t.Fatalf("ExtractRequestInfo failed: %v", err)
+			}
+			if device.IP != tt.wantIP || location.IP != tt.wantIP {
+				t.Errorf("Expected IP %s, got device %s, location %s", tt.wantIP, device.IP, location.IP)
+			}
+			if location.City != tt.wantCity {
+				t.Errorf("Expected city %q, got %q", tt.wantCity, location.City)
+			}
+		})
+	}
+}
+
+func TestExtractRequestInfoDefaultLocation(t *testing.T) {
+	geoDB := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+
+	office := &LocationInfo{City: "Berlin", Country: "Germany", CountryCode: "DE", Latitude: 52.52, Longitude: 13.405}
+	h, err := newTestHeimdallWithConfig(Config{GeoIPDatabasePath: geoDB, DefaultLocation: office})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	tests := []struct {
+		remoteAddr string
+		wantIP     string
+		wantCity   string
+	}{
+		{"81.2.69.160:443", "81.2.69.160", "London"},
+		{"10.1.2.3:443", "10.1.2.3", "Berlin"},
+		{"192.168.0.7:443", "192.168.0.7", "Berlin"},
+		{"100.64.1.1:443", "100.64.1.1", "Berlin"},
+		{"169.254.10.10:443", "169.254.10.10", "Berlin"},
+		{"[fd12:3456::1]:443", "fd12:3456::1", "Berlin"},
+		{"[fe80::1]:443", "fe80::1", "Berlin"},
+		{"[::ffff:10.0.0.1]:443", "::ffff:10.0.0.1", "Berlin"},
+		{"8.8.8.8:443", "8.8.8.8", ""},
+	}
+
+	for _, tt := range tests {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: tt.remoteAddr}
+		_, location, err := h.ExtractRequestInfo(r)
+		if err != nil {
+			t.Fatalf("ExtractRequestInfo(%s) failed: %v", tt.remoteAddr, err)
+		}
+		if location.IP != tt.wantIP || location.City != tt.wantCity {
+			t.Errorf("ExtractRequestInfo(%s): expected %s in %q, got %s in %q",
+				tt.remoteAddr, tt.wantIP, tt.wantCity, location.IP, location.City)
+		}
+	}
+
+	if office.IP != "" {
+		t.Errorf("Expected DefaultLocation to be left unchanged, got IP %s", office.IP)
+	}
+}
+
+func TestExtractRequestInfoRequireClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		wantErr    bool
+	}{
+		{"empty remote addr", "", "", true},
+		{"malformed remote addr", "not-an-address", "", true},
+		{"non-IP host", "example.com:443", "", true},
+		{"invalid forwarded for falls back to malformed remote addr", "garbage", "not-an-ip", true},
+		{"valid forwarded for with empty remote addr", "", "203.0.113.7", false},
+		{"valid remote addr", "203.0.113.7:443", "", false},
+	}
+
+	for _, require := range []bool{false, true} {
+		h, err := newTestHeimdallWithConfig(Config{RequireClientIP: require})
+		if err != nil {
+			t.Fatalf("Failed to create Heimdall: %v", err)
+		}
+		defer h.Close()
+
+		for _, tt := range tests {
+			r := &http.Request{Header: http.Header{}, RemoteAddr: tt.remoteAddr}
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			_, _, err := h.ExtractRequestInfo(r)
+			if wantErr := require && tt.wantErr; errors.Is(err, ErrMissingClientIP) != wantErr {
+				t.Errorf("%s (RequireClientIP %v): expected ErrMissingClientIP %v, got %v", tt.name, require, wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrMissingClientIP) {
+				t.Errorf("%s (RequireClientIP %v): unexpected error %v", tt.name, require, err)
+			}
+		}
+	}
+}
+
+func TestNewRejectsInvalidTrustedProxy(t *testing.T) {
+	_, err := newTestHeimdallWithConfig(Config{TrustedProxies: []string{"not-a-network"}})
+	if err == nil {
+		t.Error("Expected an error for an invalid trusted proxy")
+	}
+}
+
+// newTestHeimdall creates a Heimdall instance with in-memory stores for testing.
+func newTestHeimdall() (*Heimdall, error) {
+	return newTestHeimdallWithConfig(Config{
+		SessionTTL:             1 * time.Hour,
+		InvalidationTTL:        24 * time.Hour,
+		NewLocationThresholdKM: 100,
+	})
+}
+
+// newTestHeimdallWithConfig creates a Heimdall instance backed by a temporary
+// SQLite database, using cfg for everything except the stores.
+func newTestHeimdallWithConfig(cfg Config) (*Heimdall, error) {
+	// Create temp directory for SQLite
+	tmpDir, err := os.MkdirTemp("", "heimdall-test-*")
+	if err != nil {
+		return nil, err
+	}
+
+	sqliteStore, err := store.NewSQLite(tmpDir + "/test.db")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.SessionStore = sqliteStore
+	if cfg.InvalidationCache == nil {
+		cfg.InvalidationCache = sqliteStore
+	}
+	return New(cfg)
 }
@@ -0,0 +1,66 @@
+package heimdall
+
+import "time"
+
+// idempotentResult is the result of a registration with an idempotency key.
+type idempotentResult struct {
+	done    chan struct{} // closed when the registration finishes
+	result  *RegisterResult
+	expires time.Time
+}
+
+// registerIdempotent calls register unless a registration with the same user
+// and key succeeded within Config.IdempotencyTTL, in which case its result
+// is returned. A registration in progress with the same key is waited for;
+// if it fails, register is called.
+func (h *Heimdall) registerIdempotent(userID, key string, register func() (*RegisterResult, error)) (*RegisterResult, error) {
+	mapKey := userID + "\x00" + key
+
+	h.idempotencyMu.Lock()
+	for {
+		prior, ok := h.idempotency[mapKey]
+		if !ok || (prior.result != nil && time.Now().After(prior.expires)) {
+			break
+		}
+		if prior.result != nil {
+			h.idempotencyMu.Unlock()
+			return prior.result, nil
+		}
+		h.idempotencyMu.Unlock()
+		<-prior.done
+		h.idempotencyMu.Lock()
+	}
+	entry := &idempotentResult{done: make(chan struct{})}
+	h.idempotency[mapKey] = entry
+	h.sweepIdempotency()
+	h.idempotencyMu.Unlock()
+
+	result, err := register()
+
+	h.idempotencyMu.Lock()
+	if err != nil || result == nil {
+		delete(h.idempotency, mapKey)
+	} else {
+		entry.result = result
+		entry.expires = time.Now().Add(h.config.IdempotencyTTL)
+	}
+	close(entry.done)
+	h.idempotencyMu.Unlock()
+
+	return result, err
+}
+
+// sweepIdempotency forgets expired idempotent results, at most once per
+// Config.IdempotencyTTL. The caller must hold idempotencyMu.
+func (h *Heimdall) sweepIdempotency() {
+	now := time.Now()
+	if now.Sub(h.idempotencySwept) < h.config.IdempotencyTTL {
+		return
+	}
+	for key, entry := range h.idempotency {
+		if entry.result != nil && now.After(entry.expires) {
+			delete(h.idempotency, key)
+		}
+	}
+	h.idempotencySwept = now
+}
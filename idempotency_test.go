@@ -0,0 +1,144 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegisterSessionIdempotencyKey(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	opts := RegisterOptions{IdempotencyKey: "login-1"}
+
+	first, err := h.RegisterSessionWithOptions("user123", "session1", device, location, 0, opts)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	// A retry after a lost response may carry a newly generated session ID
+	second, err := h.RegisterSessionWithOptions("user123", "session2", device, location, 0, opts)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	firstJSON, _ := json.Marshal(first)
+	secondJSON, _ := json.Marshal(second)
+	if string(firstJSON) != string(secondJSON) {
+		t.Errorf("Expected identical results, got %s and %s", firstJSON, secondJSON)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "session1" {
+		t.Errorf("Expected only session1, got %v", sessions)
+	}
+
+	// Keys are scoped to the user
+	other, err := h.RegisterSessionWithOptions("user456", "session3", device, location, 0, opts)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if other.Session.SessionID != "session3" {
+		t.Errorf("Expected session3 for another user, got %s", other.Session.SessionID)
+	}
+}
+
+func TestRegisterSessionIdempotencyKeyFailureNotRemembered(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	opts := RegisterOptions{IdempotencyKey: "login-1"}
+
+	if _, err := h.RegisterSessionWithOptions("user123", "session1", device, location, -1, opts); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("Expected ErrInvalidLimit, got %v", err)
+	}
+	result, err := h.RegisterSessionWithOptions("user123", "session1", device, location, 0, opts)
+	if err != nil {
+		t.Fatalf("Expected the retry to register, got %v", err)
+	}
+	if result.Session == nil || result.Session.SessionID != "session1" {
+		t.Errorf("Expected session1 to be registered, got %+v", result.Session)
+	}
+}
+
+func TestRegisterSessionIdempotencyKeyConcurrent(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	opts := RegisterOptions{IdempotencyKey: "login-1"}
+
+	results := make([]*RegisterResult, 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := h.RegisterSessionWithOptions("user123", fmt.Sprintf("session%d", i), device, location, 0, opts)
+			if err != nil {
+				t.Errorf("Failed to register session: %v", err)
+				return
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results[1:] {
+		if result != results[0] {
+			t.Fatalf("Expected every call to return the first result")
+		}
+	}
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Errorf("Expected 1 session, got %d", len(sessions))
+	}
+}
+
+func TestRegisterSessionIdempotencyTTL(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{IdempotencyTTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	opts := RegisterOptions{IdempotencyKey: "login-1"}
+
+	if _, err := h.RegisterSessionWithOptions("user123", "session1", device, location, 0, opts); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	result, err := h.RegisterSessionWithOptions("user123", "session2", device, location, 0, opts)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.Session.SessionID != "session2" {
+		t.Errorf("Expected a new session once the key expired, got %s", result.Session.SessionID)
+	}
+}
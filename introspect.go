@@ -0,0 +1,50 @@
+package heimdall
+
+import "errors"
+
+// Introspection describes a session in the shape of an RFC 7662 token
+// introspection response, for apps exposing an introspection endpoint.
+// An inactive session only has Active set, as the RFC recommends.
+type Introspection struct {
+	// Active reports whether the session is neither expired nor invalidated.
+	Active bool `json:"active"`
+
+	// Subject is the ID of the user owning the session.
+	Subject string `json:"sub,omitempty"`
+
+	// IssuedAt is when the session was created, in Unix seconds.
+	IssuedAt int64 `json:"iat,omitempty"`
+
+	// ExpiresAt is when the session expires, in Unix seconds.
+	ExpiresAt int64 `json:"exp,omitempty"`
+
+	// Device is the device the session was created from.
+	Device *DeviceInfo `json:"device,omitempty"`
+
+	// Location is where the session was created from.
+	Location *LocationInfo `json:"location,omitempty"`
+}
+
+// Introspect reports whether a session is active and, if it is, who owns it,
+// when it was issued and expires, and its device and location.
+// Unknown, expired and invalidated sessions are reported with Active false,
+// not as an error. Requires a session store implementing
+// store.SessionGetter; otherwise ErrUnsupportedStore is returned.
+func (h *Heimdall) Introspect(sessionID string) (*Introspection, error) {
+	session, err := h.GetSession(sessionID)
+	if errors.Is(err, ErrSessionInvalidated) || errors.Is(err, ErrSessionNotFound) {
+		return &Introspection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Introspection{
+		Active:    true,
+		Subject:   session.UserID,
+		IssuedAt:  session.CreatedAt.Unix(),
+		ExpiresAt: session.ExpiresAt().Unix(),
+		Device:    &session.Device,
+		Location:  &session.Location,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestIntrospect(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{SessionTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8", UserAgent: "test", DeviceType: DeviceDesktop}
+	location := LocationInfo{IP: "8.8.8.8", City: "Mountain View", CountryCode: "US"}
+	createdAt := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+
+	sessions := map[string]time.Time{
+		"active":      createdAt,
+		"invalidated": createdAt,
+		"expired":     time.Now().Add(-2 * time.Hour),
+	}
+	for id, at := range sessions {
+		_, err := h.RegisterSessionWithOptions("user123", id, device, location, 0, RegisterOptions{CreatedAt: at})
+		if err != nil {
+			t.Fatalf("Failed to register session %s: %v", id, err)
+		}
+	}
+	if err := h.InvalidateSession("invalidated"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	got, err := h.Introspect("active")
+	if err != nil {
+		t.Fatalf("Introspect failed: %v", err)
+	}
+	if !got.Active {
+		t.Fatal("Expected active session")
+	}
+	if got.Subject != "user123" {
+		t.Errorf("Expected sub user123, got %q", got.Subject)
+	}
+	if got.IssuedAt != createdAt.Unix() {
+		t.Errorf("Expected iat %d, got %d", createdAt.Unix(), got.IssuedAt)
+	}
+	if want := createdAt.Add(time.Hour).Unix(); got.ExpiresAt != want {
+		t.Errorf("Expected exp %d, got %d", want, got.ExpiresAt)
+	}
+	if got.Device == nil || got.Device.UserAgent != "test" {
+		t.Errorf("Expected device with UserAgent test, got %+v", got.Device)
+	}
+	if got.Location == nil || got.Location.City != "Mountain View" {
+		t.Errorf("Expected location Mountain View, got %+v", got.Location)
+	}
+
+	for _, id := range []string{"invalidated", "expired", "unknown"} {
+		got, err := h.Introspect(id)
+		if err != nil {
+			t.Fatalf("Introspect(%s) failed: %v", id, err)
+		}
+		encoded, err := json.Marshal(got)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		if string(encoded) != `{"active":false}` {
+			t.Errorf("Introspect(%s): expected {\"active\":false}, got %s", id, encoded)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package heimdall
+
+import (
+	"fmt"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// UserSessionCount is the number of active sessions of a user.
+type UserSessionCount struct {
+	UserID string `json:"user_id"`
+	Count  int    `json:"count"`
+}
+
+// UsersOverLimit returns the users with more than limit active sessions, most
+// sessions first, e.g. to preview who a new concurrent session limit would
+// affect before enforcing it. Requires a session store implementing
+// store.UserCountStore; otherwise ErrUnsupportedStore is returned.
+func (h *Heimdall) UsersOverLimit(limit int) ([]UserSessionCount, error) {
+	if limit < 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	countStore, ok := store.Optional[store.UserCountStore](h.sessions)
+	if !ok {
+		return nil, ErrUnsupportedStore
+	}
+
+	storeCounts, err := storeCall(h, "UsersOverLimit", func() ([]store.UserSessionCount, error) {
+		return countStore.UsersOverLimit(limit)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to count sessions by user: %w", err)
+	}
+
+	counts := make([]UserSessionCount, len(storeCounts))
+	for i, c := range storeCounts {
+		counts[i] = UserSessionCount{UserID: c.UserID, Count: c.Count}
+	}
+	return counts, nil
+}
@@ -0,0 +1,67 @@
+package heimdall
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+func TestUsersOverLimit(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+	for userID, n := range map[string]int{"heavy": 5, "over": 3, "at": 2, "under": 1} {
+		for i := range n {
+			if _, err := h.RegisterSession(userID, fmt.Sprintf("%s-%d", userID, i), device, location, 0); err != nil {
+				t.Fatalf("Failed to register session: %v", err)
+			}
+		}
+	}
+
+	// Invalidated sessions are not counted
+	if err := h.InvalidateSession("over-0"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	counts, err := h.UsersOverLimit(2)
+	if err != nil {
+		t.Fatalf("UsersOverLimit failed: %v", err)
+	}
+	want := []UserSessionCount{{UserID: "heavy", Count: 5}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("UsersOverLimit(2) = %v, want %v", counts, want)
+	}
+
+	counts, err = h.UsersOverLimit(1)
+	if err != nil {
+		t.Fatalf("UsersOverLimit failed: %v", err)
+	}
+	want = []UserSessionCount{{UserID: "heavy", Count: 5}, {UserID: "at", Count: 2}, {UserID: "over", Count: 2}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("UsersOverLimit(1) = %v, want %v", counts, want)
+	}
+
+	if _, err := h.UsersOverLimit(-1); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected ErrInvalidLimit, got %v", err)
+	}
+
+	h2, err := New(Config{
+		SessionStore:      slowStore{SessionStore: store.NewMemorySessionStore()},
+		InvalidationCache: store.NewMemoryCache(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h2.Close()
+	if _, err := h2.UsersOverLimit(2); !errors.Is(err, ErrUnsupportedStore) {
+		t.Errorf("Expected ErrUnsupportedStore, got %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package heimdall
+
+// Logger receives Heimdall's diagnostic logs. Arguments after msg are
+// alternating keys and values, e.g. Warn("GeoIP lookup failed", "ip", ip).
+// *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, keysAndValues ...any)
+	Info(msg string, keysAndValues ...any)
+	Warn(msg string, keysAndValues ...any)
+	Error(msg string, keysAndValues ...any)
+}
+
+// nopLogger discards all logs.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
@@ -0,0 +1,104 @@
+package heimdall
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// logEntry is a log recorded by recordingLogger.
+type logEntry struct {
+	level string
+	msg   string
+	kv    []any
+}
+
+// recordingLogger is a Logger that records every log.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) record(level, msg string, kv []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level, msg, kv})
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...any) { l.record("debug", msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...any)  { l.record("info", msg, kv) }
+func (l *recordingLogger) Warn(msg string, kv ...any)  { l.record("warn", msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...any) { l.record("error", msg, kv) }
+
+func (l *recordingLogger) find(level string) *logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.entries {
+		if l.entries[i].level == level {
+			return &l.entries[i]
+		}
+	}
+	return nil
+}
+
+func TestLoggerGeoIPLookupFailure(t *testing.T) {
+	geoDB := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+	logger := &recordingLogger{}
+
+	h, err := newTestHeimdallWithConfig(Config{GeoIPDatabasePath: geoDB, Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	// Lookups on a closed database fail
+	if err := h.geoip.Close(); err != nil {
+		t.Fatalf("Failed to close GeoIP database: %v", err)
+	}
+
+	r := &http.Request{Header: http.Header{}, RemoteAddr: "81.2.69.160:443"}
+	_, location, err := h.ExtractRequestInfo(r)
+	if err != nil {
+		t.Fatalf("ExtractRequestInfo failed: %v", err)
+	}
+	if location.City != "" {
+		t.Errorf("Expected no city after failed lookup, got %q", location.City)
+	}
+
+	entry := logger.find("warn")
+	if entry == nil {
+		t.Fatal("Expected a warn log for the failed GeoIP lookup")
+	}
+	fields := map[any]any{}
+	for i := 0; i+1 < len(entry.kv); i += 2 {
+		fields[entry.kv[i]] = entry.kv[i+1]
+	}
+	if fields["ip"] != "81.2.69.160" {
+		t.Errorf("Expected ip field 81.2.69.160, got %v", fields["ip"])
+	}
+	if err, _ := fields["error"].(error); err == nil {
+		t.Error("Expected error field")
+	}
+}
+
+func TestLoggerLimitExceeded(t *testing.T) {
+	logger := &recordingLogger{}
+	h, err := newTestHeimdallWithConfig(Config{Logger: logger})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "1.2.3.4", UserAgent: "test"}
+	for _, id := range []string{"session1", "session2"} {
+		if _, err := h.RegisterSession("user123", id, device, LocationInfo{}, 1); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+
+	if logger.find("info") == nil {
+		t.Error("Expected an info log when the session limit is exceeded")
+	}
+}
@@ -0,0 +1,36 @@
+package heimdall
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// Maintain runs the periodic maintenance of the session store and
+// invalidation cache, for those implementing store.Maintainer. For the
+// default SQLite store this checkpoints and truncates the write-ahead log
+// (see store.SQLiteStore.Maintain). Run it on a schedule, e.g. nightly,
+// during low traffic; other backends need no maintenance and are skipped.
+func (h *Heimdall) Maintain() error {
+	if m, ok := store.Optional[store.Maintainer](h.sessions); ok {
+		start := time.Now()
+		err := m.Maintain()
+		h.observeStore("Maintain", start)
+		if err != nil {
+			return fmt.Errorf("heimdall: failed to maintain session store: %w", err)
+		}
+	}
+
+	// The default SQLite store is both; maintain it once
+	if m, ok := h.invalidated.(store.Maintainer); ok && any(h.invalidated) != any(h.sessions) {
+		start := time.Now()
+		err := m.Maintain()
+		h.observeStore("Maintain", start)
+		if err != nil {
+			return fmt.Errorf("heimdall: failed to maintain invalidation cache: %w", err)
+		}
+	}
+
+	return nil
+}
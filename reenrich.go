@@ -0,0 +1,59 @@
+package heimdall
+
+import (
+	"fmt"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// ReEnrichSessions looks up the device IPs of all of the user's sessions in
+// the GeoIP database again and updates their stored location, e.g. after
+// updating the database or first configuring GeoIP on a deployment that
+// only recorded IPs. Expired and invalidated sessions are included if the
+// store retains them. IPs the database has no location for keep their
+// current location. It returns the number of sessions updated.
+// Requires a GeoIP database and a session store implementing
+// store.LocationUpdateStore; otherwise ErrGeoIPDatabaseNotConfigured or
+// ErrUnsupportedStore is returned.
+func (h *Heimdall) ReEnrichSessions(userID string) (int, error) {
+	if h.geoip == nil {
+		return 0, ErrGeoIPDatabaseNotConfigured
+	}
+
+	updateStore, ok := store.Optional[store.LocationUpdateStore](h.sessions)
+	if !ok {
+		return 0, ErrUnsupportedStore
+	}
+
+	ips, err := storeCall(h, "DeviceIPsByUser", func() ([]string, error) {
+		return updateStore.DeviceIPsByUser(userID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("heimdall: failed to get device IPs: %w", err)
+	}
+
+	updated := 0
+	for _, ip := range ips {
+		location, err := h.geoip.Lookup(ip)
+		if err != nil || (location.Country == "" && location.City == "") {
+			continue
+		}
+
+		loc := store.Location{
+			City:        location.City,
+			Country:     location.Country,
+			CountryCode: location.CountryCode,
+			Lat:         location.Latitude,
+			Lng:         location.Longitude,
+			Geohash:     Geohash(location.Latitude, location.Longitude, h.config.GeohashPrecision),
+		}
+		n, err := storeCall(h, "UpdateLocationByIP", func() (int, error) {
+			return updateStore.UpdateLocationByIP(userID, ip, loc)
+		})
+		if err != nil {
+			return updated, fmt.Errorf("heimdall: failed to update location: %w", err)
+		}
+		updated += n
+	}
+	return updated, nil
+}
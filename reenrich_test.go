@@ -0,0 +1,79 @@
+package heimdall
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReEnrichSessions(t *testing.T) {
+	path := writeTestGeoIPDB(t, map[string]map[string]any{
+		"81.2.69.0/24": cityRecord("London", "United Kingdom", "GB", 51.5142, -0.0931),
+	})
+
+	h, err := newTestHeimdallWithConfig(Config{GeoIPDatabasePath: path})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	// Sessions recorded before GeoIP was configured have the IP only
+	for _, l := range []struct{ sessionID, ip string }{
+		{"session1", "81.2.69.160"},
+		{"session2", "81.2.69.161"},
+		{"session3", "8.8.8.8"},
+	} {
+		device := DeviceInfo{IP: l.ip}
+		if _, err := h.RegisterSession("user123", l.sessionID, device, LocationInfo{IP: l.ip}, 0); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("session2"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	updated, err := h.ReEnrichSessions("user123")
+	if err != nil {
+		t.Fatalf("ReEnrichSessions failed: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 sessions to be updated, got %d", updated)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	for _, s := range sessions {
+		switch s.SessionID {
+		case "session1":
+			if s.Location.City != "London" || s.Location.CountryCode != "GB" || s.Location.Latitude != 51.5142 {
+				t.Errorf("Expected session1 to be located in London, got %+v", s.Location)
+			}
+		case "session3":
+			if s.Location.City != "" || s.Location.Country != "" {
+				t.Errorf("Expected session3 to stay unlocated, got %+v", s.Location)
+			}
+		}
+	}
+
+	// Sessions already up to date are not counted again
+	updated, err = h.ReEnrichSessions("user123")
+	if err != nil {
+		t.Fatalf("ReEnrichSessions failed: %v", err)
+	}
+	if updated != 0 {
+		t.Errorf("Expected no sessions to be updated, got %d", updated)
+	}
+}
+
+func TestReEnrichSessionsWithoutGeoIP(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.ReEnrichSessions("user123"); !errors.Is(err, ErrGeoIPDatabaseNotConfigured) {
+		t.Errorf("Expected ErrGeoIPDatabaseNotConfigured, got %v", err)
+	}
+}
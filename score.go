@@ -0,0 +1,105 @@
+package heimdall
+
+import "time"
+
+// ScoreWeights configures ScoreLogin: how much each risk factor adds to the
+// score, and the thresholds that trigger the location factors.
+type ScoreWeights struct {
+	// NewLocation is added if the login is farther than NewLocationKM from
+	// the previous one, as for IsNewLocation.
+	NewLocation float64 `json:"new_location"`
+
+	// NewCountry is added if the login is in another country.
+	NewCountry float64 `json:"new_country"`
+
+	// NewDevice is added if the login is from another device, compared by
+	// fingerprint, or by User-Agent if the fingerprints are missing or of
+	// different versions. Devices that cannot be compared are never counted
+	// as new.
+	NewDevice float64 `json:"new_device"`
+
+	// ImpossibleTravel is added if reaching the new location in the elapsed
+	// time would take a speed above ImpossibleSpeedKMH.
+	ImpossibleTravel float64 `json:"impossible_travel"`
+
+	// CloudProvider is added if the login comes from a cloud provider IP.
+	CloudProvider float64 `json:"cloud_provider"`
+
+	// NewLocationKM is the distance threshold for NewLocation.
+	// Zero means 100 km.
+	NewLocationKM float64 `json:"new_location_km"`
+
+	// ImpossibleSpeedKMH is the travel speed above which a login is
+	// impossible travel. Zero means 1000 km/h, faster than a commercial flight.
+	ImpossibleSpeedKMH float64 `json:"impossible_speed_kmh"`
+}
+
+// DefaultScoreWeights returns weights adding up to 1 when every factor is
+// present.
+func DefaultScoreWeights() ScoreWeights {
+	return ScoreWeights{
+		NewLocation:      0.2,
+		NewCountry:       0.2,
+		NewDevice:        0.2,
+		ImpossibleTravel: 0.3,
+		CloudProvider:    0.1,
+	}
+}
+
+// LoginScore is the risk score of a login and the factors that make it up.
+type LoginScore struct {
+	// Score is the sum of the weights of the factors present.
+	Score float64 `json:"score"`
+
+	NewLocation      bool `json:"new_location"`
+	NewCountry       bool `json:"new_country"`
+	NewDevice        bool `json:"new_device"`
+	ImpossibleTravel bool `json:"impossible_travel"`
+	CloudProvider    bool `json:"cloud_provider"`
+}
+
+// ScoreLogin scores the risk of a login at curr from currDevice, elapsed
+// after the previous login at prev from prevDevice. It only depends on its
+// arguments, so it can also score logins offline, e.g. from logs.
+func ScoreLogin(prev, curr LocationInfo, prevDevice, currDevice DeviceInfo, elapsed time.Duration, weights ScoreWeights) LoginScore {
+	newLocationKM := weights.NewLocationKM
+	if newLocationKM <= 0 {
+		newLocationKM = 100
+	}
+	impossibleSpeedKMH := weights.ImpossibleSpeedKMH
+	if impossibleSpeedKMH <= 0 {
+		impossibleSpeedKMH = 1000
+	}
+
+	var score LoginScore
+	score.NewLocation = IsNewLocation(prev, curr, newLocationKM)
+	score.NewCountry = hasCountry(prev) && hasCountry(curr) && !sameCountry(prev, curr)
+	score.NewDevice = comparableDevices(prevDevice, currDevice) && !sameDevice(prevDevice, currDevice)
+	score.CloudProvider = curr.IsCloudProvider
+
+	if score.NewLocation && hasCoordinates(prev) && hasCoordinates(curr) {
+		distance := HaversineDistance(prev.Latitude, prev.Longitude, curr.Latitude, curr.Longitude)
+		score.ImpossibleTravel = elapsed <= 0 || distance/elapsed.Hours() > impossibleSpeedKMH
+	}
+
+	for _, factor := range []struct {
+		present bool
+		weight  float64
+	}{
+		{score.NewLocation, weights.NewLocation},
+		{score.NewCountry, weights.NewCountry},
+		{score.NewDevice, weights.NewDevice},
+		{score.ImpossibleTravel, weights.ImpossibleTravel},
+		{score.CloudProvider, weights.CloudProvider},
+	} {
+		if factor.present {
+			score.Score += factor.weight
+		}
+	}
+	return score
+}
+
+// hasCountry reports whether a location has a known country.
+func hasCountry(loc LocationInfo) bool {
+	return loc.Country != "" || loc.CountryCode != ""
+}
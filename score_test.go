@@ -0,0 +1,100 @@
+package heimdall
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScoreLogin(t *testing.T) {
+	weights := ScoreWeights{
+		NewLocation:      1,
+		NewCountry:       2,
+		NewDevice:        4,
+		ImpossibleTravel: 8,
+		CloudProvider:    16,
+	}
+
+	newYork := LocationInfo{City: "New York", CountryCode: "US", Latitude: 40.7128, Longitude: -74.0060}
+	boston := LocationInfo{City: "Boston", CountryCode: "US", Latitude: 42.3601, Longitude: -71.0589}
+	toronto := LocationInfo{City: "Toronto", CountryCode: "CA", Latitude: 43.6532, Longitude: -79.3832}
+	cloud := newYork
+	cloud.IsCloudProvider = true
+
+	phone := DeviceInfo{UserAgent: "Phone/1.0"}
+	laptop := DeviceInfo{UserAgent: "Laptop/1.0"}
+
+	tests := []struct {
+		name       string
+		prev, curr LocationInfo
+		currDevice DeviceInfo
+		elapsed    time.Duration
+		want       LoginScore
+	}{
+		{"no factors", newYork, newYork, phone, time.Hour, LoginScore{}},
+		{"new location", newYork, boston, phone, 5 * time.Hour, LoginScore{Score: 1, NewLocation: true}},
+		{"new country", newYork, toronto, phone, 5 * time.Hour, LoginScore{Score: 3, NewLocation: true, NewCountry: true}},
+		{"new device", newYork, newYork, laptop, time.Hour, LoginScore{Score: 4, NewDevice: true}},
+		{"impossible travel", newYork, boston, phone, 10 * time.Minute, LoginScore{Score: 9, NewLocation: true, ImpossibleTravel: true}},
+		{"cloud provider", newYork, cloud, phone, time.Hour, LoginScore{Score: 16, CloudProvider: true}},
+		{"device without user agent", newYork, newYork, DeviceInfo{}, time.Hour, LoginScore{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScoreLogin(tt.prev, tt.curr, phone, tt.currDevice, tt.elapsed, weights)
+			if got != tt.want {
+				t.Errorf("ScoreLogin() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreLoginThresholds(t *testing.T) {
+	newYork := LocationInfo{Latitude: 40.7128, Longitude: -74.0060}
+	boston := LocationInfo{Latitude: 42.3601, Longitude: -71.0589} // about 306 km away
+	device := DeviceInfo{UserAgent: "Phone/1.0"}
+
+	score := ScoreLogin(newYork, boston, device, device, time.Hour, ScoreWeights{NewLocationKM: 500})
+	if score.NewLocation {
+		t.Error("Expected no new location within a 500 km threshold")
+	}
+
+	score = ScoreLogin(newYork, boston, device, device, time.Hour, ScoreWeights{ImpossibleSpeedKMH: 200})
+	if !score.ImpossibleTravel {
+		t.Error("Expected impossible travel above 200 km/h")
+	}
+}
+
+func TestRegisterSessionScore(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	newYork := LocationInfo{IP: "8.8.8.8", City: "New York", CountryCode: "US", Latitude: 40.7128, Longitude: -74.0060}
+	london := LocationInfo{IP: "8.8.4.4", City: "London", CountryCode: "GB", Latitude: 51.5074, Longitude: -0.1278}
+
+	result, err := h.RegisterSession("user123", "session1", DeviceInfo{IP: "8.8.8.8", UserAgent: "Phone/1.0"}, newYork, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.Score != nil {
+		t.Errorf("Expected no score for a first login, got %+v", result.Score)
+	}
+
+	result, err = h.RegisterSession("user123", "session2", DeviceInfo{IP: "8.8.4.4", UserAgent: "Laptop/1.0"}, london, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.Score == nil {
+		t.Fatal("Expected a score")
+	}
+	if !result.Score.NewLocation || !result.Score.NewCountry || !result.Score.NewDevice || !result.Score.ImpossibleTravel {
+		t.Errorf("Expected location, country, device and travel factors, got %+v", result.Score)
+	}
+	if math.Abs(result.Score.Score-0.9) > 1e-9 {
+		t.Errorf("Expected score 0.9 with the default weights, got %v", result.Score.Score)
+	}
+}
@@ -0,0 +1,80 @@
+package heimdall
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// SearchCriteria selects sessions for FindSessions.
+// At least one of IP and CountryCode must be set.
+type SearchCriteria struct {
+	// IP is an IP address or CIDR. A single IP is matched with an indexed
+	// query; a CIDR is matched in memory against all sessions selected by
+	// the other criteria, so combine it with CountryCode or a time range
+	// on large tables.
+	IP string
+
+	// CountryCode is an ISO 3166-1 alpha-2 code, e.g. "US".
+	CountryCode string
+
+	// Since and Until bound the sessions' creation time. Zero means unbounded.
+	Since time.Time
+	Until time.Time
+}
+
+// FindSessions searches sessions across all users, for incident response
+// (e.g. "all sessions from this IP"). Expired and invalidated sessions are
+// included if the store retains them. Results are ordered newest first.
+// Requires a session store implementing store.SearchStore; otherwise
+// ErrUnsupportedStore is returned.
+func (h *Heimdall) FindSessions(criteria SearchCriteria) ([]*Session, error) {
+	if criteria.IP == "" && criteria.CountryCode == "" {
+		return nil, ErrInvalidSearchCriteria
+	}
+
+	searchStore, ok := store.Optional[store.SearchStore](h.sessions)
+	if !ok {
+		return nil, ErrUnsupportedStore
+	}
+
+	filter := store.SessionFilter{
+		CountryCode:   criteria.CountryCode,
+		CreatedAfter:  criteria.Since,
+		CreatedBefore: criteria.Until,
+	}
+
+	var network *net.IPNet
+	if criteria.IP != "" {
+		var err error
+		if network, err = parseNetwork(criteria.IP); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidIP, criteria.IP)
+		}
+		if !strings.Contains(criteria.IP, "/") {
+			filter.DeviceIP = criteria.IP
+			network = nil
+		}
+	}
+
+	storeSessions, err := storeCall(h, "FindSessions", func() ([]*store.Session, error) {
+		return searchStore.FindSessions(filter)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heimdall: failed to search sessions: %w", err)
+	}
+
+	sessions := []*Session{}
+	for _, s := range storeSessions {
+		if network != nil {
+			ip := net.ParseIP(s.DeviceIP)
+			if ip == nil || !network.Contains(ip) {
+				continue
+			}
+		}
+		sessions = append(sessions, storeToSession(s))
+	}
+	return sessions, nil
+}
@@ -0,0 +1,79 @@
+package heimdall
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFindSessions(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	logins := []struct {
+		userID, sessionID, ip, countryCode string
+		age                                time.Duration
+	}{
+		{"alice", "alice1", "203.0.113.7", "US", 3 * time.Minute},
+		{"bob", "bob1", "203.0.113.7", "US", 2 * time.Minute},
+		{"bob", "bob2", "203.0.113.99", "GB", 1 * time.Minute},
+		{"carol", "carol1", "198.51.100.1", "GB", 0},
+	}
+	for _, l := range logins {
+		location := LocationInfo{IP: l.ip, CountryCode: l.countryCode}
+		opts := RegisterOptions{CreatedAt: now.Add(-l.age)}
+		if _, err := h.RegisterSessionWithOptions(l.userID, l.sessionID, DeviceInfo{IP: l.ip}, location, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("alice1"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		criteria SearchCriteria
+		want     []string
+	}{
+		{"exact IP across users", SearchCriteria{IP: "203.0.113.7"}, []string{"bob1", "alice1"}},
+		{"CIDR", SearchCriteria{IP: "203.0.113.0/24"}, []string{"bob2", "bob1", "alice1"}},
+		{"country", SearchCriteria{CountryCode: "gb"}, []string{"carol1", "bob2"}},
+		{"country and CIDR", SearchCriteria{IP: "203.0.113.0/24", CountryCode: "GB"}, []string{"bob2"}},
+		{"time range", SearchCriteria{IP: "203.0.113.7", Since: now.Add(-150 * time.Second)}, []string{"bob1"}},
+		{"no match", SearchCriteria{IP: "192.0.2.1"}, nil},
+	}
+
+	for _, tt := range tests {
+		sessions, err := h.FindSessions(tt.criteria)
+		if err != nil {
+			t.Fatalf("%s: FindSessions failed: %v", tt.name, err)
+		}
+		var got []string
+		for _, s := range sessions {
+			got = append(got, s.SessionID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestFindSessionsInvalidCriteria(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.FindSessions(SearchCriteria{Since: time.Now()}); !errors.Is(err, ErrInvalidSearchCriteria) {
+		t.Errorf("Expected ErrInvalidSearchCriteria, got %v", err)
+	}
+	if _, err := h.FindSessions(SearchCriteria{IP: "not-an-ip"}); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("Expected ErrInvalidIP, got %v", err)
+	}
+}
@@ -1,6 +1,11 @@
 package heimdall
 
-import "time"
+import (
+	"context"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
 
 // Session represents an active user session.
 type Session struct {
@@ -8,8 +13,14 @@ type Session struct {
 	UserID     string       `json:"user_id"`
 	Device     DeviceInfo   `json:"device"`
 	Location   LocationInfo `json:"location"`
+	GroupKey   string       `json:"group_key,omitempty"`
 	CreatedAt  time.Time    `json:"created_at"`
 	TTLSeconds int64        `json:"ttl_seconds"`
+
+	// StoredExpiresAt is the expiry time as stored by the session store,
+	// which may differ from CreatedAt plus the TTL if the database clock
+	// disagrees with the application's. Zero if the store does not keep it.
+	StoredExpiresAt time.Time `json:"expires_at,omitzero"`
 }
 
 // IsExpired returns true if the session has expired based on its TTL.
@@ -17,34 +28,81 @@ func (s *Session) IsExpired() bool {
 	return time.Now().After(s.ExpiresAt())
 }
 
-// ExpiresAt returns the time when this session expires.
+// ExpiresAt returns the time when this session expires: StoredExpiresAt if
+// set, otherwise CreatedAt plus the TTL.
 func (s *Session) ExpiresAt() time.Time {
+	if !s.StoredExpiresAt.IsZero() {
+		return s.StoredExpiresAt
+	}
 	return s.CreatedAt.Add(time.Duration(s.TTLSeconds) * time.Second)
 }
 
+// IsActive reports whether the session is neither expired nor invalidated in
+// cache. The cache is keyed by stored ID, so with Config.SessionIDHasher set
+// this only works for sessions whose SessionID is the stored ID.
+func (s *Session) IsActive(cache store.InvalidationCache) (bool, error) {
+	if s.IsExpired() {
+		return false, nil
+	}
+	invalidated, err := cache.Exists(s.SessionID)
+	if err != nil {
+		return false, err
+	}
+	return !invalidated, nil
+}
+
 // DeviceInfo contains device information extracted from the HTTP request.
 type DeviceInfo struct {
-	IP         string `json:"ip"`
-	UserAgent  string `json:"user_agent"`
-	Browser    string `json:"browser"`
-	OS         string `json:"os"`
-	DeviceType string `json:"device_type"` // mobile, desktop, tablet
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Browser    string     `json:"browser"`
+	OS         string     `json:"os"`
+	DeviceType DeviceType `json:"device_type"`
+
+	// Fingerprint identifies the device, versioned by the algorithm that
+	// produced it. Set from Config.DeviceFingerprinter if empty.
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 // LocationInfo contains geographic location extracted from IP address.
 type LocationInfo struct {
-	IP        string  `json:"ip"`
-	City      string  `json:"city"`
-	Country   string  `json:"country"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	IP          string  `json:"ip"`
+	City        string  `json:"city"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"country_code"` // ISO 3166-1 alpha-2, e.g. "US"
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+
+	// Geohash encodes Latitude and Longitude at Config.GeohashPrecision,
+	// for grouping sessions by area. See SameArea.
+	Geohash string `json:"geohash,omitempty"`
+
+	// ASN is the autonomous system number of the network the IP belongs
+	// to, from Config.ASNDatabasePath or an Enricher. 0 if unknown.
+	ASN uint `json:"asn,omitempty"`
+
+	// IsEU reports whether the IP is located in a European Union member
+	// state, for consent and data-residency flows. It reflects the GeoIP
+	// lookup at request time and is not persisted with the session.
+	IsEU bool `json:"is_eu,omitempty"`
+
+	// IsCloudProvider reports whether the IP belongs to a cloud provider
+	// range loaded with Heimdall.LoadCloudRanges. Like IsEU, it is set at
+	// request time and not persisted.
+	IsCloudProvider bool `json:"is_cloud_provider,omitempty"`
 }
 
 // RegisterResult is returned from RegisterSession with session info and alerts.
 type RegisterResult struct {
-	// Session is the newly created session. Nil if LimitExceeded is true.
+	// Session is the newly created session, or the existing one if
+	// Deduplicated is true. Nil if LimitExceeded is true.
 	Session *Session `json:"session,omitempty"`
 
+	// Deduplicated is true if the login repeated one within
+	// Config.DedupeWindow and Session is the session created then, as read
+	// back from the store. No new session was saved.
+	Deduplicated bool `json:"deduplicated"`
+
 	// IsNewLocation is true if the user is logging in from an unusual location.
 	IsNewLocation bool `json:"is_new_location"`
 
@@ -52,10 +110,95 @@ type RegisterResult struct {
 	// Only set if IsNewLocation is true.
 	PreviousLocation *LocationInfo `json:"previous_location,omitempty"`
 
-	// ActiveSessions contains all active sessions for this user.
+	// IsNewDevice is true if none of the user's other active sessions
+	// use the same device, compared by DeviceInfo.Fingerprint, or by
+	// User-Agent for sessions without one.
+	IsNewDevice bool `json:"is_new_device"`
+
+	// IsNewCountry is true if none of the user's other active sessions
+	// are in the same country.
+	IsNewCountry bool `json:"is_new_country"`
+
+	// IsNewASN is true if none of the user's other active sessions are on
+	// the same network (ASN). Logins and sessions without an ASN are
+	// ignored.
+	IsNewASN bool `json:"is_new_asn"`
+
+	// Score is the risk score of this login against the user's latest
+	// active session, as computed by ScoreLogin with Config.ScoreWeights.
+	// Nil if the user had no active sessions.
+	Score *LoginScore `json:"score,omitempty"`
+
+	// RequiresStepUp is the decision of Config.StepUpPolicy for this login:
+	// true if the app should ask for additional verification.
+	RequiresStepUp bool `json:"requires_step_up"`
+
+	// ActiveSessions contains the active sessions for this user, newest
+	// first. It is truncated to Config.MaxActiveSessionsInResult if set.
 	ActiveSessions []*Session `json:"active_sessions"`
 
+	// ActiveSessionCount is the number of active sessions for this user,
+	// including any left out of ActiveSessions, up to
+	// Config.MaxSessionsFetched.
+	ActiveSessionCount int `json:"active_session_count"`
+
+	// ExpiredSessions contains sessions that expired naturally within
+	// Config.ExpiredSessionsWindow. Only set when the window is configured
+	// and the session store implements store.ExpiredSessionStore.
+	ExpiredSessions []*Session `json:"expired_sessions,omitempty"`
+
+	// ReplacedSessions contains the sessions on the same device that were
+	// invalidated to make room for this one. Only set when
+	// Config.OneSessionPerDevice is enabled.
+	ReplacedSessions []*Session `json:"replaced_sessions,omitempty"`
+
 	// LimitExceeded is true if the concurrent session limit was exceeded.
 	// When true, the new session was NOT saved.
 	LimitExceeded bool `json:"limit_exceeded"`
+
+	// LimitWarning is true if the login took the user past
+	// Config.SoftConcurrentLimit. The session was saved.
+	LimitWarning bool `json:"limit_warning"`
+
+	// Event consolidates the signals above into a single payload.
+	Event LoginEvent `json:"event"`
+}
+
+// RegisterOptions contains optional parameters for RegisterSessionWithOptions.
+type RegisterOptions struct {
+	// CreatedAt overrides the creation time of the session, e.g. when importing
+	// historical sessions or rebuilding state after a crash.
+	// The session expires at CreatedAt + SessionTTL.
+	// Zero means time.Now(). Future timestamps are rejected with ErrFutureCreatedAt.
+	CreatedAt time.Time
+
+	// TTL overrides Config.SessionTTL for this session, e.g. for
+	// "remember me" logins. It is subject to Config.MinSessionTTL and
+	// Config.MaxSessionTTL. Zero means Config.SessionTTL.
+	TTL time.Duration
+
+	// Context is passed to Config.Enricher. Nil means context.Background().
+	Context context.Context
+
+	// GroupKey assigns the session to a group of users sharing a session
+	// limit, e.g. an organization ID. It is stored with the session.
+	GroupKey string
+
+	// GroupLimit is the maximum number of active sessions across all users
+	// with the same GroupKey. If reached, the session is rejected like for
+	// the per-user concurrentLimit, which still applies. Requires a session
+	// store implementing store.GroupCountStore; otherwise ErrUnsupportedStore
+	// is returned. Zero means no group limit.
+	GroupLimit int
+
+	// IdempotencyKey, if set, makes retries safe: a repeated call for the
+	// same user with the same key within Config.IdempotencyTTL returns the
+	// result of the first successful call instead of registering again.
+	// The other arguments of the repeated call are not compared: a call
+	// reusing a key with a different session ID, device or location still
+	// gets the first call's result, so keys must be unique per attempt.
+	// Concurrent calls with the same key wait for the first to finish.
+	// Keys are remembered in memory, so retries must reach the same
+	// Heimdall instance. Not supported by RegisterSessions.
+	IdempotencyKey string
 }
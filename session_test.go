@@ -0,0 +1,40 @@
+package heimdall
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+func TestSessionIsActive(t *testing.T) {
+	cache := store.NewMemoryCache()
+	defer cache.Close()
+
+	if err := cache.Set("invalidated", time.Hour); err != nil {
+		t.Fatalf("Failed to set invalidation: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		sessionID string
+		createdAt time.Time
+		want      bool
+	}{
+		{"active", "active", time.Now(), true},
+		{"expired but not invalidated", "expired", time.Now().Add(-2 * time.Hour), false},
+		{"invalidated but not expired", "invalidated", time.Now(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{SessionID: tt.sessionID, CreatedAt: tt.createdAt, TTLSeconds: 3600}
+			active, err := s.IsActive(cache)
+			if err != nil {
+				t.Fatalf("IsActive failed: %v", err)
+			}
+			if active != tt.want {
+				t.Errorf("Expected IsActive %v, got %v", tt.want, active)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package heimdall
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SessionIDGenerator returns a new, unique session ID.
+type SessionIDGenerator func() string
+
+// SessionIDValidator reports whether sessionID is well-formed.
+type SessionIDValidator func(sessionID string) bool
+
+// SessionIDHasher maps a session ID to the key it is stored under.
+type SessionIDHasher func(sessionID string) string
+
+// SHA256SessionIDHasher returns the hex-encoded SHA-256 of sessionID.
+// Use it when session IDs are bearer tokens, so a leaked database does not
+// leak live sessions.
+func SHA256SessionIDHasher(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
+}
+
+// DefaultSessionIDGenerator returns 32 random bytes, hex encoded.
+func DefaultSessionIDGenerator() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic("heimdall: failed to generate session ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
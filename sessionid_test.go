@@ -0,0 +1,130 @@
+package heimdall
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func TestDefaultSessionIDGenerator(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := DefaultSessionIDGenerator()
+		if len(id) != 64 {
+			t.Fatalf("Expected a 64 character ID, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate session ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestBeginSession(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		SessionIDGenerator: newUUID,
+		SessionIDValidator: uuidPattern.MatchString,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	result, err := h.BeginSession("user123", DeviceInfo{IP: "8.8.8.8"}, LocationInfo{IP: "8.8.8.8"}, 0)
+	if err != nil {
+		t.Fatalf("BeginSession failed: %v", err)
+	}
+	if result.Session == nil || !uuidPattern.MatchString(result.Session.SessionID) {
+		t.Fatalf("Expected a session with a UUID, got %+v", result.Session)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != result.Session.SessionID {
+		t.Errorf("Expected the generated session to be stored, got %v", sessions)
+	}
+}
+
+func TestSessionIDValidator(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		SessionIDValidator: func(sessionID string) bool {
+			return len(sessionID) >= 16
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{IP: "8.8.8.8"}
+	location := LocationInfo{IP: "8.8.8.8"}
+
+	if _, err := h.RegisterSession("user123", "short", device, location, 0); !errors.Is(err, ErrInvalidSessionID) {
+		t.Errorf("Expected ErrInvalidSessionID for a short ID, got %v", err)
+	}
+	if _, err := h.RegisterSession("user123", "a-long-enough-session-id", device, location, 0); err != nil {
+		t.Errorf("Expected a long ID to be accepted, got %v", err)
+	}
+}
+
+func TestSessionIDHasher(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{SessionIDHasher: SHA256SessionIDHasher})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	const token = "raw-bearer-token"
+	device := DeviceInfo{IP: "8.8.8.8"}
+	result, err := h.RegisterSession("user123", token, device, LocationInfo{IP: "8.8.8.8"}, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if result.Session.SessionID != token {
+		t.Errorf("Expected the new session to carry the raw ID, got %q", result.Session.SessionID)
+	}
+
+	sessions, err := h.ListSessions("user123")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %d", len(sessions))
+	}
+	if sessions[0].SessionID == token || sessions[0].SessionID != SHA256SessionIDHasher(token) {
+		t.Errorf("Expected the stored ID to be the SHA-256 of the token, got %q", sessions[0].SessionID)
+	}
+
+	// Lookups by raw ID hash first
+	if _, err := h.CheckSessionBinding(token, "8.8.8.8"); err != nil {
+		t.Errorf("CheckSessionBinding by raw ID failed: %v", err)
+	}
+	if err := h.InvalidateSession(token); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+	invalidated, err := h.IsSessionInvalidated(token)
+	if err != nil {
+		t.Fatalf("Failed to check invalidation: %v", err)
+	}
+	if !invalidated {
+		t.Error("Expected the session to be invalidated by its raw ID")
+	}
+	if sessions, _ := h.ListSessions("user123"); len(sessions) != 0 {
+		t.Errorf("Expected no active sessions, got %d", len(sessions))
+	}
+}
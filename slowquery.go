@@ -0,0 +1,20 @@
+package heimdall
+
+import "time"
+
+// SlowQueryHandler is called for session store and invalidation cache calls
+// that take longer than Config.SlowQueryThreshold. op is the name of the
+// store method, e.g. "GetActiveByUser". It is called synchronously on the
+// request path, so implementations should not block.
+type SlowQueryHandler func(op string, d time.Duration)
+
+// observeStore reports the store call op, started at start, to the
+// SlowQueryHandler if it exceeded the SlowQueryThreshold.
+func (h *Heimdall) observeStore(op string, start time.Time) {
+	if h.config.SlowQueryHandler == nil || h.config.SlowQueryThreshold <= 0 {
+		return
+	}
+	if d := time.Since(start); d > h.config.SlowQueryThreshold {
+		h.config.SlowQueryHandler(op, d)
+	}
+}
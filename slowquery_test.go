@@ -0,0 +1,70 @@
+package heimdall
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// slowStore is a SessionStore whose GetActiveByUser takes at least delay.
+type slowStore struct {
+	store.SessionStore
+	delay time.Duration
+}
+
+func (s slowStore) GetActiveByUser(userID string) ([]*store.Session, error) {
+	time.Sleep(s.delay)
+	return s.SessionStore.GetActiveByUser(userID)
+}
+
+func TestSlowQueryHandler(t *testing.T) {
+	var ops []string
+	h, err := New(Config{
+		SessionStore:       slowStore{store.NewMemorySessionStore(), 20 * time.Millisecond},
+		InvalidationCache:  store.NewMemoryCache(),
+		SlowQueryThreshold: 10 * time.Millisecond,
+		SlowQueryHandler: func(op string, d time.Duration) {
+			if d < 20*time.Millisecond {
+				t.Errorf("%s: expected a duration of at least 20ms, got %v", op, d)
+			}
+			ops = append(ops, op)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.RegisterSession("user123", "session1", DeviceInfo{IP: "8.8.8.8"}, LocationInfo{}, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if _, err := h.IsSessionInvalidated("session1"); err != nil {
+		t.Fatalf("Failed to check invalidation: %v", err)
+	}
+
+	// Only the slow lookup is reported, not the fast Save and Exists calls
+	if len(ops) != 1 || ops[0] != "GetActiveByUser" {
+		t.Errorf("Expected [GetActiveByUser], got %v", ops)
+	}
+}
+
+func TestSlowQueryHandlerDisabledWithoutThreshold(t *testing.T) {
+	called := false
+	h, err := New(Config{
+		SessionStore:      slowStore{store.NewMemorySessionStore(), time.Millisecond},
+		InvalidationCache: store.NewMemoryCache(),
+		SlowQueryHandler:  func(string, time.Duration) { called = true },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if _, err := h.ListSessions("user123"); err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if called {
+		t.Error("Expected no slow query reports without a threshold")
+	}
+}
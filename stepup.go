@@ -0,0 +1,79 @@
+package heimdall
+
+// StepUpPolicy decides whether a login should require additional verification
+// (e.g. MFA) based on the signals computed by RegisterSession.
+type StepUpPolicy func(result *RegisterResult) bool
+
+// DefaultStepUpPolicy requires step-up when a login is impossible travel
+// from the user's latest session (see RegisterResult.Score), OR comes from a
+// device the user has no active session on AND from a country they have no
+// active session in.
+func DefaultStepUpPolicy(result *RegisterResult) bool {
+	if result.Score != nil && result.Score.ImpossibleTravel {
+		return true
+	}
+	return result.IsNewDevice && result.IsNewCountry
+}
+
+// isNewDevice reports whether device matches none of the sessions' devices.
+// Devices are compared by fingerprint if both have one, otherwise by
+// User-Agent. Sessions whose fingerprint has another version are skipped,
+// so changing the algorithm makes devices unknown rather than new.
+// Returns false if no session could be compared.
+func isNewDevice(sessions []*Session, device DeviceInfo) bool {
+	compared := false
+	for _, s := range sessions {
+		if s.Device.Fingerprint != "" && device.Fingerprint != "" {
+			switch compareFingerprints(s.Device.Fingerprint, device.Fingerprint) {
+			case fingerprintSame:
+				return false
+			case fingerprintUnknown:
+				continue
+			}
+		} else if s.Device.UserAgent == device.UserAgent {
+			return false
+		}
+		compared = true
+	}
+	return compared
+}
+
+// sameDevice reports whether a and b are the same device. Devices are
+// compared by fingerprint if both have one of the same version, otherwise by
+// User-Agent; devices without a User-Agent are then never the same.
+func sameDevice(a, b DeviceInfo) bool {
+	switch compareFingerprints(a.Fingerprint, b.Fingerprint) {
+	case fingerprintSame:
+		return true
+	case fingerprintDifferent:
+		return false
+	}
+	return a.UserAgent != "" && a.UserAgent == b.UserAgent
+}
+
+// comparableDevices reports whether sameDevice can tell a and b apart: both
+// have fingerprints of the same version, or both have a User-Agent.
+func comparableDevices(a, b DeviceInfo) bool {
+	return compareFingerprints(a.Fingerprint, b.Fingerprint) != fingerprintUnknown ||
+		(a.UserAgent != "" && b.UserAgent != "")
+}
+
+// isNewCountry reports whether location is in a country none of the sessions
+// are in. Sessions and locations without a known country are ignored.
+func isNewCountry(sessions []*Session, location LocationInfo) bool {
+	if location.Country == "" && location.CountryCode == "" {
+		return false
+	}
+
+	known := false
+	for _, s := range sessions {
+		if s.Location.Country == "" && s.Location.CountryCode == "" {
+			continue
+		}
+		known = true
+		if sameCountry(s.Location, location) {
+			return false
+		}
+	}
+	return known
+}
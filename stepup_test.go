@@ -0,0 +1,100 @@
+package heimdall
+
+import "testing"
+
+func TestDefaultStepUpPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		result RegisterResult
+		want   bool
+	}{
+		{"no signals", RegisterResult{}, false},
+		{"new device only", RegisterResult{IsNewDevice: true}, false},
+		{"new country only", RegisterResult{IsNewCountry: true, IsNewLocation: true}, false},
+		{"new device and new country", RegisterResult{IsNewDevice: true, IsNewCountry: true}, true},
+		{"new location on new device in same country", RegisterResult{IsNewDevice: true, IsNewLocation: true}, false},
+		{"impossible travel only", RegisterResult{IsNewLocation: true, Score: &LoginScore{ImpossibleTravel: true}}, true},
+		{"scored without impossible travel", RegisterResult{IsNewDevice: true, Score: &LoginScore{NewDevice: true}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultStepUpPolicy(&tt.result); got != tt.want {
+				t.Errorf("DefaultStepUpPolicy(%+v) = %v, want %v", tt.result, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterSessionStepUpSignals(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	userID := "user123"
+	laptop := DeviceInfo{IP: "8.8.8.8", UserAgent: "Mozilla/5.0 (Windows NT 10.0)"}
+	phone := DeviceInfo{IP: "8.8.4.4", UserAgent: "Mozilla/5.0 (iPhone)"}
+	// No coordinates: consecutive logins would otherwise be impossible travel
+	nyc := LocationInfo{City: "New York", Country: "United States", CountryCode: "US"}
+	boston := LocationInfo{City: "Boston", Country: "United States", CountryCode: "US"}
+	london := LocationInfo{City: "London", Country: "United Kingdom", CountryCode: "GB"}
+
+	steps := []struct {
+		name        string
+		device      DeviceInfo
+		location    LocationInfo
+		wantDevice  bool
+		wantCountry bool
+		wantStepUp  bool
+	}{
+		{"first login has no history", laptop, nyc, false, false, false},
+		{"new device in same country", phone, boston, true, false, false},
+		{"known device in new country", laptop, london, false, true, false},
+		{"new device in new country", DeviceInfo{UserAgent: "curl/8.0"}, LocationInfo{Country: "Japan", CountryCode: "JP"}, true, true, true},
+	}
+
+	for i, step := range steps {
+		result, err := h.RegisterSession(userID, "session"+string(rune('1'+i)), step.device, step.location, 0)
+		if err != nil {
+			t.Fatalf("%s: failed to register session: %v", step.name, err)
+		}
+		if result.IsNewDevice != step.wantDevice {
+			t.Errorf("%s: IsNewDevice = %v, want %v", step.name, result.IsNewDevice, step.wantDevice)
+		}
+		if result.IsNewCountry != step.wantCountry {
+			t.Errorf("%s: IsNewCountry = %v, want %v", step.name, result.IsNewCountry, step.wantCountry)
+		}
+		if result.RequiresStepUp != step.wantStepUp {
+			t.Errorf("%s: RequiresStepUp = %v, want %v", step.name, result.RequiresStepUp, step.wantStepUp)
+		}
+	}
+}
+
+func TestCustomStepUpPolicy(t *testing.T) {
+	h, err := newTestHeimdallWithConfig(Config{
+		StepUpPolicy: func(result *RegisterResult) bool {
+			return result.IsNewLocation
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	device := DeviceInfo{UserAgent: "Mozilla/5.0"}
+	nyc := LocationInfo{City: "New York", Country: "United States", Latitude: 40.7128, Longitude: -74.0060}
+	la := LocationInfo{City: "Los Angeles", Country: "United States", Latitude: 34.0522, Longitude: -118.2437}
+
+	if _, err := h.RegisterSession("user123", "session1", device, nyc, 0); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	result, err := h.RegisterSession("user123", "session2", device, la, 0)
+	if err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+	if !result.RequiresStepUp {
+		t.Error("Custom policy should require step-up for a new location")
+	}
+}
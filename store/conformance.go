@@ -0,0 +1,546 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// RunSessionStoreConformance runs a suite of tests that every SessionStore
+// implementation is expected to pass. Use it to validate custom backends:
+//
+//	func TestMyStore(t *testing.T) {
+//		store.RunSessionStoreConformance(t, func() store.SessionStore {
+//			return newMyStore(t)
+//		})
+//	}
+//
+// newStore must return a new, empty store each time it is called.
+// The suite closes every store it creates.
+func RunSessionStoreConformance(t *testing.T, newStore func() SessionStore) {
+	t.Helper()
+
+	open := func(t *testing.T) SessionStore {
+		t.Helper()
+		s := newStore()
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+
+	t.Run("UnknownUserHasNoSessions", func(t *testing.T) {
+		s := open(t)
+
+		sessions, err := s.GetActiveByUser("nobody")
+		if err != nil {
+			t.Fatalf("GetActiveByUser failed: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("Expected no sessions, got %d", len(sessions))
+		}
+		if sessions == nil {
+			t.Error("Expected an empty, non-nil slice")
+		}
+	})
+
+	t.Run("SaveRoundTrip", func(t *testing.T) {
+		s := open(t)
+
+		want := conformanceSession("session1", "user1", time.Now())
+		mustSave(t, s, want)
+
+		sessions := mustGetActive(t, s, "user1", 1)
+		got := sessions[0]
+		if got.SessionID != want.SessionID || got.UserID != want.UserID {
+			t.Errorf("Expected session %s for %s, got %s for %s",
+				want.SessionID, want.UserID, got.SessionID, got.UserID)
+		}
+		if got.DeviceIP != want.DeviceIP || got.DeviceUA != want.DeviceUA ||
+			got.Browser != want.Browser || got.OS != want.OS || got.DeviceType != want.DeviceType ||
+			got.DeviceFingerprint != want.DeviceFingerprint {
+			t.Errorf("Device fields not preserved: got %+v, want %+v", got, want)
+		}
+		if got.LocCity != want.LocCity || got.LocCountry != want.LocCountry ||
+			got.LocCountryCode != want.LocCountryCode || got.LocGeohash != want.LocGeohash ||
+			got.LocASN != want.LocASN {
+			t.Errorf("Location fields not preserved: got %+v, want %+v", got, want)
+		}
+		if got.LocLat != want.LocLat || got.LocLng != want.LocLng {
+			t.Errorf("Coordinates not preserved: got (%v, %v), want (%v, %v)",
+				got.LocLat, got.LocLng, want.LocLat, want.LocLng)
+		}
+		if got.GroupKey != want.GroupKey {
+			t.Errorf("Expected GroupKey %q, got %q", want.GroupKey, got.GroupKey)
+		}
+		if got.TTLSeconds != want.TTLSeconds {
+			t.Errorf("Expected TTLSeconds %d, got %d", want.TTLSeconds, got.TTLSeconds)
+		}
+		if diff := got.CreatedAt.Sub(want.CreatedAt); diff > time.Second || diff < -time.Second {
+			t.Errorf("Expected CreatedAt %v, got %v", want.CreatedAt, got.CreatedAt)
+		}
+	})
+
+	t.Run("SaveOverwritesSameID", func(t *testing.T) {
+		s := open(t)
+
+		first := conformanceSession("session1", "user1", time.Now().Add(-time.Minute))
+		mustSave(t, s, first)
+
+		second := conformanceSession("session1", "user1", time.Now())
+		second.DeviceIP = "1.1.1.1"
+		mustSave(t, s, second)
+
+		sessions := mustGetActive(t, s, "user1", 1)
+		if sessions[0].DeviceIP != "1.1.1.1" {
+			t.Errorf("Expected overwritten DeviceIP 1.1.1.1, got %s", sessions[0].DeviceIP)
+		}
+	})
+
+	t.Run("OrderedNewestFirst", func(t *testing.T) {
+		s := open(t)
+
+		now := time.Now()
+		mustSave(t, s, conformanceSession("middle", "user1", now.Add(-2*time.Minute)))
+		mustSave(t, s, conformanceSession("newest", "user1", now.Add(-1*time.Minute)))
+		mustSave(t, s, conformanceSession("oldest", "user1", now.Add(-3*time.Minute)))
+
+		sessions := mustGetActive(t, s, "user1", 3)
+		for i, want := range []string{"newest", "middle", "oldest"} {
+			if sessions[i].SessionID != want {
+				t.Errorf("Expected sessions[%d] to be %s, got %s", i, want, sessions[i].SessionID)
+			}
+		}
+	})
+
+	t.Run("ExpiredSessionsExcluded", func(t *testing.T) {
+		s := open(t)
+
+		mustSave(t, s, conformanceSession("active", "user1", time.Now()))
+		mustSave(t, s, conformanceSession("expired", "user1", time.Now().Add(-2*time.Hour)))
+
+		sessions := mustGetActive(t, s, "user1", 1)
+		if sessions[0].SessionID != "active" {
+			t.Errorf("Expected only the active session, got %s", sessions[0].SessionID)
+		}
+
+		exists, err := s.SessionExists("expired")
+		if err != nil {
+			t.Fatalf("SessionExists failed: %v", err)
+		}
+		if exists {
+			t.Error("SessionExists should be false for an expired session")
+		}
+	})
+
+	t.Run("DeleteExcludesSession", func(t *testing.T) {
+		s := open(t)
+
+		mustSave(t, s, conformanceSession("session1", "user1", time.Now()))
+		mustSave(t, s, conformanceSession("session2", "user1", time.Now()))
+
+		if err := s.Delete("session1"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+
+		sessions := mustGetActive(t, s, "user1", 1)
+		if sessions[0].SessionID != "session2" {
+			t.Errorf("Expected only session2, got %s", sessions[0].SessionID)
+		}
+
+		exists, err := s.SessionExists("session1")
+		if err != nil {
+			t.Fatalf("SessionExists failed: %v", err)
+		}
+		if exists {
+			t.Error("SessionExists should be false for a deleted session")
+		}
+	})
+
+	t.Run("DeleteUnknownSession", func(t *testing.T) {
+		s := open(t)
+
+		if err := s.Delete("unknown"); err != nil {
+			t.Errorf("Delete of an unknown session should not fail, got %v", err)
+		}
+	})
+
+	t.Run("SessionExists", func(t *testing.T) {
+		s := open(t)
+
+		mustSave(t, s, conformanceSession("session1", "user1", time.Now()))
+
+		exists, err := s.SessionExists("session1")
+		if err != nil {
+			t.Fatalf("SessionExists failed: %v", err)
+		}
+		if !exists {
+			t.Error("SessionExists should be true for a saved session")
+		}
+
+		exists, err = s.SessionExists("unknown")
+		if err != nil {
+			t.Fatalf("SessionExists failed: %v", err)
+		}
+		if exists {
+			t.Error("SessionExists should be false for an unknown session")
+		}
+	})
+
+	t.Run("GetSession", func(t *testing.T) {
+		s := open(t)
+		getter, ok := Optional[SessionGetter](s)
+		if !ok {
+			t.Skip("store does not implement SessionGetter")
+		}
+
+		mustSave(t, s, conformanceSession("active", "user1", time.Now()))
+		mustSave(t, s, conformanceSession("expired", "user1", time.Now().Add(-2*time.Hour)))
+		mustSave(t, s, conformanceSession("deleted", "user1", time.Now()))
+		if err := s.Delete("deleted"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+
+		got, err := getter.GetSession("active")
+		if err != nil {
+			t.Fatalf("GetSession failed: %v", err)
+		}
+		if got == nil || got.SessionID != "active" || got.UserID != "user1" {
+			t.Errorf("Expected the active session, got %+v", got)
+		}
+
+		for _, id := range []string{"expired", "deleted", "unknown"} {
+			got, err := getter.GetSession(id)
+			if err != nil {
+				t.Fatalf("GetSession(%q) failed: %v", id, err)
+			}
+			if got != nil {
+				t.Errorf("GetSession(%q) should return nil, got %+v", id, got)
+			}
+		}
+	})
+
+	t.Run("HasActiveByUser", func(t *testing.T) {
+		s := open(t)
+		presenceStore, ok := Optional[PresenceStore](s)
+		if !ok {
+			t.Skip("store does not implement PresenceStore")
+		}
+
+		mustSave(t, s, conformanceSession("active", "user1", time.Now()))
+		mustSave(t, s, conformanceSession("expired", "user2", time.Now().Add(-2*time.Hour)))
+		mustSave(t, s, conformanceSession("deleted", "user3", time.Now()))
+		if err := s.Delete("deleted"); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+
+		for userID, want := range map[string]bool{"user1": true, "user2": false, "user3": false, "nobody": false} {
+			got, err := presenceStore.HasActiveByUser(userID)
+			if err != nil {
+				t.Fatalf("HasActiveByUser(%q) failed: %v", userID, err)
+			}
+			if got != want {
+				t.Errorf("HasActiveByUser(%q) = %v, want %v", userID, got, want)
+			}
+		}
+	})
+
+	t.Run("GetActiveByDeviceType", func(t *testing.T) {
+		s := open(t)
+		deviceTypeStore, ok := Optional[DeviceTypeStore](s)
+		if !ok {
+			t.Skip("store does not implement DeviceTypeStore")
+		}
+
+		now := time.Now()
+		mobile1 := conformanceSession("mobile1", "user1", now.Add(-time.Minute))
+		mobile1.DeviceType = "mobile"
+		mobile2 := conformanceSession("mobile2", "user2", now)
+		mobile2.DeviceType = "mobile"
+		expired := conformanceSession("expired", "user1", now.Add(-2*time.Hour))
+		expired.DeviceType = "mobile"
+		mustSave(t, s, mobile1)
+		mustSave(t, s, mobile2)
+		mustSave(t, s, expired)
+		mustSave(t, s, conformanceSession("desktop", "user1", now))
+
+		sessions, err := deviceTypeStore.GetActiveByDeviceType("user1", "mobile")
+		if err != nil {
+			t.Fatalf("GetActiveByDeviceType failed: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].SessionID != "mobile1" {
+			t.Errorf("Expected only mobile1 for user1, got %v", sessionIDs(sessions))
+		}
+
+		sessions, err = deviceTypeStore.GetActiveByDeviceType("", "mobile")
+		if err != nil {
+			t.Fatalf("GetActiveByDeviceType failed: %v", err)
+		}
+		if got := sessionIDs(sessions); len(got) != 2 || got[0] != "mobile2" || got[1] != "mobile1" {
+			t.Errorf("Expected [mobile2 mobile1] across users, got %v", got)
+		}
+	})
+
+	t.Run("UsersOverLimit", func(t *testing.T) {
+		s := open(t)
+		countStore, ok := Optional[UserCountStore](s)
+		if !ok {
+			t.Skip("store does not implement UserCountStore")
+		}
+
+		now := time.Now()
+		for i := range 3 {
+			mustSave(t, s, conformanceSession(fmt.Sprintf("a%d", i), "userA", now))
+			mustSave(t, s, conformanceSession(fmt.Sprintf("b%d", i), "userB", now))
+		}
+		mustSave(t, s, conformanceSession("b3", "userB", now))
+		mustSave(t, s, conformanceSession("c0", "userC", now))
+		mustSave(t, s, conformanceSession("c1", "userC", now))
+		mustSave(t, s, conformanceSession("c2", "userC", now.Add(-2*time.Hour)))
+
+		counts, err := countStore.UsersOverLimit(2)
+		if err != nil {
+			t.Fatalf("UsersOverLimit failed: %v", err)
+		}
+		want := []UserSessionCount{{"userB", 4}, {"userA", 3}}
+		if len(counts) != len(want) {
+			t.Fatalf("Expected %v, got %v", want, counts)
+		}
+		for i := range want {
+			if counts[i] != want[i] {
+				t.Errorf("Expected %v, got %v", want, counts)
+				break
+			}
+		}
+	})
+
+	t.Run("UsersAreIsolated", func(t *testing.T) {
+		s := open(t)
+
+		mustSave(t, s, conformanceSession("session1", "user1", time.Now()))
+		mustSave(t, s, conformanceSession("session2", "user2", time.Now()))
+
+		sessions := mustGetActive(t, s, "user1", 1)
+		if sessions[0].SessionID != "session1" {
+			t.Errorf("Expected session1 for user1, got %s", sessions[0].SessionID)
+		}
+	})
+}
+
+// RunInvalidationCacheConformance runs a suite of tests that every
+// InvalidationCache implementation is expected to pass.
+//
+// newCache must return a new, empty cache each time it is called.
+// The suite closes every cache it creates.
+//
+// SQLiteStore is not a standalone cache: it only records invalidation for
+// sessions stored in it, so it is covered by RunSessionStoreConformance instead.
+func RunInvalidationCacheConformance(t *testing.T, newCache func() InvalidationCache) {
+	t.Helper()
+
+	open := func(t *testing.T) InvalidationCache {
+		t.Helper()
+		c := newCache()
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	t.Run("UnknownSessionNotInvalidated", func(t *testing.T) {
+		c := open(t)
+
+		exists, err := c.Exists("unknown")
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if exists {
+			t.Error("Exists should be false for an unknown session")
+		}
+	})
+
+	t.Run("SetMarksInvalidated", func(t *testing.T) {
+		c := open(t)
+
+		if err := c.Set("session1", time.Hour); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+
+		exists, err := c.Exists("session1")
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if !exists {
+			t.Error("Exists should be true after Set")
+		}
+
+		exists, err = c.Exists("session2")
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if exists {
+			t.Error("Set should not affect other sessions")
+		}
+	})
+
+	t.Run("SetIsIdempotent", func(t *testing.T) {
+		c := open(t)
+
+		for i := 0; i < 2; i++ {
+			if err := c.Set("session1", time.Hour); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+
+		exists, err := c.Exists("session1")
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if !exists {
+			t.Error("Exists should be true after repeated Set")
+		}
+	})
+
+	t.Run("ListInvalidated", func(t *testing.T) {
+		c := open(t)
+
+		before := time.Now().Add(-time.Second)
+		for _, id := range []string{"session1", "session2"} {
+			if err := c.Set(id, time.Hour); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+
+		ids, err := c.ListInvalidated(before)
+		if err != nil {
+			t.Fatalf("ListInvalidated failed: %v", err)
+		}
+		got := make(map[string]bool)
+		for _, id := range ids {
+			got[id] = true
+		}
+		if len(ids) != 2 || !got["session1"] || !got["session2"] {
+			t.Errorf("Expected [session1 session2], got %v", ids)
+		}
+
+		ids, err = c.ListInvalidated(time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("ListInvalidated failed: %v", err)
+		}
+		if len(ids) != 0 {
+			t.Errorf("Expected no invalidations after a future timestamp, got %v", ids)
+		}
+	})
+
+	t.Run("CountInvalidated", func(t *testing.T) {
+		c := open(t)
+		counter, ok := c.(InvalidationCounter)
+		if !ok {
+			t.Skip("cache does not implement InvalidationCounter")
+		}
+
+		before := time.Now().Add(-time.Second)
+		for _, id := range []string{"session1", "session2", "session3"} {
+			if err := c.Set(id, time.Hour); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+
+		for since, want := range map[time.Time]int{before: 3, time.Now().Add(time.Hour): 0} {
+			count, err := counter.CountInvalidated(since)
+			if err != nil {
+				t.Fatalf("CountInvalidated failed: %v", err)
+			}
+			if count != want {
+				t.Errorf("CountInvalidated(%v) = %d, want %d", since, count, want)
+			}
+		}
+	})
+
+	t.Run("ExistsMany", func(t *testing.T) {
+		c := open(t)
+		batchCache, ok := c.(BatchCache)
+		if !ok {
+			t.Skip("cache does not implement BatchCache")
+		}
+
+		for _, id := range []string{"session1", "session3"} {
+			if err := c.Set(id, time.Hour); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+
+		exists, err := batchCache.ExistsMany([]string{"session1", "session2", "session3"})
+		if err != nil {
+			t.Fatalf("ExistsMany failed: %v", err)
+		}
+		if len(exists) != 3 || !exists[0] || exists[1] || !exists[2] {
+			t.Errorf("Expected [true false true], got %v", exists)
+		}
+	})
+
+	t.Run("EntriesExpireAfterTTL", func(t *testing.T) {
+		c := open(t)
+
+		if err := c.Set("session1", 50*time.Millisecond); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		exists, err := c.Exists("session1")
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if exists {
+			t.Error("Exists should be false once the TTL has expired")
+		}
+	})
+}
+
+// conformanceSession returns a fully populated session with a one hour TTL.
+func conformanceSession(sessionID, userID string, createdAt time.Time) *Session {
+	return &Session{
+		SessionID:         sessionID,
+		UserID:            userID,
+		DeviceIP:          "8.8.8.8",
+		DeviceUA:          "Mozilla/5.0",
+		Browser:           "Chrome 120",
+		OS:                "Windows 10",
+		DeviceType:        "desktop",
+		DeviceFingerprint: "v1:3f2a9c",
+		LocCity:           "Mountain View",
+		LocCountry:        "United States",
+		LocCountryCode:    "US",
+		LocLat:            37.3861,
+		LocLng:            -122.0839,
+		LocGeohash:        "9q9ht",
+		LocASN:            15169,
+		GroupKey:          "org1",
+		TTLSeconds:        int64(time.Hour.Seconds()),
+		CreatedAt:         createdAt,
+	}
+}
+
+func mustSave(t *testing.T, s SessionStore, session *Session) {
+	t.Helper()
+	if err := s.Save(session); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+}
+
+func mustGetActive(t *testing.T, s SessionStore, userID string, want int) []*Session {
+	t.Helper()
+	sessions, err := s.GetActiveByUser(userID)
+	if err != nil {
+		t.Fatalf("GetActiveByUser failed: %v", err)
+	}
+	if len(sessions) != want {
+		t.Fatalf("Expected %d active sessions, got %d", want, len(sessions))
+	}
+	return sessions
+}
+
+func sessionIDs(sessions []*Session) []string {
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.SessionID
+	}
+	return ids
+}
@@ -0,0 +1,407 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FieldCipher encrypts and decrypts the sensitive fields of sessions at
+// rest. Implementations must be safe for concurrent use.
+type FieldCipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// aesGCMCipher implements FieldCipher with AES-GCM, prefixing each
+// ciphertext with its random nonce.
+type aesGCMCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMCipher creates a FieldCipher using AES-GCM with the given key,
+// which must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewAESGCMCipher(key []byte) (FieldCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: invalid key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: failed to create GCM: %w", err)
+	}
+	return &aesGCMCipher{aead: aead}, nil
+}
+
+// Encrypt seals plaintext with a random nonce.
+func (c *aesGCMCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("encrypted: failed to generate nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt opens a ciphertext produced by Encrypt.
+func (c *aesGCMCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("encrypted: ciphertext too short")
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// sealedFields are the session fields EncryptedStore encrypts.
+type sealedFields struct {
+	DeviceIP          string  `json:"ip,omitempty"`
+	DeviceUA          string  `json:"ua,omitempty"`
+	DeviceFingerprint string  `json:"fp,omitempty"`
+	LocCity           string  `json:"city,omitempty"`
+	LocCountry        string  `json:"country,omitempty"`
+	LocCountryCode    string  `json:"cc,omitempty"`
+	LocLat            float64 `json:"lat,omitempty"`
+	LocLng            float64 `json:"lng,omitempty"`
+	LocGeohash        string  `json:"geohash,omitempty"`
+	LocASN            uint    `json:"asn,omitempty"`
+}
+
+// EncryptedStore implements SessionStore by encrypting the device IP, user
+// agent, fingerprint and location of sessions before saving them to another store, and
+// decrypting them on read. The ciphertext is kept in Session.Sealed, so the
+// underlying store must persist it, as the built-in stores do.
+//
+// Optional store interfaces are forwarded to the underlying store, with the
+// sessions they return decrypted; check for them with Optional, which also
+// checks the underlying store. Encrypted fields cannot be queried, so
+// SearchStore, LocationUpdateStore and DistinctIPStore are not forwarded.
+type EncryptedStore struct {
+	inner  SessionStore
+	cipher FieldCipher
+}
+
+// NewEncryptedStore creates a store encrypting sessions with c before saving
+// them to inner.
+func NewEncryptedStore(inner SessionStore, c FieldCipher) *EncryptedStore {
+	return &EncryptedStore{inner: inner, cipher: c}
+}
+
+// Unwrap returns the underlying store.
+func (s *EncryptedStore) Unwrap() SessionStore {
+	return s.inner
+}
+
+// Save encrypts the sensitive fields of the session and saves it.
+func (s *EncryptedStore) Save(session *Session) error {
+	stored, err := s.seal(session)
+	if err != nil {
+		return err
+	}
+	return s.inner.Save(stored)
+}
+
+// seal returns a copy of session with its sensitive fields encrypted.
+func (s *EncryptedStore) seal(session *Session) (*Session, error) {
+	plaintext, err := json.Marshal(sealedFields{
+		DeviceIP:          session.DeviceIP,
+		DeviceUA:          session.DeviceUA,
+		DeviceFingerprint: session.DeviceFingerprint,
+		LocCity:           session.LocCity,
+		LocCountry:        session.LocCountry,
+		LocCountryCode:    session.LocCountryCode,
+		LocLat:            session.LocLat,
+		LocLng:            session.LocLng,
+		LocGeohash:        session.LocGeohash,
+		LocASN:            session.LocASN,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: failed to encode session: %w", err)
+	}
+	sealed, err := s.cipher.Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := *session
+	stored.DeviceIP, stored.DeviceUA, stored.DeviceFingerprint = "", "", ""
+	stored.LocCity, stored.LocCountry, stored.LocCountryCode = "", "", ""
+	stored.LocLat, stored.LocLng, stored.LocGeohash, stored.LocASN = 0, 0, "", 0
+	stored.Sealed = sealed
+	return &stored, nil
+}
+
+// open returns a copy of session with its sensitive fields decrypted.
+// Sessions saved without encryption are returned unchanged.
+func (s *EncryptedStore) open(session *Session) (*Session, error) {
+	if session == nil || session.Sealed == nil {
+		return session, nil
+	}
+
+	plaintext, err := s.cipher.Decrypt(session.Sealed)
+	if err != nil {
+		return nil, err
+	}
+	var fields sealedFields
+	if err := json.Unmarshal(plaintext, &fields); err != nil {
+		return nil, fmt.Errorf("encrypted: failed to decode session: %w", err)
+	}
+
+	opened := *session
+	opened.DeviceIP = fields.DeviceIP
+	opened.DeviceUA = fields.DeviceUA
+	opened.DeviceFingerprint = fields.DeviceFingerprint
+	opened.LocCity = fields.LocCity
+	opened.LocCountry = fields.LocCountry
+	opened.LocCountryCode = fields.LocCountryCode
+	opened.LocLat = fields.LocLat
+	opened.LocLng = fields.LocLng
+	opened.LocGeohash = fields.LocGeohash
+	opened.LocASN = fields.LocASN
+	opened.Sealed = nil
+	return &opened, nil
+}
+
+// Delete invalidates the session in the underlying store.
+func (s *EncryptedStore) Delete(sessionID string) error {
+	return s.inner.Delete(sessionID)
+}
+
+// GetActiveByUser returns the user's active sessions, decrypted.
+func (s *EncryptedStore) GetActiveByUser(userID string) ([]*Session, error) {
+	sessions, err := s.inner.GetActiveByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(sessions)
+}
+
+// openAll returns copies of sessions with their sensitive fields decrypted.
+func (s *EncryptedStore) openAll(sessions []*Session) ([]*Session, error) {
+	opened := make([]*Session, len(sessions))
+	for i, session := range sessions {
+		var err error
+		if opened[i], err = s.open(session); err != nil {
+			return nil, err
+		}
+	}
+	return opened, nil
+}
+
+// GetSession returns the active session with the given ID, decrypted, or nil
+// if there is none.
+func (s *EncryptedStore) GetSession(sessionID string) (*Session, error) {
+	getter, err := innerAs[SessionGetter](s, "GetSession")
+	if err != nil {
+		return nil, err
+	}
+	session, err := getter.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(session)
+}
+
+// SessionExists returns true if an active session with the given ID exists.
+func (s *EncryptedStore) SessionExists(sessionID string) (bool, error) {
+	return s.inner.SessionExists(sessionID)
+}
+
+// Close closes the underlying store.
+func (s *EncryptedStore) Close() error {
+	return s.inner.Close()
+}
+
+// innerAs returns the underlying store as the optional interface T, or an
+// error naming op if it does not implement it.
+func innerAs[T any](s *EncryptedStore, op string) (T, error) {
+	inner, ok := Optional[T](s.inner)
+	if !ok {
+		return inner, fmt.Errorf("encrypted: underlying store does not support %s", op)
+	}
+	return inner, nil
+}
+
+// SaveAll encrypts the sessions and saves them in one transaction.
+func (s *EncryptedStore) SaveAll(sessions []*Session) error {
+	inner, err := innerAs[BatchSaveStore](s, "SaveAll")
+	if err != nil {
+		return err
+	}
+	sealed := make([]*Session, len(sessions))
+	for i, session := range sessions {
+		if sealed[i], err = s.seal(session); err != nil {
+			return err
+		}
+	}
+	return inner.SaveAll(sealed)
+}
+
+// Maintain performs the underlying store's maintenance.
+func (s *EncryptedStore) Maintain() error {
+	inner, err := innerAs[Maintainer](s, "Maintain")
+	if err != nil {
+		return err
+	}
+	return inner.Maintain()
+}
+
+// GetExpiredByUser returns the user's sessions that expired after since,
+// decrypted.
+func (s *EncryptedStore) GetExpiredByUser(userID string, since time.Time) ([]*Session, error) {
+	inner, err := innerAs[ExpiredSessionStore](s, "GetExpiredByUser")
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := inner.GetExpiredByUser(userID, since)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(sessions)
+}
+
+// GetActiveByUserLimit returns the user's newest limit active sessions,
+// decrypted.
+func (s *EncryptedStore) GetActiveByUserLimit(userID string, limit int) ([]*Session, error) {
+	inner, err := innerAs[LimitedFetchStore](s, "GetActiveByUserLimit")
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := inner.GetActiveByUserLimit(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(sessions)
+}
+
+// GetExpiringSoon returns the active sessions expiring within the given
+// duration, decrypted.
+func (s *EncryptedStore) GetExpiringSoon(within time.Duration) ([]*Session, error) {
+	inner, err := innerAs[ExpiringStore](s, "GetExpiringSoon")
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := inner.GetExpiringSoon(within)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(sessions)
+}
+
+// LastLoginAt returns the most recent CreatedAt across the user's sessions.
+func (s *EncryptedStore) LastLoginAt(userID string) (time.Time, bool, error) {
+	inner, err := innerAs[LastLoginStore](s, "LastLoginAt")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return inner.LastLoginAt(userID)
+}
+
+// HasActiveByUser reports whether the user has an active session.
+func (s *EncryptedStore) HasActiveByUser(userID string) (bool, error) {
+	inner, err := innerAs[PresenceStore](s, "HasActiveByUser")
+	if err != nil {
+		return false, err
+	}
+	return inner.HasActiveByUser(userID)
+}
+
+// GetActiveByDeviceType returns the active sessions with the given device
+// type, decrypted. The device type is not encrypted.
+func (s *EncryptedStore) GetActiveByDeviceType(userID, deviceType string) ([]*Session, error) {
+	inner, err := innerAs[DeviceTypeStore](s, "GetActiveByDeviceType")
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := inner.GetActiveByDeviceType(userID, deviceType)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(sessions)
+}
+
+// CountSessionsByUser returns the number of sessions the user has created.
+func (s *EncryptedStore) CountSessionsByUser(userID string) (int, error) {
+	inner, err := innerAs[SessionCountStore](s, "CountSessionsByUser")
+	if err != nil {
+		return 0, err
+	}
+	return inner.CountSessionsByUser(userID)
+}
+
+// UsersOverLimit returns the users with more than limit active sessions.
+func (s *EncryptedStore) UsersOverLimit(limit int) ([]UserSessionCount, error) {
+	inner, err := innerAs[UserCountStore](s, "UsersOverLimit")
+	if err != nil {
+		return nil, err
+	}
+	return inner.UsersOverLimit(limit)
+}
+
+// CountActiveByGroup returns the number of active sessions with the given
+// group key. The group key is not encrypted.
+func (s *EncryptedStore) CountActiveByGroup(groupKey string) (int, error) {
+	inner, err := innerAs[GroupCountStore](s, "CountActiveByGroup")
+	if err != nil {
+		return 0, err
+	}
+	return inner.CountActiveByGroup(groupKey)
+}
+
+// GetSessionAudit returns the session with the given ID, decrypted, with the
+// time it was invalidated.
+func (s *EncryptedStore) GetSessionAudit(sessionID string) (*Session, time.Time, error) {
+	inner, err := innerAs[AuditStore](s, "GetSessionAudit")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	session, invalidatedAt, err := inner.GetSessionAudit(sessionID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	opened, err := s.open(session)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return opened, invalidatedAt, nil
+}
+
+// GetActiveByUserAt returns the user's sessions that were active at t,
+// decrypted.
+func (s *EncryptedStore) GetActiveByUserAt(userID string, t time.Time) ([]*Session, error) {
+	inner, err := innerAs[HistoryStore](s, "GetActiveByUserAt")
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := inner.GetActiveByUserAt(userID, t)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAll(sessions)
+}
+
+// CountLoginsByBucket counts the user's sessions created between from and
+// to by bucket.
+func (s *EncryptedStore) CountLoginsByBucket(userID string, from, to time.Time, bucket time.Duration) ([]int, error) {
+	inner, err := innerAs[LoginCountStore](s, "CountLoginsByBucket")
+	if err != nil {
+		return nil, err
+	}
+	return inner.CountLoginsByBucket(userID, from, to, bucket)
+}
+
+// CountInvalidated returns the number of sessions invalidated at or after
+// since.
+func (s *EncryptedStore) CountInvalidated(since time.Time) (int, error) {
+	inner, err := innerAs[InvalidationCounter](s, "CountInvalidated")
+	if err != nil {
+		return 0, err
+	}
+	return inner.CountInvalidated(since)
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCipher(t *testing.T) FieldCipher {
+	t.Helper()
+	c, err := NewAESGCMCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher failed: %v", err)
+	}
+	return c
+}
+
+func TestAESGCMCipher(t *testing.T) {
+	c := newTestCipher(t)
+
+	plaintext := []byte("203.0.113.7")
+	first, err := c.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	second, _ := c.Encrypt(plaintext)
+	if bytes.Equal(first, second) {
+		t.Error("Expected a fresh nonce per encryption")
+	}
+
+	got, err := c.Decrypt(first)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("Expected %q, got %q", plaintext, got)
+	}
+
+	other, _ := NewAESGCMCipher(bytes.Repeat([]byte{8}, 32))
+	if _, err := other.Decrypt(first); err == nil {
+		t.Error("Expected decryption with the wrong key to fail")
+	}
+	if _, err := NewAESGCMCipher([]byte("short")); err == nil {
+		t.Error("Expected error for an invalid key length")
+	}
+}
+
+func TestEncryptedStoreConformance(t *testing.T) {
+	RunSessionStoreConformance(t, func() SessionStore {
+		s, err := NewSQLiteMemory()
+		if err != nil {
+			t.Fatalf("Failed to create SQLite store: %v", err)
+		}
+		return NewEncryptedStore(s, newTestCipher(t))
+	})
+}
+
+func TestEncryptedStoreOptionalInterfaces(t *testing.T) {
+	sqlite, err := NewSQLiteMemory()
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	s := NewEncryptedStore(sqlite, newTestCipher(t))
+	defer s.Close()
+
+	if _, ok := Optional[SearchStore](s); ok {
+		t.Error("Expected SearchStore not to be forwarded")
+	}
+	if _, ok := Optional[LocationUpdateStore](s); ok {
+		t.Error("Expected LocationUpdateStore not to be forwarded")
+	}
+	expiredStore, ok := Optional[ExpiredSessionStore](s)
+	if !ok {
+		t.Fatal("Expected ExpiredSessionStore to be forwarded")
+	}
+
+	// Forwarded sessions are decrypted
+	want := conformanceSession("session1", "user1", time.Now().Add(-2*time.Hour))
+	if err := s.Save(want); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+	expired, err := expiredStore.GetExpiredByUser("user1", time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetExpiredByUser failed: %v", err)
+	}
+	if len(expired) != 1 || expired[0].DeviceIP != want.DeviceIP || expired[0].LocCity != want.LocCity {
+		t.Errorf("Expected the decrypted expired session, got %+v", expired)
+	}
+
+	// Interfaces the underlying store lacks are not reported
+	hidden := NewEncryptedStore(struct{ SessionStore }{sqlite}, newTestCipher(t))
+	if _, ok := Optional[ExpiredSessionStore](hidden); ok {
+		t.Error("Expected ExpiredSessionStore to be hidden when the underlying store lacks it")
+	}
+	if _, err := hidden.GetExpiredByUser("user1", time.Time{}); err == nil {
+		t.Error("Expected an error calling an unsupported forwarded method")
+	}
+}
+
+func TestEncryptedStoreAtRest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqlite, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	s := NewEncryptedStore(sqlite, newTestCipher(t))
+
+	want := conformanceSession("session1", "user1", time.Now())
+	want.DeviceIP = "203.0.113.7"
+	want.DeviceUA = "SecretAgent/1.0"
+	want.LocCity = "Reykjavik"
+	if err := s.Save(want); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	got, err := s.GetSession("session1")
+	if err != nil || got == nil {
+		t.Fatalf("GetSession failed: %v, %v", got, err)
+	}
+	if got.DeviceIP != want.DeviceIP || got.DeviceUA != want.DeviceUA || got.LocCity != want.LocCity ||
+		got.LocLat != want.LocLat || got.LocGeohash != want.LocGeohash {
+		t.Errorf("Expected decrypted session %+v, got %+v", want, got)
+	}
+	if got.Sealed != nil {
+		t.Error("Expected Sealed to be cleared on read")
+	}
+
+	// The plaintext is stored neither in the database nor its write-ahead log
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for _, file := range []string{path, path + "-wal"} {
+		raw, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		for _, secret := range []string{want.DeviceIP, want.DeviceUA, want.LocCity} {
+			if bytes.Contains(raw, []byte(secret)) {
+				t.Errorf("Found plaintext %q in %s", secret, filepath.Base(file))
+			}
+		}
+	}
+}
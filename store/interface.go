@@ -5,19 +5,29 @@ import "time"
 // Session represents a user session for storage.
 // This is a copy of the main Session type to avoid circular imports.
 type Session struct {
-	SessionID  string
-	UserID     string
-	DeviceIP   string
-	DeviceUA   string
-	Browser    string
-	OS         string
-	DeviceType string
-	LocCity    string
-	LocCountry string
-	LocLat     float64
-	LocLng     float64
-	TTLSeconds int64
-	CreatedAt  time.Time
+	SessionID         string
+	UserID            string
+	DeviceIP          string
+	DeviceUA          string
+	Browser           string
+	OS                string
+	DeviceType        string
+	DeviceFingerprint string // versioned, e.g. "v1:<hex>"
+	LocCity           string
+	LocCountry        string
+	LocCountryCode    string
+	LocLat            float64
+	LocLng            float64
+	LocGeohash        string
+	LocASN            uint // autonomous system number, 0 if unknown
+	GroupKey          string
+	Sealed            []byte // sensitive fields encrypted by EncryptedStore
+	TTLSeconds        int64
+	CreatedAt         time.Time
+
+	// StoredExpiresAt is the expiry time as stored by the backend, which
+	// filters active sessions by it. Zero if the backend does not store it.
+	StoredExpiresAt time.Time
 }
 
 // IsExpired returns true if the session has expired.
@@ -25,8 +35,12 @@ func (s *Session) IsExpired() bool {
 	return time.Now().After(s.ExpiresAt())
 }
 
-// ExpiresAt returns the expiration time of the session.
+// ExpiresAt returns the expiration time of the session: StoredExpiresAt if
+// set, otherwise CreatedAt plus the TTL.
 func (s *Session) ExpiresAt() time.Time {
+	if !s.StoredExpiresAt.IsZero() {
+		return s.StoredExpiresAt
+	}
 	return s.CreatedAt.Add(time.Duration(s.TTLSeconds) * time.Second)
 }
 
@@ -44,13 +58,36 @@ type SessionStore interface {
 
 	// GetActiveByUser returns all non-expired, non-invalidated sessions for a user.
 	// Sessions are ordered by CreatedAt descending (newest first).
-	// Use [0] to get the latest session.
+	// Use [0] to get the latest session. Returns an empty, non-nil slice if
+	// the user has no active sessions, so results encode as [] in JSON.
 	GetActiveByUser(userID string) ([]*Session, error)
 
+	// SessionExists returns true if a non-expired, non-invalidated session
+	// with the given ID exists. It should be cheaper than fetching the row.
+	// Named to avoid clashing with InvalidationCache.Exists, since a store
+	// may implement both interfaces.
+	SessionExists(sessionID string) (bool, error)
+
 	// Close releases any resources held by the store.
 	Close() error
 }
 
+// Optional returns s as the optional store interface T, e.g.
+// Optional[ExpiredSessionStore](s). Stores wrapping another store, such as
+// EncryptedStore, implement optional interfaces by forwarding them, so they
+// report Unwrap() SessionStore and T is only returned if the wrapped store
+// implements it too.
+func Optional[T any](s SessionStore) (T, bool) {
+	if wrapper, ok := s.(interface{ Unwrap() SessionStore }); ok {
+		if _, ok := Optional[T](wrapper.Unwrap()); !ok {
+			var zero T
+			return zero, false
+		}
+	}
+	t, ok := s.(T)
+	return t, ok
+}
+
 // InvalidationCache defines the interface for tracking invalidated session IDs.
 // Implementations must be safe for concurrent use.
 type InvalidationCache interface {
@@ -62,6 +99,283 @@ type InvalidationCache interface {
 	// and the TTL has not expired.
 	Exists(sessionID string) (bool, error)
 
+	// ListInvalidated returns the IDs of sessions invalidated at or after since
+	// whose entries have not expired, in no particular order.
+	// Intended for sync jobs propagating revocations to other services.
+	ListInvalidated(since time.Time) ([]string, error)
+
 	// Close releases any resources held by the cache.
 	Close() error
 }
+
+// StatsCache is an optional interface for invalidation caches that can report
+// how many invalidated entries they track. Useful for capacity monitoring.
+type StatsCache interface {
+	InvalidationCache
+
+	// Len returns the number of invalidated entries currently tracked.
+	// Depending on the backend this may be approximate or expensive.
+	Len() (int, error)
+}
+
+// InvalidationCounter is an optional interface for invalidation caches and
+// session stores that record when sessions were invalidated and can count
+// invalidations efficiently, e.g. to alert on mass logouts.
+type InvalidationCounter interface {
+	// CountInvalidated returns the number of sessions invalidated at or
+	// after since.
+	CountInvalidated(since time.Time) (int, error)
+}
+
+// BatchCache is an optional interface for invalidation caches that can check
+// many session IDs in one round trip.
+type BatchCache interface {
+	InvalidationCache
+
+	// ExistsMany reports for each session ID whether it has been invalidated
+	// and the TTL has not expired. The result is aligned with sessionIDs.
+	ExistsMany(sessionIDs []string) ([]bool, error)
+}
+
+// BatchSaveStore is an optional interface for session stores that can save
+// several sessions atomically.
+type BatchSaveStore interface {
+	SessionStore
+
+	// SaveAll persists all sessions, as Save does, in one transaction:
+	// either all of them are saved or none is.
+	SaveAll(sessions []*Session) error
+}
+
+// Maintainer is an optional interface for session stores and invalidation
+// caches that need periodic maintenance, such as compacting their files.
+type Maintainer interface {
+	// Maintain performs the maintenance. It may be slow and block other
+	// operations while it runs.
+	Maintain() error
+}
+
+// SessionGetter is an optional interface for session stores that can fetch
+// a single session by ID.
+type SessionGetter interface {
+	SessionStore
+
+	// GetSession returns the active (non-expired, non-invalidated) session
+	// with the given ID, or nil if there is none.
+	GetSession(sessionID string) (*Session, error)
+}
+
+// ExpiredSessionStore is an optional interface for session stores that can
+// report sessions which expired naturally (were never invalidated).
+type ExpiredSessionStore interface {
+	SessionStore
+
+	// GetExpiredByUser returns the user's non-invalidated sessions that
+	// expired after since and before now, ordered by CreatedAt descending.
+	GetExpiredByUser(userID string, since time.Time) ([]*Session, error)
+}
+
+// LimitedFetchStore is an optional interface for session stores that can
+// bound how many of a user's active sessions are fetched.
+type LimitedFetchStore interface {
+	SessionStore
+
+	// GetActiveByUserLimit is like GetActiveByUser but returns only the
+	// newest limit sessions.
+	GetActiveByUserLimit(userID string, limit int) ([]*Session, error)
+}
+
+// ExpiringStore is an optional interface for session stores that can find
+// sessions about to expire, e.g. to warn users or refresh them silently.
+type ExpiringStore interface {
+	SessionStore
+
+	// GetExpiringSoon returns the active sessions of all users expiring
+	// within the given duration from now, ordered by expiry, soonest first.
+	GetExpiringSoon(within time.Duration) ([]*Session, error)
+}
+
+// DistinctIPStore is an optional interface for session stores that can count
+// the distinct source IPs a user has logged in from.
+type DistinctIPStore interface {
+	SessionStore
+
+	// CountDistinctIPs returns the number of distinct device IPs across the
+	// user's sessions created at or after since, including sessions that
+	// have since expired or been invalidated (if the store retains them).
+	CountDistinctIPs(userID string, since time.Time) (int, error)
+}
+
+// LastLoginStore is an optional interface for session stores that can report
+// when a user last logged in.
+type LastLoginStore interface {
+	SessionStore
+
+	// LastLoginAt returns the most recent CreatedAt across all of the user's
+	// sessions, including expired and invalidated ones (if the store retains
+	// them). The bool is false if the user has no sessions.
+	LastLoginAt(userID string) (time.Time, bool, error)
+}
+
+// PresenceStore is an optional interface for session stores that can check
+// whether a user has any active session without fetching them.
+type PresenceStore interface {
+	SessionStore
+
+	// HasActiveByUser reports whether the user has at least one
+	// non-expired, non-invalidated session.
+	HasActiveByUser(userID string) (bool, error)
+}
+
+// DeviceTypeStore is an optional interface for session stores that can select
+// active sessions by device type, e.g. to revoke all mobile sessions.
+type DeviceTypeStore interface {
+	SessionStore
+
+	// GetActiveByDeviceType returns the non-expired, non-invalidated
+	// sessions with the given device type, ordered by CreatedAt descending.
+	// If userID is empty, sessions of all users are returned.
+	GetActiveByDeviceType(userID, deviceType string) ([]*Session, error)
+}
+
+// SessionCountStore is an optional interface for session stores that can count
+// a user's login history.
+type SessionCountStore interface {
+	SessionStore
+
+	// CountSessionsByUser returns the number of sessions the user has
+	// created, including expired and invalidated ones (if the store retains
+	// them).
+	CountSessionsByUser(userID string) (int, error)
+}
+
+// UserSessionCount is the number of active sessions of a user.
+type UserSessionCount struct {
+	UserID string
+	Count  int
+}
+
+// UserCountStore is an optional interface for session stores that can count
+// active sessions per user across all users, e.g. to preview a new
+// concurrent session limit.
+type UserCountStore interface {
+	SessionStore
+
+	// UsersOverLimit returns the users with more than limit non-expired,
+	// non-invalidated sessions, ordered by count descending, then by user
+	// ID.
+	UsersOverLimit(limit int) ([]UserSessionCount, error)
+}
+
+// Location is the geolocation of a session's device IP.
+type Location struct {
+	City        string
+	Country     string
+	CountryCode string
+	Lat         float64
+	Lng         float64
+	Geohash     string
+}
+
+// LocationUpdateStore is an optional interface for session stores that can
+// rewrite the location of stored sessions, e.g. after a GeoIP database update.
+type LocationUpdateStore interface {
+	SessionStore
+
+	// DeviceIPsByUser returns the distinct device IPs across all of the
+	// user's sessions, including expired and invalidated ones (if the store
+	// retains them), in no particular order.
+	DeviceIPsByUser(userID string) ([]string, error)
+
+	// UpdateLocationByIP sets the location of all of the user's sessions
+	// from ip to loc and returns the number of sessions whose location
+	// changed.
+	UpdateLocationByIP(userID, ip string, loc Location) (int, error)
+}
+
+// GroupCountStore is an optional interface for session stores that can count
+// active sessions by Session.GroupKey, for limits shared by a group of users.
+type GroupCountStore interface {
+	SessionStore
+
+	// CountActiveByGroup returns the number of non-expired, non-invalidated
+	// sessions across all users with the given group key.
+	CountActiveByGroup(groupKey string) (int, error)
+}
+
+// AuditStore is an optional interface for session stores that retain
+// invalidated sessions and can report a single session's lifecycle.
+type AuditStore interface {
+	SessionStore
+
+	// GetSessionAudit returns the session with the given ID whether it is
+	// active, expired or invalidated, with the time it was invalidated (zero
+	// if it was not). The session is nil if the store has no such session.
+	GetSessionAudit(sessionID string) (*Session, time.Time, error)
+}
+
+// HistoryStore is an optional interface for session stores that retain
+// invalidated sessions and can reconstruct which sessions were active at a
+// past point in time.
+type HistoryStore interface {
+	SessionStore
+
+	// GetActiveByUserAt returns the user's sessions that were active at t:
+	// created at or before t, expiring after t, and not invalidated by t.
+	// Sessions are ordered by CreatedAt descending.
+	GetActiveByUserAt(userID string, t time.Time) ([]*Session, error)
+}
+
+// SessionFilter selects sessions for SearchStore.FindSessions.
+// Empty fields match everything; at least one should be set.
+type SessionFilter struct {
+	DeviceIP      string    // exact match
+	CountryCode   string    // ISO 3166-1 alpha-2, case-insensitive
+	CreatedAfter  time.Time // inclusive; zero means no lower bound
+	CreatedBefore time.Time // exclusive; zero means no upper bound
+}
+
+// SearchStore is an optional interface for session stores that can search
+// sessions across all users, for incident response.
+type SearchStore interface {
+	SessionStore
+
+	// FindSessions returns all sessions matching filter, including expired
+	// and invalidated ones (if the store retains them), ordered by
+	// CreatedAt descending.
+	FindSessions(filter SessionFilter) ([]*Session, error)
+}
+
+// LoginCountStore is an optional interface for session stores that can count
+// a user's logins over time.
+type LoginCountStore interface {
+	SessionStore
+
+	// CountLoginsByBucket counts the user's sessions created at or after from
+	// and before to, grouped into consecutive bucket-long intervals starting
+	// at from. The result has one entry per interval, the last of which may
+	// be cut short by to. Expired and invalidated sessions are included (if
+	// the store retains them). bucket is at least one second.
+	CountLoginsByBucket(userID string, from, to time.Time, bucket time.Duration) ([]int, error)
+}
+
+// BucketLogins counts the sessions created at or after from and before to
+// into consecutive bucket-long intervals starting at from, as
+// LoginCountStore.CountLoginsByBucket does. Stores that cannot group in
+// their query language can use it on the user's sessions.
+func BucketLogins(sessions []*Session, from, to time.Time, bucket time.Duration) []int {
+	counts := make([]int, bucketCount(from, to, bucket))
+	for _, session := range sessions {
+		if session.CreatedAt.Before(from) || !session.CreatedAt.Before(to) {
+			continue
+		}
+		counts[int(session.CreatedAt.Sub(from)/bucket)]++
+	}
+	return counts
+}
+
+// bucketCount returns the number of bucket-long intervals needed to cover
+// from up to to.
+func bucketCount(from, to time.Time, bucket time.Duration) int {
+	return int((to.Sub(from) + bucket - 1) / bucket)
+}
@@ -1,6 +1,11 @@
 package store
 
 import (
+	"container/heap"
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -9,51 +14,202 @@ import (
 // Expired entries are cleaned up periodically.
 type MemoryCache struct {
 	mu      sync.RWMutex
-	entries map[string]time.Time // sessionID -> expiresAt
+	entries map[string]cacheEntry // sessionID -> entry
+
+	maxEntries int
+	byExpiry   expiryHeap // only maintained if maxEntries > 0
+	logger     WarnLogger
 
 	// For periodic cleanup
 	stopCleanup chan struct{}
+	cleanupDone chan struct{} // nil if the cleanup goroutine was not started
+}
+
+// cacheEntry records when a session was invalidated and when the entry expires.
+type cacheEntry struct {
+	invalidatedAt time.Time
+	expiresAt     time.Time
+	item          *expiryItem // position in byExpiry, nil if unbounded
+}
+
+// MemoryCacheOptions contains optional settings for NewMemoryCacheWithOptions.
+type MemoryCacheOptions struct {
+	// MaxEntries bounds the number of entries, e.g. so that a logout storm
+	// cannot grow the cache without limit between cleanups. When a Set
+	// would exceed it, the entries closest to expiry are evicted, so an
+	// invalidation may be forgotten before its TTL ends; each such early
+	// eviction is logged as a warning. 0 means unbounded.
+	MaxEntries int
+
+	// Logger receives the warnings for early evictions, at most one per
+	// Set. Both *slog.Logger and heimdall.Logger satisfy it, so the logger
+	// given to Heimdall can be passed.
+	// Default: slog.Default().
+	Logger WarnLogger
+}
+
+// WarnLogger is the logging interface used by MemoryCache.
+type WarnLogger interface {
+	Warn(msg string, keysAndValues ...any)
 }
 
 // NewMemoryCache creates a new in-memory invalidation cache.
 // It starts a background goroutine that periodically cleans up expired entries.
 func NewMemoryCache() *MemoryCache {
-	cache := &MemoryCache{
-		entries:     make(map[string]time.Time),
-		stopCleanup: make(chan struct{}),
+	return NewMemoryCacheWithOptions(MemoryCacheOptions{})
+}
+
+// NewMemoryCacheWithOptions is like NewMemoryCache but accepts additional options.
+func NewMemoryCacheWithOptions(opts MemoryCacheOptions) *MemoryCache {
+	cache := newMemoryCache()
+	cache.maxEntries = opts.MaxEntries
+	cache.logger = opts.Logger
+	if cache.logger == nil {
+		cache.logger = slog.Default()
 	}
+	cache.cleanupDone = make(chan struct{})
 
 	// Start background cleanup every other day
-	go cache.cleanupLoop(48 * time.Hour)
+	go func() {
+		defer close(cache.cleanupDone)
+		cache.cleanupLoop(48 * time.Hour)
+	}()
 
 	return cache
 }
 
+// newMemoryCache creates a cache without starting the cleanup goroutine.
+func newMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries:     make(map[string]cacheEntry),
+		stopCleanup: make(chan struct{}),
+	}
+}
+
 // Set marks a session ID as invalidated with the given TTL.
 func (c *MemoryCache) Set(sessionID string, ttl time.Duration) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.entries[sessionID] = time.Now().Add(ttl)
+	now := time.Now()
+	entry := cacheEntry{invalidatedAt: now, expiresAt: now.Add(ttl)}
+	if c.maxEntries > 0 {
+		if old, ok := c.entries[sessionID]; ok {
+			entry.item = old.item
+			entry.item.expiresAt = entry.expiresAt
+			heap.Fix(&c.byExpiry, entry.item.index)
+		} else {
+			entry.item = &expiryItem{sessionID: sessionID, expiresAt: entry.expiresAt}
+			heap.Push(&c.byExpiry, entry.item)
+		}
+	}
+	c.entries[sessionID] = entry
+
+	early := 0
+	var earliest time.Time
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		evicted := heap.Pop(&c.byExpiry).(*expiryItem)
+		delete(c.entries, evicted.sessionID)
+		if now.Before(evicted.expiresAt) {
+			if early == 0 {
+				earliest = evicted.expiresAt
+			}
+			early++
+		}
+	}
+	if early > 0 {
+		c.logger.Warn("store: invalidation evicted before expiry, MaxEntries exceeded",
+			"max_entries", c.maxEntries, "evicted", early, "expires_at", earliest)
+	}
 	return nil
 }
 
 // Exists returns true if the session ID has been invalidated and not expired.
 func (c *MemoryCache) Exists(sessionID string) (bool, error) {
 	c.mu.RLock()
-	_, exists := c.entries[sessionID]
+	entry, exists := c.entries[sessionID]
 	c.mu.RUnlock()
 
 	if !exists {
 		return false, nil
 	}
 
-	return true, nil
+	// Entry may have expired but not yet been cleaned up
+	return time.Now().Before(entry.expiresAt), nil
+}
+
+// ExistsMany reports for each session ID whether it has been invalidated and
+// not expired.
+func (c *MemoryCache) ExistsMany(sessionIDs []string) ([]bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	exists := make([]bool, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		entry, ok := c.entries[sessionID]
+		exists[i] = ok && now.Before(entry.expiresAt)
+	}
+	return exists, nil
 }
 
-// Close stops the background cleanup goroutine.
+// ListInvalidated returns the IDs of unexpired entries invalidated at or after since.
+func (c *MemoryCache) ListInvalidated(since time.Time) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	ids := []string{}
+	for sessionID, entry := range c.entries {
+		if !entry.invalidatedAt.Before(since) && now.Before(entry.expiresAt) {
+			ids = append(ids, sessionID)
+		}
+	}
+	return ids, nil
+}
+
+// CountInvalidated returns the number of unexpired entries invalidated at or
+// after since.
+func (c *MemoryCache) CountInvalidated(since time.Time) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	count := 0
+	for _, entry := range c.entries {
+		if !entry.invalidatedAt.Before(since) && now.Before(entry.expiresAt) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Len returns the number of entries in the cache.
+// Expired entries are counted until the next cleanup removes them.
+func (c *MemoryCache) Len() (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.entries), nil
+}
+
+// Clear removes all entries. It is intended for resetting state between tests.
+func (c *MemoryCache) Clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]cacheEntry)
+	c.byExpiry = nil
+	return nil
+}
+
+// Close stops the background cleanup goroutine, waiting for a cleanup in
+// progress to finish.
 func (c *MemoryCache) Close() error {
 	close(c.stopCleanup)
+	if c.cleanupDone != nil {
+		<-c.cleanupDone
+	}
 	return nil
 }
 
@@ -79,13 +235,50 @@ func (c *MemoryCache) cleanup() {
 	defer c.mu.Unlock()
 
 	now := time.Now()
-	for sessionID, expiresAt := range c.entries {
-		if now.After(expiresAt) {
+	for sessionID, entry := range c.entries {
+		if now.After(entry.expiresAt) {
 			delete(c.entries, sessionID)
+			if entry.item != nil {
+				heap.Remove(&c.byExpiry, entry.item.index)
+			}
 		}
 	}
 }
 
+// expiryItem is a cache entry's position in an expiryHeap.
+type expiryItem struct {
+	sessionID string
+	expiresAt time.Time
+	index     int
+}
+
+// expiryHeap is a min-heap of cache entries ordered by expiry, implementing
+// heap.Interface.
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
 // MemorySessionStore implements SessionStore using an in-memory map.
 // This is useful for testing but not recommended for production.
 type MemorySessionStore struct {
@@ -149,10 +342,10 @@ func (s *MemorySessionStore) GetActiveByUser(userID string) ([]*Session, error)
 
 	sessionIDs, exists := s.byUser[userID]
 	if !exists {
-		return nil, nil
+		return []*Session{}, nil
 	}
 
-	var active []*Session
+	active := []*Session{}
 	now := time.Now()
 
 	for sessionID := range sessionIDs {
@@ -162,19 +355,430 @@ func (s *MemorySessionStore) GetActiveByUser(userID string) ([]*Session, error)
 		}
 	}
 
-	// Sort by CreatedAt descending
-	for i := 0; i < len(active)-1; i++ {
-		for j := i + 1; j < len(active); j++ {
-			if active[j].CreatedAt.After(active[i].CreatedAt) {
-				active[i], active[j] = active[j], active[i]
+	sortByCreatedAtDesc(active)
+	return active, nil
+}
+
+// GetActiveByUserLimit returns the user's newest limit non-expired sessions.
+func (s *MemorySessionStore) GetActiveByUserLimit(userID string, limit int) ([]*Session, error) {
+	active, err := s.GetActiveByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return active[:min(len(active), limit)], nil
+}
+
+// sortByCreatedAtDesc sorts sessions by CreatedAt, newest first.
+func sortByCreatedAtDesc(sessions []*Session) {
+	for i := 0; i < len(sessions)-1; i++ {
+		for j := i + 1; j < len(sessions); j++ {
+			if sessions[j].CreatedAt.After(sessions[i].CreatedAt) {
+				sessions[i], sessions[j] = sessions[j], sessions[i]
 			}
 		}
 	}
+}
+
+// GetSession returns the non-expired session with the given ID, or nil if there is none.
+func (s *MemorySessionStore) GetSession(sessionID string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists || !time.Now().Before(session.ExpiresAt()) {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// GetExpiredByUser returns the user's sessions that expired after since.
+func (s *MemorySessionStore) GetExpiredByUser(userID string, since time.Time) ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expired := []*Session{}
+	now := time.Now()
+
+	for sessionID := range s.byUser[userID] {
+		session := s.sessions[sessionID]
+		if session == nil {
+			continue
+		}
+		expiresAt := session.ExpiresAt()
+		if expiresAt.After(since) && !expiresAt.After(now) {
+			expired = append(expired, session)
+		}
+	}
+
+	sortByCreatedAtDesc(expired)
+	return expired, nil
+}
 
+// GetExpiringSoon returns the non-expired sessions expiring within the given
+// duration, soonest first.
+func (s *MemorySessionStore) GetExpiringSoon(within time.Duration) ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiring := []*Session{}
+	now := time.Now()
+	deadline := now.Add(within)
+
+	for _, session := range s.sessions {
+		expiresAt := session.ExpiresAt()
+		if expiresAt.After(now) && !expiresAt.After(deadline) {
+			expiring = append(expiring, session)
+		}
+	}
+
+	sort.Slice(expiring, func(i, j int) bool {
+		return expiring[i].ExpiresAt().Before(expiring[j].ExpiresAt())
+	})
+	return expiring, nil
+}
+
+// SessionExists returns true if a non-expired session with the given ID exists.
+func (s *MemorySessionStore) SessionExists(sessionID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return false, nil
+	}
+	return time.Now().Before(session.ExpiresAt()), nil
+}
+
+// HasActiveByUser reports whether the user has a non-expired session.
+func (s *MemorySessionStore) HasActiveByUser(userID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for sessionID := range s.byUser[userID] {
+		session := s.sessions[sessionID]
+		if session != nil && now.Before(session.ExpiresAt()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetActiveByDeviceType returns the non-expired sessions with the given device
+// type, of the user or, if userID is empty, of all users.
+func (s *MemorySessionStore) GetActiveByDeviceType(userID, deviceType string) ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	active := []*Session{}
+	now := time.Now()
+	for _, session := range s.sessions {
+		if userID != "" && session.UserID != userID {
+			continue
+		}
+		if session.DeviceType == deviceType && now.Before(session.ExpiresAt()) {
+			active = append(active, session)
+		}
+	}
+
+	sortByCreatedAtDesc(active)
 	return active, nil
 }
 
+// CountDistinctIPs returns the number of distinct device IPs across the user's
+// sessions created at or after since, including expired ones.
+// Deleted sessions are not retained and therefore not counted.
+func (s *MemorySessionStore) CountDistinctIPs(userID string, since time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ips := make(map[string]bool)
+	for sessionID := range s.byUser[userID] {
+		session := s.sessions[sessionID]
+		if session != nil && !session.CreatedAt.Before(since) {
+			ips[session.DeviceIP] = true
+		}
+	}
+	return len(ips), nil
+}
+
+// LastLoginAt returns the most recent CreatedAt across all of the user's
+// sessions, including expired ones. Deleted sessions are not retained.
+func (s *MemorySessionStore) LastLoginAt(userID string) (time.Time, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var last time.Time
+	found := false
+	for sessionID := range s.byUser[userID] {
+		session := s.sessions[sessionID]
+		if session != nil && (!found || session.CreatedAt.After(last)) {
+			last = session.CreatedAt
+			found = true
+		}
+	}
+	return last, found, nil
+}
+
+// CountLoginsByBucket counts the user's sessions created at or after from and
+// before to, per bucket-long interval, including expired ones. Deleted
+// sessions are not retained and therefore not counted.
+func (s *MemorySessionStore) CountLoginsByBucket(userID string, from, to time.Time, bucket time.Duration) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []*Session
+	for sessionID := range s.byUser[userID] {
+		if session := s.sessions[sessionID]; session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return BucketLogins(sessions, from, to, bucket), nil
+}
+
+// CountSessionsByUser returns the number of sessions the user has created,
+// including expired ones. Deleted sessions are not retained and therefore not
+// counted.
+func (s *MemorySessionStore) CountSessionsByUser(userID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.byUser[userID]), nil
+}
+
+// CountActiveByGroup returns the number of non-expired sessions with the
+// given group key.
+func (s *MemorySessionStore) CountActiveByGroup(groupKey string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.GroupKey == groupKey && now.Before(session.ExpiresAt()) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UsersOverLimit returns the users with more than limit non-expired sessions.
+func (s *MemorySessionStore) UsersOverLimit(limit int) ([]UserSessionCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byUser := make(map[string]int)
+	now := time.Now()
+	for _, session := range s.sessions {
+		if now.Before(session.ExpiresAt()) {
+			byUser[session.UserID]++
+		}
+	}
+
+	counts := []UserSessionCount{}
+	for userID, count := range byUser {
+		if count > limit {
+			counts = append(counts, UserSessionCount{UserID: userID, Count: count})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].UserID < counts[j].UserID
+	})
+	return counts, nil
+}
+
+// DeviceIPsByUser returns the distinct device IPs across the user's sessions,
+// including expired ones. Deleted sessions are not retained.
+func (s *MemorySessionStore) DeviceIPsByUser(userID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	ips := []string{}
+	for sessionID := range s.byUser[userID] {
+		session := s.sessions[sessionID]
+		if session != nil && !seen[session.DeviceIP] {
+			seen[session.DeviceIP] = true
+			ips = append(ips, session.DeviceIP)
+		}
+	}
+	return ips, nil
+}
+
+// UpdateLocationByIP sets the location of the user's sessions from ip to loc.
+// Sessions are replaced rather than modified, since callers may hold them.
+func (s *MemorySessionStore) UpdateLocationByIP(userID, ip string, loc Location) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := 0
+	for sessionID := range s.byUser[userID] {
+		session := s.sessions[sessionID]
+		if session == nil || session.DeviceIP != ip {
+			continue
+		}
+		current := Location{session.LocCity, session.LocCountry, session.LocCountryCode, session.LocLat, session.LocLng, session.LocGeohash}
+		if current == loc {
+			continue
+		}
+		replacement := *session
+		replacement.LocCity = loc.City
+		replacement.LocCountry = loc.Country
+		replacement.LocCountryCode = loc.CountryCode
+		replacement.LocLat = loc.Lat
+		replacement.LocLng = loc.Lng
+		replacement.LocGeohash = loc.Geohash
+		s.sessions[sessionID] = &replacement
+		updated++
+	}
+	return updated, nil
+}
+
+// FindSessions returns all sessions matching filter, across all users,
+// including expired ones. Deleted sessions are not retained.
+func (s *MemorySessionStore) FindSessions(filter SessionFilter) ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := []*Session{}
+	for _, session := range s.sessions {
+		if filter.DeviceIP != "" && session.DeviceIP != filter.DeviceIP {
+			continue
+		}
+		if filter.CountryCode != "" && !strings.EqualFold(session.LocCountryCode, filter.CountryCode) {
+			continue
+		}
+		if !filter.CreatedAfter.IsZero() && session.CreatedAt.Before(filter.CreatedAfter) {
+			continue
+		}
+		if !filter.CreatedBefore.IsZero() && !session.CreatedAt.Before(filter.CreatedBefore) {
+			continue
+		}
+		found = append(found, session)
+	}
+
+	sortByCreatedAtDesc(found)
+	return found, nil
+}
+
+// Clear removes all sessions. It is intended for resetting state between tests.
+func (s *MemorySessionStore) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = make(map[string]*Session)
+	s.byUser = make(map[string]map[string]bool)
+	return nil
+}
+
 // Close is a no-op for the memory store.
 func (s *MemorySessionStore) Close() error {
 	return nil
 }
+
+// cleanup removes all expired sessions.
+func (s *MemorySessionStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for sessionID, session := range s.sessions {
+		if now.Before(session.ExpiresAt()) {
+			continue
+		}
+		delete(s.sessions, sessionID)
+		if userSessions, ok := s.byUser[session.UserID]; ok {
+			delete(userSessions, sessionID)
+			if len(userSessions) == 0 {
+				delete(s.byUser, session.UserID)
+			}
+		}
+	}
+}
+
+// MemoryStore implements both SessionStore and InvalidationCache in memory,
+// for single-node deployments that don't need sessions to survive a restart.
+// Unlike MemorySessionStore, expired sessions and invalidations are evicted
+// periodically, so memory use is bounded by the number of live sessions.
+//
+// Expired sessions are only retained until the next cleanup, which limits
+// how far back GetExpiredByUser, LastLoginAt and CountDistinctIPs can see.
+type MemoryStore struct {
+	*MemorySessionStore
+	*MemoryCache
+
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
+	closeOnce   sync.Once
+}
+
+// defaultMemoryStoreCleanupInterval is used by NewMemoryStore when the given
+// interval is not positive.
+const defaultMemoryStoreCleanupInterval = time.Hour
+
+// NewMemoryStore creates a new in-memory session store and invalidation cache.
+// It starts a background goroutine that evicts expired sessions and
+// invalidations every cleanupInterval; call Close to stop it.
+// A cleanupInterval of 0 or less means the default of one hour.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	if cleanupInterval <= 0 {
+		cleanupInterval = defaultMemoryStoreCleanupInterval
+	}
+
+	s := &MemoryStore{
+		MemorySessionStore: NewMemorySessionStore(),
+		MemoryCache:        newMemoryCache(),
+		stopCleanup:        make(chan struct{}),
+		cleanupDone:        make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.cleanupDone)
+		s.cleanupLoop(cleanupInterval)
+	}()
+
+	return s
+}
+
+// Clear removes all sessions and invalidations.
+// It is intended for resetting state between tests.
+func (s *MemoryStore) Clear(ctx context.Context) error {
+	if err := s.MemorySessionStore.Clear(ctx); err != nil {
+		return err
+	}
+	return s.MemoryCache.Clear(ctx)
+}
+
+// Close stops the background cleanup goroutine, waiting for a cleanup in
+// progress to finish.
+// It is safe to call more than once, since the store is typically passed to
+// Heimdall as both SessionStore and InvalidationCache.
+func (s *MemoryStore) Close() error {
+	s.closeOnce.Do(func() { close(s.stopCleanup) })
+	<-s.cleanupDone
+	return nil
+}
+
+// cleanupLoop periodically evicts expired sessions and invalidations.
+func (s *MemoryStore) cleanupLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.cleanup()
+		case <-s.stopCleanup:
+			return
+		}
+	}
+}
+
+// cleanup evicts expired sessions and invalidations.
+func (s *MemoryStore) cleanup() {
+	s.MemorySessionStore.cleanup()
+	s.MemoryCache.cleanup()
+}
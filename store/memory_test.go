@@ -0,0 +1,286 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheLen(t *testing.T) {
+	cache := NewMemoryCache()
+	defer cache.Close()
+
+	if n, _ := cache.Len(); n != 0 {
+		t.Fatalf("Expected empty cache, got %d entries", n)
+	}
+
+	cache.Set("session1", time.Hour)
+	cache.Set("session2", time.Millisecond)
+	cache.Set("session1", time.Hour) // re-setting does not add an entry
+
+	if n, _ := cache.Len(); n != 2 {
+		t.Errorf("Expected 2 entries, got %d", n)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	cache.cleanup()
+
+	if n, _ := cache.Len(); n != 1 {
+		t.Errorf("Expected 1 entry after expiry cleanup, got %d", n)
+	}
+}
+
+func TestMemoryCacheMaxEntries(t *testing.T) {
+	var logs bytes.Buffer
+	cache := NewMemoryCacheWithOptions(MemoryCacheOptions{
+		MaxEntries: 3,
+		Logger:     slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	defer cache.Close()
+
+	cache.Set("session1", 3*time.Hour)
+	cache.Set("session2", time.Hour) // closest to expiry
+	cache.Set("session3", 2*time.Hour)
+	cache.Set("session4", 4*time.Hour)
+
+	if n, _ := cache.Len(); n != 3 {
+		t.Errorf("Expected 3 entries, got %d", n)
+	}
+	for id, want := range map[string]bool{"session1": true, "session2": false, "session3": true, "session4": true} {
+		if got, _ := cache.Exists(id); got != want {
+			t.Errorf("Exists(%s) = %v, want %v", id, got, want)
+		}
+	}
+	if !strings.Contains(logs.String(), "evicted before expiry") {
+		t.Errorf("Expected a warning for the early eviction, got %q", logs.String())
+	}
+
+	// Re-setting an entry moves its expiry, so session3 is now evicted first
+	// and session1 survives
+	cache.Set("session1", 5*time.Hour)
+	cache.Set("session5", 6*time.Hour)
+	for id, want := range map[string]bool{"session1": true, "session3": false, "session4": true, "session5": true} {
+		if got, _ := cache.Exists(id); got != want {
+			t.Errorf("Exists(%s) = %v, want %v", id, got, want)
+		}
+	}
+
+	// Expired entries are evicted without a warning
+	logs.Reset()
+	cache.Clear(context.Background())
+	cache.Set("expired", -time.Second)
+	cache.Set("session6", time.Hour)
+	cache.Set("session7", time.Hour)
+	cache.Set("session8", time.Hour)
+	if n, _ := cache.Len(); n != 3 {
+		t.Errorf("Expected 3 entries after Clear, got %d", n)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected no warning for evicting an expired entry, got %q", logs.String())
+	}
+
+	// Cleanup keeps the heap in step with the map
+	cache.Set("session9", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	cache.cleanup()
+	cache.Set("session10", time.Hour)
+	if n, _ := cache.Len(); n != 3 {
+		t.Errorf("Expected 3 entries after cleanup, got %d", n)
+	}
+}
+
+func TestMemorySessionStoreSessionExists(t *testing.T) {
+	s := NewMemorySessionStore()
+
+	for _, id := range []string{"active", "invalidated"} {
+		if err := s.Save(newTestSession(id, "user1")); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+	if err := s.Delete("invalidated"); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+
+	tests := []struct {
+		sessionID string
+		want      bool
+	}{
+		{"active", true},
+		{"absent", false},
+		{"invalidated", false},
+	}
+
+	for _, tt := range tests {
+		got, err := s.SessionExists(tt.sessionID)
+		if err != nil {
+			t.Fatalf("SessionExists(%q) failed: %v", tt.sessionID, err)
+		}
+		if got != tt.want {
+			t.Errorf("SessionExists(%q) = %v, want %v", tt.sessionID, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryClear(t *testing.T) {
+	s := NewMemorySessionStore()
+	cache := NewMemoryCache()
+	defer cache.Close()
+
+	if err := s.Save(newTestSession("session1", "user1")); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+	cache.Set("session1", time.Hour)
+
+	if err := s.Clear(context.Background()); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if err := cache.Clear(context.Background()); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+
+	if sessions, _ := s.GetActiveByUser("user1"); len(sessions) != 0 {
+		t.Errorf("Expected no sessions after Clear, got %d", len(sessions))
+	}
+	if exists, _ := cache.Exists("session1"); exists {
+		t.Error("Expected no invalidations after Clear")
+	}
+}
+
+func TestMemoryStoreEvictsExpiredSessions(t *testing.T) {
+	s := NewMemoryStore(time.Hour)
+	defer s.Close()
+
+	active := newTestSession("active", "user1")
+	expired := newTestSession("expired", "user2")
+	expired.CreatedAt = time.Now().Add(-2 * time.Hour)
+	for _, session := range []*Session{active, expired} {
+		if err := s.Save(session); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+	s.Set("invalidated", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	s.cleanup()
+
+	if _, ok := s.sessions["expired"]; ok {
+		t.Error("Expected the expired session to be evicted")
+	}
+	if _, ok := s.byUser["user2"]; ok {
+		t.Error("Expected the user index of the expired session to be evicted")
+	}
+	if _, ok := s.sessions["active"]; !ok {
+		t.Error("Expected the active session to be kept")
+	}
+	if n, _ := s.Len(); n != 0 {
+		t.Errorf("Expected the expired invalidation to be evicted, got %d entries", n)
+	}
+}
+
+func TestMemoryStoreDefaultCleanupInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		// Must not panic on a non-positive ticker interval
+		s := NewMemoryStore(interval)
+		if err := s.Close(); err != nil {
+			t.Errorf("NewMemoryStore(%v): failed to close: %v", interval, err)
+		}
+	}
+}
+
+func TestMemoryStoreCleanupLoop(t *testing.T) {
+	s := NewMemoryStore(10 * time.Millisecond)
+	defer s.Close()
+
+	expired := newTestSession("expired", "user1")
+	expired.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := s.Save(expired); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.MemorySessionStore.mu.RLock()
+		n := len(s.sessions)
+		s.MemorySessionStore.mu.RUnlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the cleanup goroutine to evict the expired session")
+}
+
+func TestMemoryStoreConformance(t *testing.T) {
+	RunSessionStoreConformance(t, func() SessionStore {
+		return NewMemoryStore(time.Hour)
+	})
+	RunInvalidationCacheConformance(t, func() InvalidationCache {
+		return NewMemoryStore(time.Hour)
+	})
+}
+
+func TestMemorySessionStoreConformance(t *testing.T) {
+	RunSessionStoreConformance(t, func() SessionStore {
+		return NewMemorySessionStore()
+	})
+}
+
+func TestMemoryCacheConformance(t *testing.T) {
+	RunInvalidationCacheConformance(t, func() InvalidationCache {
+		return NewMemoryCache()
+	})
+}
+
+func TestBoundedMemoryCacheConformance(t *testing.T) {
+	RunInvalidationCacheConformance(t, func() InvalidationCache {
+		return NewMemoryCacheWithOptions(MemoryCacheOptions{MaxEntries: 1000})
+	})
+}
+
+func TestMemorySessionStoreCountLoginsByBucket(t *testing.T) {
+	s := NewMemorySessionStore()
+	defer s.Close()
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, offset := range []time.Duration{-time.Minute, 0, 59 * time.Minute, 2 * time.Hour, 150 * time.Minute, 3 * time.Hour} {
+		session := &Session{
+			SessionID:  fmt.Sprintf("session%d", i),
+			UserID:     "user1",
+			TTLSeconds: 60,
+			CreatedAt:  from.Add(offset),
+		}
+		if err := s.Save(session); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+
+	counts, err := s.CountLoginsByBucket("user1", from, from.Add(3*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatalf("CountLoginsByBucket failed: %v", err)
+	}
+	if fmt.Sprint(counts) != "[2 0 2]" {
+		t.Errorf("Expected [2 0 2], got %v", counts)
+	}
+}
+
+// countingLogger counts warnings.
+type countingLogger struct{ warnings int }
+
+func (l *countingLogger) Warn(string, ...any) { l.warnings++ }
+
+func TestMemoryCacheMaxEntriesCustomLogger(t *testing.T) {
+	logger := &countingLogger{}
+	cache := NewMemoryCacheWithOptions(MemoryCacheOptions{MaxEntries: 2, Logger: logger})
+	defer cache.Close()
+
+	for _, id := range []string{"session1", "session2", "session3", "session4"} {
+		cache.Set(id, time.Hour)
+	}
+	if logger.warnings != 2 {
+		t.Errorf("Expected one warning per evicting Set, got %d", logger.warnings)
+	}
+}
@@ -1,10 +1,14 @@
 package store
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 // MySQLStore implements SessionStore using MySQL.
@@ -25,15 +29,53 @@ func NewMySQL(db *sql.DB) (*MySQLStore, error) {
 	return &MySQLStore{db: db}, nil
 }
 
+// MySQLOptions contains optional settings for NewMySQLFromDSNWithOptions.
+type MySQLOptions struct {
+	// ConnectRetries is how many times to retry the initial connection,
+	// so startup survives a database that comes up a few seconds later.
+	// Default: 0 (fail on the first error).
+	ConnectRetries int
+
+	// ConnectBackoff is the wait before the first retry. It doubles after
+	// every failed attempt.
+	// Default: 1 second.
+	ConnectBackoff time.Duration
+
+	// TLSConfig, if set, encrypts connections with this configuration,
+	// taking precedence over the DSN's tls parameter.
+	// Default: nil (use the DSN's tls parameter, if any).
+	TLSConfig *tls.Config
+}
+
 // NewMySQLFromDSN creates a new MySQL session store from a DSN.
+// The DSN format is: user:password@tcp(host:port)/database[?params]
+// To require TLS, add tls=true (verify the server certificate), tls=skip-verify,
+// tls=preferred or the name of a config registered with mysql.RegisterTLSConfig,
+// or pass MySQLOptions.TLSConfig to NewMySQLFromDSNWithOptions.
+// Invalid DSNs, including unknown tls values, are rejected before connecting.
 func NewMySQLFromDSN(dsn string) (*MySQLStore, error) {
-	db, err := sql.Open("mysql", dsn+"?parseTime=true")
+	return NewMySQLFromDSNWithOptions(dsn, MySQLOptions{})
+}
+
+// NewMySQLFromDSNWithOptions is like NewMySQLFromDSN but accepts additional options.
+func NewMySQLFromDSNWithOptions(dsn string, opts MySQLOptions) (*MySQLStore, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: invalid DSN: %w", err)
+	}
+	cfg.ParseTime = true
+	if opts.TLSConfig != nil {
+		cfg.TLS = opts.TLSConfig
+	}
+
+	connector, err := mysql.NewConnector(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("mysql: failed to open database: %w", err)
 	}
+	db := sql.OpenDB(connector)
 
 	// Test connection
-	if err := db.Ping(); err != nil {
+	if err := pingWithRetry(db, opts.ConnectRetries, opts.ConnectBackoff); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("mysql: failed to connect: %w", err)
 	}
@@ -41,6 +83,22 @@ func NewMySQLFromDSN(dsn string) (*MySQLStore, error) {
 	return NewMySQL(db)
 }
 
+// pingWithRetry pings db, retrying up to retries times with exponential
+// backoff starting at backoff. It returns the last error if all attempts fail.
+func pingWithRetry(db *sql.DB, retries int, backoff time.Duration) error {
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	err := db.Ping()
+	for attempt := 0; err != nil && attempt < retries; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = db.Ping()
+	}
+	return err
+}
+
 func createMySQLSchema(db *sql.DB) error {
 	// NOTE: MySQL does not support partial indexes. For PostgreSQL, you could use:
 	//   CREATE INDEX idx_active_sessions ON sessions (user_id, expires_at)
@@ -55,47 +113,121 @@ func createMySQLSchema(db *sql.DB) error {
 		browser        VARCHAR(100),
 		os             VARCHAR(100),
 		device_type    VARCHAR(20),
+		device_fingerprint VARCHAR(128),
 		loc_city       VARCHAR(100),
 		loc_country    VARCHAR(100),
+		loc_country_code CHAR(2),
 		loc_lat        DECIMAL(10, 8),
 		loc_lng        DECIMAL(11, 8),
+		loc_geohash    VARCHAR(12),
+		loc_asn        INT UNSIGNED,
+		group_key      VARCHAR(255),
+		sealed         BLOB,
 		ttl_seconds    INT NOT NULL,
 		created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		expires_at     TIMESTAMP AS (DATE_ADD(created_at, INTERVAL ttl_seconds SECOND)) STORED,
 		invalidated_at TIMESTAMP NULL DEFAULT NULL,
 		
-		INDEX idx_sessions_user_active (user_id, expires_at, invalidated_at)
+		INDEX idx_sessions_user_active (user_id, expires_at, invalidated_at),
+		INDEX idx_sessions_device_ip (device_ip),
+		INDEX idx_sessions_country (loc_country_code),
+		INDEX idx_sessions_group (group_key, expires_at, invalidated_at),
+		INDEX idx_sessions_expires (expires_at)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 	`
 
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("mysql: failed to create schema: %w", err)
 	}
+	return migrateMySQLSchema(db)
+}
+
+// mysqlAddedColumns lists columns added after the initial schema, so that
+// databases created by older versions can be upgraded in place.
+var mysqlAddedColumns = []struct{ name, definition string }{
+	{"loc_country_code", "CHAR(2)"},
+	{"loc_geohash", "VARCHAR(12)"},
+	{"group_key", "VARCHAR(255)"},
+	{"sealed", "BLOB"},
+	{"device_fingerprint", "VARCHAR(128)"},
+	{"loc_asn", "INT UNSIGNED"},
+}
+
+// migrateMySQLSchema adds any columns missing from an existing sessions table.
+func migrateMySQLSchema(db *sql.DB) error {
+	for _, col := range mysqlAddedColumns {
+		var count int
+		err := db.QueryRow(
+			`SELECT COUNT(*) FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'sessions' AND COLUMN_NAME = ?`,
+			col.name,
+		).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("mysql: failed to read schema: %w", err)
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE sessions ADD COLUMN " + col.name + " " + col.definition); err != nil {
+			return fmt.Errorf("mysql: failed to add column %s: %w", col.name, err)
+		}
+	}
 	return nil
 }
 
 // Save persists a new session.
 func (s *MySQLStore) Save(session *Session) error {
+	return saveMySQLSession(s.db, session)
+}
+
+// SaveAll persists sessions in one transaction.
+func (s *MySQLStore) SaveAll(sessions []*Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("mysql: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, session := range sessions {
+		if err := saveMySQLSession(tx, session); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("mysql: failed to commit sessions: %w", err)
+	}
+	return nil
+}
+
+// saveMySQLSession persists a session using db.
+func saveMySQLSession(db sqlExecer, session *Session) error {
 	query := `
 	INSERT INTO sessions (
-		session_id, user_id, device_ip, device_ua, browser, os, device_type,
-		loc_city, loc_country, loc_lat, loc_lng, ttl_seconds, created_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		session_id, user_id, device_ip, device_ua, browser, os, device_type, device_fingerprint,
+		loc_city, loc_country, loc_country_code, loc_lat, loc_lng, loc_geohash, loc_asn, group_key, sealed, ttl_seconds, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON DUPLICATE KEY UPDATE
 		device_ip = VALUES(device_ip),
 		device_ua = VALUES(device_ua),
 		browser = VALUES(browser),
 		os = VALUES(os),
 		device_type = VALUES(device_type),
+		device_fingerprint = VALUES(device_fingerprint),
 		loc_city = VALUES(loc_city),
 		loc_country = VALUES(loc_country),
+		loc_country_code = VALUES(loc_country_code),
 		loc_lat = VALUES(loc_lat),
 		loc_lng = VALUES(loc_lng),
+		loc_geohash = VALUES(loc_geohash),
+		loc_asn = VALUES(loc_asn),
+		group_key = VALUES(group_key),
+		sealed = VALUES(sealed),
 		ttl_seconds = VALUES(ttl_seconds),
 		created_at = VALUES(created_at)
 	`
 
-	_, err := s.db.Exec(query,
+	_, err := db.Exec(query,
 		session.SessionID,
 		session.UserID,
 		session.DeviceIP,
@@ -103,10 +235,16 @@ func (s *MySQLStore) Save(session *Session) error {
 		session.Browser,
 		session.OS,
 		session.DeviceType,
+		session.DeviceFingerprint,
 		session.LocCity,
 		session.LocCountry,
+		session.LocCountryCode,
 		session.LocLat,
 		session.LocLng,
+		session.LocGeohash,
+		session.LocASN,
+		session.GroupKey,
+		session.Sealed,
 		session.TTLSeconds,
 		session.CreatedAt,
 	)
@@ -129,23 +267,480 @@ func (s *MySQLStore) Delete(sessionID string) error {
 	return nil
 }
 
+// CountInvalidated returns the number of sessions invalidated at or after
+// since. Sessions are invalidated by Delete, so this counts invalidations
+// even when another backend serves as the invalidation cache.
+func (s *MySQLStore) CountInvalidated(since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE invalidated_at >= ?", since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("mysql: failed to count invalidations: %w", err)
+	}
+	return count, nil
+}
+
 // GetActiveByUser returns all non-expired, non-invalidated sessions for a user.
 func (s *MySQLStore) GetActiveByUser(userID string) ([]*Session, error) {
-	query := `
-	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type,
-		   loc_city, loc_country, loc_lat, loc_lng, ttl_seconds, created_at
+	return s.queryActiveByUser(mysqlActiveByUserQuery, userID)
+}
+
+// GetActiveByUserLimit returns the user's newest limit active sessions.
+func (s *MySQLStore) GetActiveByUserLimit(userID string, limit int) ([]*Session, error) {
+	return s.queryActiveByUser(mysqlActiveByUserQuery+" LIMIT ?", userID, limit)
+}
+
+const mysqlActiveByUserQuery = `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
 	FROM sessions
 	WHERE user_id = ? AND expires_at > NOW() AND invalidated_at IS NULL
+	ORDER BY created_at DESC`
+
+// queryActiveByUser runs a query for a user's active sessions.
+func (s *MySQLStore) queryActiveByUser(query string, args ...any) ([]*Session, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanMySQLSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetSession returns the active session with the given ID, or nil if there is none.
+func (s *MySQLStore) GetSession(sessionID string) (*Session, error) {
+	query := `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	WHERE session_id = ? AND expires_at > NOW() AND invalidated_at IS NULL
+	`
+
+	rows, err := s.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to query session: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("mysql: failed to query session: %w", err)
+		}
+		return nil, nil
+	}
+	return scanMySQLSession(rows)
+}
+
+// GetExpiredByUser returns the user's non-invalidated sessions that expired
+// after since.
+func (s *MySQLStore) GetExpiredByUser(userID string, since time.Time) ([]*Session, error) {
+	query := `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	WHERE user_id = ? AND expires_at > ? AND expires_at <= NOW() AND invalidated_at IS NULL
+	ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.Query(query, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to query expired sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanMySQLSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetExpiringSoon returns the active sessions expiring within the given
+// duration, soonest first. Tables created by older versions lack the index
+// this relies on; add it before using it on large tables:
+//
+//	CREATE INDEX idx_sessions_expires ON sessions (expires_at);
+func (s *MySQLStore) GetExpiringSoon(within time.Duration) ([]*Session, error) {
+	query := `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	WHERE expires_at > NOW() AND expires_at <= NOW() + INTERVAL ? SECOND AND invalidated_at IS NULL
+	ORDER BY expires_at
+	`
+
+	rows, err := s.db.Query(query, int64(within.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to query expiring sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanMySQLSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// SessionExists returns true if an active session with the given ID exists.
+func (s *MySQLStore) SessionExists(sessionID string) (bool, error) {
+	var one int
+	err := s.db.QueryRow(
+		"SELECT 1 FROM sessions WHERE session_id = ? AND expires_at > NOW() AND invalidated_at IS NULL LIMIT 1",
+		sessionID,
+	).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("mysql: failed to check session: %w", err)
+	}
+	return true, nil
+}
+
+// HasActiveByUser reports whether the user has a non-expired,
+// non-invalidated session.
+func (s *MySQLStore) HasActiveByUser(userID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sessions WHERE user_id = ? AND expires_at > NOW() AND invalidated_at IS NULL)",
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("mysql: failed to check active sessions: %w", err)
+	}
+	return exists, nil
+}
+
+// GetActiveByDeviceType returns the active sessions with the given device
+// type, of the user or, if userID is empty, of all users.
+func (s *MySQLStore) GetActiveByDeviceType(userID, deviceType string) ([]*Session, error) {
+	query := `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	WHERE device_type = ? AND expires_at > NOW() AND invalidated_at IS NULL`
+	args := []any{deviceType}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY created_at DESC"
+
+	return s.queryActiveByUser(query, args...)
+}
+
+// CountDistinctIPs returns the number of distinct device IPs across the user's
+// sessions created at or after since, including expired and invalidated ones.
+func (s *MySQLStore) CountDistinctIPs(userID string, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(DISTINCT device_ip) FROM sessions WHERE user_id = ? AND created_at >= ?",
+		userID, since,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("mysql: failed to count distinct IPs: %w", err)
+	}
+	return count, nil
+}
+
+// CountLoginsByBucket counts the user's sessions created at or after from and
+// before to, per bucket-long interval, including expired and invalidated
+// ones. Sessions are grouped to whole seconds.
+func (s *MySQLStore) CountLoginsByBucket(userID string, from, to time.Time, bucket time.Duration) ([]int, error) {
+	rows, err := s.db.Query(`
+	SELECT TIMESTAMPDIFF(SECOND, ?, created_at) DIV ?, COUNT(*)
+	FROM sessions
+	WHERE user_id = ? AND created_at >= ? AND created_at < ?
+	GROUP BY 1`,
+		from, int64(bucket/time.Second), userID, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to count logins: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]int, bucketCount(from, to, bucket))
+	for rows.Next() {
+		var index, count int
+		if err := rows.Scan(&index, &count); err != nil {
+			return nil, fmt.Errorf("mysql: failed to scan login count: %w", err)
+		}
+		counts[min(max(index, 0), len(counts)-1)] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: error iterating login counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CountSessionsByUser returns the number of sessions the user has created,
+// including expired and invalidated ones.
+func (s *MySQLStore) CountSessionsByUser(userID string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("mysql: failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// UsersOverLimit returns the users with more than limit active sessions.
+func (s *MySQLStore) UsersOverLimit(limit int) ([]UserSessionCount, error) {
+	rows, err := s.db.Query(`
+	SELECT user_id, COUNT(*) FROM sessions
+	WHERE expires_at > NOW() AND invalidated_at IS NULL
+	GROUP BY user_id
+	HAVING COUNT(*) > ?
+	ORDER BY COUNT(*) DESC, user_id
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to count sessions by user: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []UserSessionCount{}
+	for rows.Next() {
+		var count UserSessionCount
+		if err := rows.Scan(&count.UserID, &count.Count); err != nil {
+			return nil, fmt.Errorf("mysql: failed to scan session count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: error iterating session counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// DeviceIPsByUser returns the distinct device IPs across the user's sessions,
+// including expired and invalidated ones.
+func (s *MySQLStore) DeviceIPsByUser(userID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT device_ip FROM sessions WHERE user_id = ? AND device_ip IS NOT NULL", userID)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to query device IPs: %w", err)
+	}
+	defer rows.Close()
+
+	ips := []string{}
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("mysql: failed to scan device IP: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: error iterating device IPs: %w", err)
+	}
+
+	return ips, nil
+}
+
+// UpdateLocationByIP sets the location of the user's sessions from ip to loc,
+// including expired and invalidated ones.
+func (s *MySQLStore) UpdateLocationByIP(userID, ip string, loc Location) (int, error) {
+	result, err := s.db.Exec(`
+	UPDATE sessions
+	SET loc_city = ?, loc_country = ?, loc_country_code = ?, loc_lat = ?, loc_lng = ?, loc_geohash = ?
+	WHERE user_id = ? AND device_ip = ?
+		AND NOT (loc_city <=> ? AND loc_country <=> ? AND loc_country_code <=> ? AND loc_lat <=> ? AND loc_lng <=> ? AND loc_geohash <=> ?)`,
+		loc.City, loc.Country, loc.CountryCode, loc.Lat, loc.Lng, loc.Geohash,
+		userID, ip,
+		loc.City, loc.Country, loc.CountryCode, loc.Lat, loc.Lng, loc.Geohash,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("mysql: failed to update location: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("mysql: failed to update location: %w", err)
+	}
+	return int(updated), nil
+}
+
+// CountActiveByGroup returns the number of non-expired, non-invalidated
+// sessions with the given group key. Tables created by older versions lack
+// the index this relies on; add it before using group limits on large tables:
+//
+//	CREATE INDEX idx_sessions_group ON sessions (group_key, expires_at, invalidated_at);
+func (s *MySQLStore) CountActiveByGroup(groupKey string) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE group_key = ? AND expires_at > NOW() AND invalidated_at IS NULL",
+		groupKey,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("mysql: failed to count group sessions: %w", err)
+	}
+	return count, nil
+}
+
+// LastLoginAt returns the most recent CreatedAt across all of the user's
+// sessions, including expired and invalidated ones.
+func (s *MySQLStore) LastLoginAt(userID string) (time.Time, bool, error) {
+	var createdAt time.Time
+	err := s.db.QueryRow(
+		"SELECT created_at FROM sessions WHERE user_id = ? ORDER BY created_at DESC LIMIT 1",
+		userID,
+	).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("mysql: failed to get last login: %w", err)
+	}
+	return createdAt, true, nil
+}
+
+// GetSessionAudit returns the session with the given ID regardless of its
+// state, and the time it was invalidated.
+func (s *MySQLStore) GetSessionAudit(sessionID string) (*Session, time.Time, error) {
+	var invalidatedAt sql.NullTime
+	err := s.db.QueryRow(
+		"SELECT invalidated_at FROM sessions WHERE session_id = ?",
+		sessionID,
+	).Scan(&invalidatedAt)
+	if err == sql.ErrNoRows {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("mysql: failed to query invalidation: %w", err)
+	}
+
+	query := `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	WHERE session_id = ?
+	`
+
+	rows, err := s.db.Query(query, sessionID)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("mysql: failed to query session: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, time.Time{}, fmt.Errorf("mysql: failed to query session: %w", err)
+		}
+		return nil, time.Time{}, nil
+	}
+	session, err := scanMySQLSession(rows)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return session, invalidatedAt.Time, nil
+}
+
+// GetActiveByUserAt returns the user's sessions that were active at t.
+func (s *MySQLStore) GetActiveByUserAt(userID string, t time.Time) ([]*Session, error) {
+	query := `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	WHERE user_id = ? AND created_at <= ? AND expires_at > ? AND (invalidated_at IS NULL OR invalidated_at > ?)
 	ORDER BY created_at DESC
 	`
 
-	rows, err := s.db.Query(query, userID)
+	rows, err := s.db.Query(query, userID, t, t, t)
 	if err != nil {
 		return nil, fmt.Errorf("mysql: failed to query sessions: %w", err)
 	}
 	defer rows.Close()
 
-	var sessions []*Session
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanMySQLSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// FindSessions returns all sessions matching filter, across all users.
+// Tables created by older versions lack the indexes this relies on; add them
+// before searching large tables:
+//
+//	CREATE INDEX idx_sessions_device_ip ON sessions (device_ip);
+//	CREATE INDEX idx_sessions_country ON sessions (loc_country_code);
+func (s *MySQLStore) FindSessions(filter SessionFilter) ([]*Session, error) {
+	query := `
+	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	WHERE 1 = 1`
+	var args []any
+	if filter.DeviceIP != "" {
+		query += " AND device_ip = ?"
+		args = append(args, filter.DeviceIP)
+	}
+	if filter.CountryCode != "" {
+		query += " AND loc_country_code = ?"
+		args = append(args, strings.ToUpper(filter.CountryCode))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.CreatedBefore)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: failed to search sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
 	for rows.Next() {
 		session, err := scanMySQLSession(rows)
 		if err != nil {
@@ -161,6 +756,16 @@ func (s *MySQLStore) GetActiveByUser(userID string) ([]*Session, error) {
 	return sessions, nil
 }
 
+// Clear deletes all sessions, including invalidated ones.
+// It is intended for resetting state between tests; never call it on a
+// production database.
+func (s *MySQLStore) Clear(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM sessions"); err != nil {
+		return fmt.Errorf("mysql: failed to clear sessions: %w", err)
+	}
+	return nil
+}
+
 // Close closes the database connection.
 func (s *MySQLStore) Close() error {
 	return s.db.Close()
@@ -176,12 +781,19 @@ func scanMySQLSession(rows *sql.Rows) (*Session, error) {
 		&session.Browser,
 		&session.OS,
 		&session.DeviceType,
+		&session.DeviceFingerprint,
 		&session.LocCity,
 		&session.LocCountry,
+		&session.LocCountryCode,
 		&session.LocLat,
 		&session.LocLng,
+		&session.LocGeohash,
+		&session.LocASN,
+		&session.GroupKey,
+		&session.Sealed,
 		&session.TTLSeconds,
 		&session.CreatedAt,
+		&session.StoredExpiresAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("mysql: failed to scan session: %w", err)
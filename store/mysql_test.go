@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyDriver is a database/sql driver whose connections fail until the
+// given number of attempts has been made.
+type flakyDriver struct {
+	attempts  atomic.Int32
+	succeedAt int32
+}
+
+func (d *flakyDriver) Open(string) (driver.Conn, error) {
+	if d.attempts.Add(1) < d.succeedAt {
+		return nil, errors.New("connection refused")
+	}
+	return flakyConn{}, nil
+}
+
+type flakyConn struct{}
+
+func (flakyConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (flakyConn) Close() error                        { return nil }
+func (flakyConn) Begin() (driver.Tx, error)           { return nil, errors.New("not implemented") }
+
+func TestPingWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      int
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{"succeeds on third ping", 2, false, 3},
+		{"gives up after retries", 1, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &flakyDriver{succeedAt: 3}
+			db := sql.OpenDB(flakyConnector{d})
+			defer db.Close()
+
+			err := pingWithRetry(db, tt.retries, time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("pingWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := d.attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("Expected %d connection attempts, got %d", tt.wantAttempts, got)
+			}
+		})
+	}
+}
+
+func TestNewMySQLFromDSNInvalidTLS(t *testing.T) {
+	// Rejected while parsing, so nothing listens on the address
+	_, err := NewMySQLFromDSN("user:pass@tcp(127.0.0.1:1)/heimdall?tls=unregistered")
+	if err == nil || !strings.Contains(err.Error(), "invalid DSN") {
+		t.Errorf("Expected an invalid DSN error, got %v", err)
+	}
+}
+
+// flakyConnector opens connections through a flakyDriver.
+type flakyConnector struct {
+	d *flakyDriver
+}
+
+func (c flakyConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c flakyConnector) Driver() driver.Driver                            { return c.d }
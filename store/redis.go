@@ -2,7 +2,10 @@ package store
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -38,14 +41,19 @@ type RedisConfig struct {
 	// KeyPrefix is prepended to all keys (default: "heimdall:invalidated:")
 	// typically ends with a colon.
 	KeyPrefix string
+
+	// TLSConfig, if set, connects over TLS with this configuration
+	// (default: nil, plaintext)
+	TLSConfig *tls.Config
 }
 
 // NewRedis creates a new Redis invalidation cache.
 func NewRedisFromConfig(cfg RedisConfig) (*RedisCache, error) {
 	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
+		Addr:      cfg.Addr,
+		Password:  cfg.Password,
+		DB:        cfg.DB,
+		TLSConfig: cfg.TLSConfig,
 	})
 
 	// Test connection
@@ -73,7 +81,8 @@ func (c *RedisCache) Set(sessionID string, ttl time.Duration) error {
 	ctx := context.Background()
 	key := c.prefix + sessionID
 
-	err := c.client.Set(ctx, key, "1", ttl).Err()
+	// Store the invalidation time so ListInvalidated can filter by it
+	err := c.client.Set(ctx, key, time.Now().Unix(), ttl).Err()
 	if err != nil {
 		return fmt.Errorf("redis: failed to set key: %w", err)
 	}
@@ -92,6 +101,165 @@ func (c *RedisCache) Exists(sessionID string) (bool, error) {
 	return result > 0, nil
 }
 
+// ExistsMany reports for each session ID whether it has been invalidated,
+// fetching up to 1000 keys per round trip with MGET.
+func (c *RedisCache) ExistsMany(sessionIDs []string) ([]bool, error) {
+	ctx := context.Background()
+
+	exists := make([]bool, len(sessionIDs))
+	for start := 0; start < len(sessionIDs); start += 1000 {
+		batch := sessionIDs[start:min(start+1000, len(sessionIDs))]
+
+		keys := make([]string, len(batch))
+		for i, sessionID := range batch {
+			keys[i] = c.prefix + sessionID
+		}
+
+		values, err := c.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis: failed to get keys: %w", err)
+		}
+		for i, value := range values {
+			exists[start+i] = value != nil
+		}
+	}
+	return exists, nil
+}
+
+// ListInvalidated returns the IDs of sessions invalidated at or after since.
+// Like Len, it walks the keyspace with SCAN and then fetches each key's
+// invalidation time, so it is O(N) in the size of the whole database.
+// Run it from a background sync job, not on request paths.
+// Entries written before invalidation times were recorded, which hold "1"
+// instead of a Unix time, are always included.
+func (c *RedisCache) ListInvalidated(since time.Time) ([]string, error) {
+	ctx := context.Background()
+
+	var keys []string
+	iter := c.client.Scan(ctx, 0, c.prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis: failed to scan keys: %w", err)
+	}
+
+	ids := []string{}
+	for start := 0; start < len(keys); start += 1000 {
+		batch := keys[start:min(start+1000, len(keys))]
+
+		values, err := c.client.MGet(ctx, batch...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis: failed to get keys: %w", err)
+		}
+
+		for i, value := range values {
+			if value == nil {
+				continue // Expired since the scan
+			}
+			if invalidatedBefore(fmt.Sprint(value), since) {
+				continue
+			}
+			ids = append(ids, strings.TrimPrefix(batch[i], c.prefix))
+		}
+	}
+	return ids, nil
+}
+
+// invalidatedBefore reports whether an entry's value records an invalidation
+// before since. Legacy entries hold "1" rather than a Unix time, and like
+// other values that are not plausible Unix times, are never before since.
+func invalidatedBefore(value string, since time.Time) bool {
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ts < minInvalidationUnix {
+		return false
+	}
+	return ts < since.Unix()
+}
+
+// minInvalidationUnix is the earliest plausible invalidation time recorded by
+// Set (2001-09-09). Smaller values come from entries written before
+// invalidation times were recorded.
+const minInvalidationUnix = 1_000_000_000
+
+// Len returns the number of invalidation keys under the cache's prefix.
+// It walks the keyspace with SCAN, so it is O(N) in the size of the whole
+// database and the result is approximate if keys change during the scan.
+// Avoid calling it on hot paths.
+func (c *RedisCache) Len() (int, error) {
+	ctx := context.Background()
+
+	count := 0
+	iter := c.client.Scan(ctx, 0, c.prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("redis: failed to scan keys: %w", err)
+	}
+	return count, nil
+}
+
+// Reprefix moves invalidation keys written under oldPrefix to the cache's
+// current prefix, so invalidations survive a KeyPrefix change.
+// Keys keep their remaining TTL. If a key already exists under the new
+// prefix, it is kept and the old key is dropped.
+//
+// This is an admin operation for migrations: it walks the keyspace with SCAN
+// and issues one RENAME per key. Run it once after deploying the new prefix.
+// On Redis Cluster, old and new keys must hash to the same slot.
+func (c *RedisCache) Reprefix(ctx context.Context, oldPrefix string) error {
+	if oldPrefix == c.prefix {
+		return nil
+	}
+
+	iter := c.client.Scan(ctx, 0, oldPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		oldKey := iter.Val()
+
+		// If the new prefix extends the old one, the scan also matches
+		// keys already under the new prefix
+		if len(c.prefix) > len(oldPrefix) && strings.HasPrefix(oldKey, c.prefix) {
+			continue
+		}
+
+		newKey := c.prefix + strings.TrimPrefix(oldKey, oldPrefix)
+		renamed, err := c.client.RenameNX(ctx, oldKey, newKey).Result()
+		if err != nil {
+			if err == redis.Nil || strings.Contains(err.Error(), "no such key") {
+				continue // Expired since the scan
+			}
+			return fmt.Errorf("redis: failed to rename key %s: %w", oldKey, err)
+		}
+		if !renamed {
+			if err := c.client.Del(ctx, oldKey).Err(); err != nil {
+				return fmt.Errorf("redis: failed to delete key %s: %w", oldKey, err)
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("redis: failed to scan keys: %w", err)
+	}
+	return nil
+}
+
+// Clear deletes all invalidation entries under the cache's prefix.
+// Other keys in the database are left alone.
+// It is intended for resetting state between tests; never call it on a
+// production cache.
+func (c *RedisCache) Clear(ctx context.Context) error {
+	iter := c.client.Scan(ctx, 0, c.prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		if err := c.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return fmt.Errorf("redis: failed to delete key %s: %w", iter.Val(), err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("redis: failed to scan keys: %w", err)
+	}
+	return nil
+}
+
 // Close closes the Redis connection.
 func (c *RedisCache) Close() error {
 	return c.client.Close()
@@ -0,0 +1,181 @@
+//go:build integration
+
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisClient connects to the Redis server in HEIMDALL_TEST_REDIS_ADDR.
+// The selected database is flushed before and after the test.
+func newTestRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+
+	addr := os.Getenv("HEIMDALL_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("HEIMDALL_TEST_REDIS_ADDR not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	ctx := context.Background()
+	if err := client.FlushDB(ctx).Err(); err != nil {
+		t.Fatalf("Failed to flush Redis: %v", err)
+	}
+	t.Cleanup(func() {
+		client.FlushDB(context.Background())
+	})
+	return client
+}
+
+func TestRedisCacheConformance(t *testing.T) {
+	client := newTestRedisClient(t)
+
+	RunInvalidationCacheConformance(t, func() InvalidationCache {
+		client.FlushDB(context.Background())
+		cache, _ := NewRedisCache(redis.NewClient(client.Options()), "heimdall:test:")
+		return cache
+	})
+}
+
+func TestRedisCacheClear(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "other:key", "1", 0).Err(); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	cache, _ := NewRedisCache(client, "heimdall:invalidated:")
+	cache.Set("session1", time.Hour)
+
+	if err := cache.Clear(ctx); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+
+	if exists, _ := cache.Exists("session1"); exists {
+		t.Error("Expected no invalidations after Clear")
+	}
+	if n, _ := client.Exists(ctx, "other:key").Result(); n != 1 {
+		t.Error("Clear should not delete keys outside the prefix")
+	}
+}
+
+func TestRedisCacheReprefix(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	oldCache, _ := NewRedisCache(client, "heimdall:invalidated:")
+	for _, id := range []string{"session1", "session2"} {
+		if err := oldCache.Set(id, time.Hour); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	newCache, _ := NewRedisCache(client, "heimdall:invalidated:v2:")
+	if err := newCache.Set("session3", time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if err := newCache.Reprefix(ctx, "heimdall:invalidated:"); err != nil {
+		t.Fatalf("Reprefix failed: %v", err)
+	}
+
+	for _, id := range []string{"session1", "session2", "session3"} {
+		exists, err := newCache.Exists(id)
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if !exists {
+			t.Errorf("Expected %s to be invalidated under the new prefix", id)
+		}
+	}
+
+	ttl, err := client.TTL(ctx, "heimdall:invalidated:v2:session1").Result()
+	if err != nil {
+		t.Fatalf("TTL failed: %v", err)
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected TTL to be preserved, got %v", ttl)
+	}
+
+	n, err := client.Exists(ctx, "heimdall:invalidated:session1", "heimdall:invalidated:session2").Result()
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Expected old keys to be gone, %d remain", n)
+	}
+}
+
+func TestRedisCacheReprefixToShorterPrefix(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	// The old prefix extends the new one, so every old key also starts
+	// with the new prefix
+	oldCache, _ := NewRedisCache(client, "heimdall:invalidated:v2:")
+	for _, id := range []string{"session1", "session2"} {
+		if err := oldCache.Set(id, time.Hour); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	newCache, _ := NewRedisCache(client, "heimdall:invalidated:")
+	if err := newCache.Reprefix(ctx, "heimdall:invalidated:v2:"); err != nil {
+		t.Fatalf("Reprefix failed: %v", err)
+	}
+
+	for _, id := range []string{"session1", "session2"} {
+		exists, err := newCache.Exists(id)
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if !exists {
+			t.Errorf("Expected %s to be invalidated under the new prefix", id)
+		}
+	}
+
+	n, err := client.Exists(ctx, "heimdall:invalidated:v2:session1", "heimdall:invalidated:v2:session2").Result()
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Expected old keys to be gone, %d remain", n)
+	}
+}
+
+func TestRedisCacheListInvalidatedLegacyEntries(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	cache, _ := NewRedisCache(client, "heimdall:invalidated:")
+
+	// Written before invalidation times were recorded
+	if err := client.Set(ctx, "heimdall:invalidated:legacy", "1", time.Hour).Err(); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	if err := client.Set(ctx, "heimdall:invalidated:old", old, time.Hour).Err(); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if err := cache.Set("recent", time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	ids, err := cache.ListInvalidated(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("ListInvalidated failed: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, id := range ids {
+		got[id] = true
+	}
+	if len(ids) != 2 || !got["legacy"] || !got["recent"] {
+		t.Errorf("Expected the legacy and recent entries, got %v", ids)
+	}
+}
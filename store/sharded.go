@@ -0,0 +1,170 @@
+package store
+
+import (
+	"errors"
+	"hash/fnv"
+	"time"
+)
+
+// ShardedStore implements SessionStore by routing each user's sessions to one
+// of several SessionStores, so a large deployment can spread users across
+// databases. Save and GetActiveByUser go to the user's shard only; lookups by
+// session ID go to every shard, since the ID does not identify the user.
+//
+// Optional store interfaces such as SearchStore are not forwarded, except
+// SessionGetter.
+type ShardedStore struct {
+	shards   []SessionStore
+	shardKey func(userID string) int
+}
+
+// NewShardedStore creates a store routing users across shards. shardKey maps
+// a user ID to a shard index, taken modulo len(shards); it must always return
+// the same index for the same user, or their sessions will be split. A nil
+// shardKey hashes the user ID with FNV-1a.
+func NewShardedStore(shards []SessionStore, shardKey func(userID string) int) (*ShardedStore, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("sharded: at least one shard is required")
+	}
+	if shardKey == nil {
+		shardKey = hashKey
+	}
+	return &ShardedStore{shards: shards, shardKey: shardKey}, nil
+}
+
+// Shard returns the store holding userID's sessions.
+func (s *ShardedStore) Shard(userID string) SessionStore {
+	return s.shards[shardIndex(s.shardKey(userID), len(s.shards))]
+}
+
+// Save persists a session in its user's shard.
+func (s *ShardedStore) Save(session *Session) error {
+	return s.Shard(session.UserID).Save(session)
+}
+
+// Delete invalidates the session in every shard holding it.
+func (s *ShardedStore) Delete(sessionID string) error {
+	var errs []error
+	for _, shard := range s.shards {
+		if err := shard.Delete(sessionID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetActiveByUser returns the user's active sessions from their shard.
+func (s *ShardedStore) GetActiveByUser(userID string) ([]*Session, error) {
+	return s.Shard(userID).GetActiveByUser(userID)
+}
+
+// GetSession returns the active session with the given ID from the first
+// shard holding it, or nil if there is none. Every shard must implement
+// SessionGetter.
+func (s *ShardedStore) GetSession(sessionID string) (*Session, error) {
+	for _, shard := range s.shards {
+		getter, ok := Optional[SessionGetter](shard)
+		if !ok {
+			return nil, errors.New("sharded: shard does not support GetSession")
+		}
+		session, err := getter.GetSession(sessionID)
+		if err != nil || session != nil {
+			return session, err
+		}
+	}
+	return nil, nil
+}
+
+// SessionExists returns true if any shard has an active session with the
+// given ID.
+func (s *ShardedStore) SessionExists(sessionID string) (bool, error) {
+	for _, shard := range s.shards {
+		exists, err := shard.SessionExists(sessionID)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// Close closes all shards.
+func (s *ShardedStore) Close() error {
+	var errs []error
+	for _, shard := range s.shards {
+		if err := shard.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ShardedCache implements InvalidationCache by routing each session ID to one
+// of several InvalidationCaches by its FNV-1a hash.
+type ShardedCache struct {
+	shards []InvalidationCache
+}
+
+// NewShardedCache creates a cache routing session IDs across shards.
+// Changing the number of shards reroutes existing entries.
+func NewShardedCache(shards []InvalidationCache) (*ShardedCache, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("sharded: at least one shard is required")
+	}
+	return &ShardedCache{shards: shards}, nil
+}
+
+// shard returns the cache holding sessionID.
+func (c *ShardedCache) shard(sessionID string) InvalidationCache {
+	return c.shards[shardIndex(hashKey(sessionID), len(c.shards))]
+}
+
+// Set marks a session ID as invalidated in its shard.
+func (c *ShardedCache) Set(sessionID string, ttl time.Duration) error {
+	return c.shard(sessionID).Set(sessionID, ttl)
+}
+
+// Exists returns true if the session ID has been invalidated in its shard.
+func (c *ShardedCache) Exists(sessionID string) (bool, error) {
+	return c.shard(sessionID).Exists(sessionID)
+}
+
+// ListInvalidated returns the IDs invalidated at or after since across all
+// shards.
+func (c *ShardedCache) ListInvalidated(since time.Time) ([]string, error) {
+	ids := []string{}
+	for _, shard := range c.shards {
+		shardIDs, err := shard.ListInvalidated(since)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, shardIDs...)
+	}
+	return ids, nil
+}
+
+// Close closes all shards.
+func (c *ShardedCache) Close() error {
+	var errs []error
+	for _, shard := range c.shards {
+		if err := shard.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hashKey returns the FNV-1a hash of key.
+func hashKey(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32())
+}
+
+// shardIndex maps key into [0, n), also for negative keys.
+func shardIndex(key, n int) int {
+	i := key % n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestShardedStoreRoutesUserToOneShard(t *testing.T) {
+	shards := []*MemorySessionStore{NewMemorySessionStore(), NewMemorySessionStore()}
+	s, err := NewShardedStore([]SessionStore{shards[0], shards[1]}, nil)
+	if err != nil {
+		t.Fatalf("NewShardedStore failed: %v", err)
+	}
+	defer s.Close()
+
+	for u := 0; u < 20; u++ {
+		userID := fmt.Sprintf("user%d", u)
+		for i := 0; i < 3; i++ {
+			if err := s.Save(newTestSession(fmt.Sprintf("%s-session%d", userID, i), userID)); err != nil {
+				t.Fatalf("Failed to save session: %v", err)
+			}
+		}
+
+		var holding []int
+		for i, shard := range shards {
+			sessions, err := shard.GetActiveByUser(userID)
+			if err != nil {
+				t.Fatalf("GetActiveByUser failed: %v", err)
+			}
+			if len(sessions) > 0 {
+				holding = append(holding, i)
+				if len(sessions) != 3 {
+					t.Errorf("Expected all 3 of %s's sessions in shard %d, got %d", userID, i, len(sessions))
+				}
+			}
+		}
+		if len(holding) != 1 {
+			t.Errorf("Expected %s's sessions in exactly one shard, got shards %v", userID, holding)
+		}
+	}
+
+	// Both shards are used
+	for i, shard := range shards {
+		if len(shard.sessions) == 0 {
+			t.Errorf("Expected shard %d to hold some sessions", i)
+		}
+	}
+
+	// Lookups by session ID search every shard
+	for u := 0; u < 20; u++ {
+		sessionID := fmt.Sprintf("user%d-session0", u)
+		if session, err := s.GetSession(sessionID); err != nil || session == nil {
+			t.Errorf("Expected to find %s, got %v, %v", sessionID, session, err)
+		}
+		if err := s.Delete(sessionID); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if exists, _ := s.SessionExists(sessionID); exists {
+			t.Errorf("Expected %s to be deleted", sessionID)
+		}
+	}
+}
+
+func TestShardedStoreShardKey(t *testing.T) {
+	shards := []SessionStore{NewMemorySessionStore(), NewMemorySessionStore()}
+	s, err := NewShardedStore(shards, func(userID string) int { return -1 })
+	if err != nil {
+		t.Fatalf("NewShardedStore failed: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Save(newTestSession("session1", "user1")); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+	if s.Shard("user1") != shards[1] {
+		t.Error("Expected a negative shard key to wrap around to the last shard")
+	}
+	if sessions, _ := shards[1].GetActiveByUser("user1"); len(sessions) != 1 {
+		t.Errorf("Expected session in shard 1, got %d sessions", len(sessions))
+	}
+}
+
+func TestShardedStoreNoShards(t *testing.T) {
+	if _, err := NewShardedStore(nil, nil); err == nil {
+		t.Error("Expected error for no shards")
+	}
+	if _, err := NewShardedCache(nil); err == nil {
+		t.Error("Expected error for no shards")
+	}
+}
+
+func TestShardedStoreConformance(t *testing.T) {
+	RunSessionStoreConformance(t, func() SessionStore {
+		s, err := NewShardedStore([]SessionStore{NewMemorySessionStore(), NewMemorySessionStore()}, nil)
+		if err != nil {
+			t.Fatalf("NewShardedStore failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestShardedCacheConformance(t *testing.T) {
+	RunInvalidationCacheConformance(t, func() InvalidationCache {
+		c, err := NewShardedCache([]InvalidationCache{NewMemoryCache(), NewMemoryCache()})
+		if err != nil {
+			t.Fatalf("NewShardedCache failed: %v", err)
+		}
+		return c
+	})
+}
+
+func TestShardedCacheRoutesSessionToOneShard(t *testing.T) {
+	shards := []*MemoryCache{NewMemoryCache(), NewMemoryCache()}
+	c, err := NewShardedCache([]InvalidationCache{shards[0], shards[1]})
+	if err != nil {
+		t.Fatalf("NewShardedCache failed: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := c.Set(fmt.Sprintf("session%d", i), time.Hour); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	total := 0
+	for i, shard := range shards {
+		n, _ := shard.Len()
+		if n == 0 {
+			t.Errorf("Expected shard %d to hold some entries", i)
+		}
+		total += n
+	}
+	if total != 20 {
+		t.Errorf("Expected each entry in exactly one shard, got %d entries", total)
+	}
+
+	ids, err := c.ListInvalidated(time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("ListInvalidated failed: %v", err)
+	}
+	if len(ids) != 20 {
+		t.Errorf("Expected 20 invalidated IDs across shards, got %d", len(ids))
+	}
+}
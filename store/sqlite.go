@@ -1,8 +1,10 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -11,13 +13,54 @@ import (
 // SQLiteStore implements SessionStore using SQLite.
 // It uses the pure Go modernc.org/sqlite driver.
 type SQLiteStore struct {
-	db *sql.DB
+	db               *sql.DB
+	internUserAgents bool
+	vacuumOnMaintain bool
 }
 
+// SQLiteOptions contains optional settings for NewSQLiteWithOptions.
+type SQLiteOptions struct {
+	// InternUserAgents stores each distinct User-Agent once in a
+	// user_agents table referenced by sessions, instead of once per session.
+	// This saves space when many sessions share popular browsers.
+	// Reads are unaffected, and databases may mix both layouts, so the
+	// option can be turned on or off at any time.
+	InternUserAgents bool
+
+	// VacuumOnMaintain makes Maintain also VACUUM the database, returning
+	// the space of deleted rows to the file system. VACUUM rewrites the whole
+	// file and blocks writers while it runs, so only enable it if the
+	// database shrinks substantially, e.g. after deleting old sessions.
+	VacuumOnMaintain bool
+}
+
+// sqliteSessionSelect selects the columns read by scanSession.
+// Interned User-Agents are resolved through the user_agents table.
+const sqliteSessionSelect = `
+	SELECT session_id, user_id, device_ip, COALESCE(ua.ua, device_ua, ''), browser, os, device_type, COALESCE(device_fingerprint, ''),
+		   loc_city, loc_country, COALESCE(loc_country_code, ''), loc_lat, loc_lng, COALESCE(loc_geohash, ''), COALESCE(loc_asn, 0), COALESCE(group_key, ''), sealed, ttl_seconds, created_at, expires_at
+	FROM sessions
+	LEFT JOIN user_agents ua ON ua.id = sessions.device_ua_id`
 
 // NewSQLite creates a new SQLite session store.
 // The database file is created if it doesn't exist.
+// A path of ":memory:" is equivalent to NewSQLiteMemory.
 func NewSQLite(dbPath string) (*SQLiteStore, error) {
+	return NewSQLiteWithOptions(dbPath, SQLiteOptions{})
+}
+
+// NewSQLiteWithOptions is like NewSQLite but accepts additional options.
+func NewSQLiteWithOptions(dbPath string, opts SQLiteOptions) (*SQLiteStore, error) {
+	if dbPath == ":memory:" {
+		s, err := NewSQLiteMemory()
+		if err != nil {
+			return nil, err
+		}
+		s.internUserAgents = opts.InternUserAgents
+		s.vacuumOnMaintain = opts.VacuumOnMaintain
+		return s, nil
+	}
+
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("sqlite: failed to open database: %w", err)
@@ -35,6 +78,36 @@ func NewSQLite(dbPath string) (*SQLiteStore, error) {
 		return nil, err
 	}
 
+	return &SQLiteStore{
+		db:               db,
+		internUserAgents: opts.InternUserAgents,
+		vacuumOnMaintain: opts.VacuumOnMaintain,
+	}, nil
+}
+
+// NewSQLiteMemory creates a new SQLite session store backed by an in-memory
+// database, for tests and ephemeral use. Data lives as long as the store and
+// is lost on Close.
+//
+// Every connection to ":memory:" opens a separate, empty database, so the
+// store is limited to a single connection; otherwise the schema and data
+// would vanish whenever database/sql picked a different pooled connection.
+func NewSQLiteMemory() (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	if err := createSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &SQLiteStore{db: db}, nil
 }
 
@@ -48,14 +121,26 @@ func createSchema(db *sql.DB) error {
 		browser        TEXT,
 		os             TEXT,
 		device_type    TEXT,
+		device_fingerprint TEXT,
 		loc_city       TEXT,
 		loc_country    TEXT,
+		loc_country_code TEXT,
 		loc_lat        REAL,
 		loc_lng        REAL,
+		loc_geohash    TEXT,
+		loc_asn        INTEGER,
+		group_key      TEXT,
+		sealed         BLOB,
 		ttl_seconds    INTEGER NOT NULL,
 		created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		expires_at     DATETIME NOT NULL,
-		invalidated_at DATETIME
+		invalidated_at DATETIME,
+		device_ua_id   INTEGER REFERENCES user_agents(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS user_agents (
+		id INTEGER PRIMARY KEY,
+		ua TEXT NOT NULL UNIQUE
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_sessions_user_active 
@@ -65,6 +150,70 @@ func createSchema(db *sql.DB) error {
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("sqlite: failed to create schema: %w", err)
 	}
+	if err := migrateSchema(db); err != nil {
+		return err
+	}
+
+	// Created after migrating, since older tables lack loc_country_code and group_key
+	indexes := `
+	CREATE INDEX IF NOT EXISTS idx_sessions_device_ip ON sessions (device_ip);
+	CREATE INDEX IF NOT EXISTS idx_sessions_country ON sessions (loc_country_code);
+	CREATE INDEX IF NOT EXISTS idx_sessions_group ON sessions (group_key, expires_at, invalidated_at);
+	CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions (expires_at);
+	`
+	if _, err := db.Exec(indexes); err != nil {
+		return fmt.Errorf("sqlite: failed to create indexes: %w", err)
+	}
+	return nil
+}
+
+// sqliteAddedColumns lists columns added after the initial schema, so that
+// databases created by older versions can be upgraded in place.
+var sqliteAddedColumns = []struct{ name, definition string }{
+	{"loc_country_code", "TEXT"},
+	{"device_ua_id", "INTEGER REFERENCES user_agents(id)"},
+	{"loc_geohash", "TEXT"},
+	{"group_key", "TEXT"},
+	{"sealed", "BLOB"},
+	{"device_fingerprint", "TEXT"},
+	{"loc_asn", "INTEGER"},
+}
+
+// migrateSchema adds any columns missing from an existing sessions table.
+func migrateSchema(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(sessions)")
+	if err != nil {
+		return fmt.Errorf("sqlite: failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("sqlite: failed to read schema: %w", err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("sqlite: failed to read schema: %w", err)
+	}
+
+	for _, col := range sqliteAddedColumns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE sessions ADD COLUMN " + col.name + " " + col.definition); err != nil {
+			return fmt.Errorf("sqlite: failed to add column %s: %w", col.name, err)
+		}
+	}
 	return nil
 }
 
@@ -98,29 +247,170 @@ func (s *SQLiteStore) Exists(sessionID string) (bool, error) {
 	return count > 0, nil
 }
 
+// ExistsMany reports for each session ID whether it has been invalidated,
+// querying up to 500 IDs at a time.
+func (s *SQLiteStore) ExistsMany(sessionIDs []string) ([]bool, error) {
+	invalidated := make(map[string]bool)
+	for start := 0; start < len(sessionIDs); start += 500 {
+		batch := sessionIDs[start:min(start+500, len(sessionIDs))]
+
+		args := make([]any, len(batch))
+		for i, sessionID := range batch {
+			args[i] = sessionID
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+
+		rows, err := s.db.Query(
+			"SELECT session_id FROM sessions WHERE invalidated_at IS NOT NULL AND session_id IN ("+placeholders+")",
+			args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: failed to check invalidations: %w", err)
+		}
+		for rows.Next() {
+			var sessionID string
+			if err := rows.Scan(&sessionID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("sqlite: failed to scan session ID: %w", err)
+			}
+			invalidated[sessionID] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: error iterating session IDs: %w", err)
+		}
+	}
+
+	exists := make([]bool, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		exists[i] = invalidated[sessionID]
+	}
+	return exists, nil
+}
+
+// CountInvalidated returns the number of sessions invalidated at or after
+// since.
+func (s *SQLiteStore) CountInvalidated(since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE invalidated_at >= ?",
+		since.UTC().Format("2006-01-02 15:04:05"), // Same format as datetime('now')
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: failed to count invalidations: %w", err)
+	}
+	return count, nil
+}
+
+// ListInvalidated returns the IDs of sessions invalidated at or after since.
+func (s *SQLiteStore) ListInvalidated(since time.Time) ([]string, error) {
+	rows, err := s.db.Query(
+		"SELECT session_id FROM sessions WHERE invalidated_at >= ?",
+		since.UTC().Format("2006-01-02 15:04:05"), // Same format as datetime('now')
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query invalidations: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("sqlite: failed to scan invalidation: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating invalidations: %w", err)
+	}
+	return ids, nil
+}
+
+// Len returns the number of invalidated sessions.
+func (s *SQLiteStore) Len() (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE invalidated_at IS NOT NULL",
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: failed to count invalidations: %w", err)
+	}
+	return count, nil
+}
+
 // Save persists a new session.
 func (s *SQLiteStore) Save(session *Session) error {
+	return s.save(s.db, session)
+}
+
+// SaveAll persists sessions in one transaction.
+func (s *SQLiteStore) SaveAll(sessions []*Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sqlite: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, session := range sessions {
+		if err := s.save(tx, session); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite: failed to commit sessions: %w", err)
+	}
+	return nil
+}
+
+// sqlExecer is implemented by *sql.DB and *sql.Tx, so that statements can
+// run in or outside a transaction.
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// save persists a session using db.
+func (s *SQLiteStore) save(db sqlExecer, session *Session) error {
 	query := `
 	INSERT OR REPLACE INTO sessions (
-		session_id, user_id, device_ip, device_ua, browser, os, device_type,
-		loc_city, loc_country, loc_lat, loc_lng, ttl_seconds, created_at, expires_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		session_id, user_id, device_ip, device_ua, device_ua_id, browser, os, device_type, device_fingerprint,
+		loc_city, loc_country, loc_country_code, loc_lat, loc_lng, loc_geohash, loc_asn, group_key, sealed, ttl_seconds, created_at, expires_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	expiresAt := session.ExpiresAt()
 
-	_, err := s.db.Exec(query,
+	deviceUA, deviceUAID := session.DeviceUA, sql.NullInt64{}
+	if s.internUserAgents && deviceUA != "" {
+		id, err := internUserAgent(db, deviceUA)
+		if err != nil {
+			return err
+		}
+		deviceUA, deviceUAID = "", sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	_, err := db.Exec(query,
 		session.SessionID,
 		session.UserID,
 		session.DeviceIP,
-		session.DeviceUA,
+		deviceUA,
+		deviceUAID,
 		session.Browser,
 		session.OS,
 		session.DeviceType,
+		session.DeviceFingerprint,
 		session.LocCity,
 		session.LocCountry,
+		session.LocCountryCode,
 		session.LocLat,
 		session.LocLng,
+		session.LocGeohash,
+		session.LocASN,
+		session.GroupKey,
+		session.Sealed,
 		session.TTLSeconds,
 		session.CreatedAt,
 		expiresAt,
@@ -132,6 +422,20 @@ func (s *SQLiteStore) Save(session *Session) error {
 	return nil
 }
 
+// internUserAgent returns the ID of ua in the user_agents table, adding it
+// if needed.
+func internUserAgent(db sqlExecer, ua string) (int64, error) {
+	if _, err := db.Exec("INSERT OR IGNORE INTO user_agents (ua) VALUES (?)", ua); err != nil {
+		return 0, fmt.Errorf("sqlite: failed to store user agent: %w", err)
+	}
+
+	var id int64
+	if err := db.QueryRow("SELECT id FROM user_agents WHERE ua = ?", ua).Scan(&id); err != nil {
+		return 0, fmt.Errorf("sqlite: failed to look up user agent: %w", err)
+	}
+	return id, nil
+}
+
 // Delete marks a session as invalidated (soft delete for audit trail).
 func (s *SQLiteStore) Delete(sessionID string) error {
 	_, err := s.db.Exec(
@@ -146,21 +450,401 @@ func (s *SQLiteStore) Delete(sessionID string) error {
 
 // GetActiveByUser returns all non-expired, non-invalidated sessions for a user.
 func (s *SQLiteStore) GetActiveByUser(userID string) ([]*Session, error) {
-	query := `
-	SELECT session_id, user_id, device_ip, device_ua, browser, os, device_type,
-		   loc_city, loc_country, loc_lat, loc_lng, ttl_seconds, created_at
-	FROM sessions
+	return s.GetActiveByUserLimit(userID, -1) // A negative LIMIT is unlimited
+}
+
+// GetActiveByUserLimit returns the user's newest limit active sessions.
+func (s *SQLiteStore) GetActiveByUserLimit(userID string, limit int) ([]*Session, error) {
+	query := sqliteSessionSelect + `
 	WHERE user_id = ? AND expires_at > datetime('now') AND invalidated_at IS NULL
 	ORDER BY created_at DESC
+	LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetSession returns the active session with the given ID, or nil if there is none.
+func (s *SQLiteStore) GetSession(sessionID string) (*Session, error) {
+	query := sqliteSessionSelect + `
+	WHERE session_id = ? AND expires_at > datetime('now') AND invalidated_at IS NULL
+	`
+
+	rows, err := s.db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query session: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("sqlite: failed to query session: %w", err)
+		}
+		return nil, nil
+	}
+	return scanSession(rows)
+}
+
+// GetExpiredByUser returns the user's non-invalidated sessions that expired
+// after since.
+func (s *SQLiteStore) GetExpiredByUser(userID string, since time.Time) ([]*Session, error) {
+	query := sqliteSessionSelect + `
+	WHERE user_id = ? AND expires_at > ? AND expires_at <= datetime('now') AND invalidated_at IS NULL
+	ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.Query(query, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query expired sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetExpiringSoon returns the active sessions expiring within the given
+// duration, soonest first.
+func (s *SQLiteStore) GetExpiringSoon(within time.Duration) ([]*Session, error) {
+	query := sqliteSessionSelect + `
+	WHERE expires_at > datetime('now') AND expires_at <= ? AND invalidated_at IS NULL
+	ORDER BY expires_at
+	`
+
+	rows, err := s.db.Query(query, time.Now().Add(within))
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query expiring sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// SessionExists returns true if an active session with the given ID exists.
+func (s *SQLiteStore) SessionExists(sessionID string) (bool, error) {
+	var one int
+	err := s.db.QueryRow(
+		"SELECT 1 FROM sessions WHERE session_id = ? AND expires_at > datetime('now') AND invalidated_at IS NULL LIMIT 1",
+		sessionID,
+	).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("sqlite: failed to check session: %w", err)
+	}
+	return true, nil
+}
+
+// HasActiveByUser reports whether the user has a non-expired,
+// non-invalidated session.
+func (s *SQLiteStore) HasActiveByUser(userID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sessions WHERE user_id = ? AND expires_at > datetime('now') AND invalidated_at IS NULL)",
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("sqlite: failed to check active sessions: %w", err)
+	}
+	return exists, nil
+}
+
+// GetActiveByDeviceType returns the active sessions with the given device
+// type, of the user or, if userID is empty, of all users.
+func (s *SQLiteStore) GetActiveByDeviceType(userID, deviceType string) ([]*Session, error) {
+	query := sqliteSessionSelect + `
+	WHERE device_type = ? AND expires_at > datetime('now') AND invalidated_at IS NULL`
+	args := []any{deviceType}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// CountDistinctIPs returns the number of distinct device IPs across the user's
+// sessions created at or after since, including expired and invalidated ones.
+func (s *SQLiteStore) CountDistinctIPs(userID string, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(DISTINCT device_ip) FROM sessions WHERE user_id = ? AND created_at >= ?",
+		userID, since,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: failed to count distinct IPs: %w", err)
+	}
+	return count, nil
+}
+
+// CountSessionsByUser returns the number of sessions the user has created,
+// including expired and invalidated ones.
+func (s *SQLiteStore) CountSessionsByUser(userID string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// CountActiveByGroup returns the number of non-expired, non-invalidated
+// sessions with the given group key.
+func (s *SQLiteStore) CountActiveByGroup(groupKey string) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE group_key = ? AND expires_at > datetime('now') AND invalidated_at IS NULL",
+		groupKey,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: failed to count group sessions: %w", err)
+	}
+	return count, nil
+}
+
+// UsersOverLimit returns the users with more than limit active sessions.
+func (s *SQLiteStore) UsersOverLimit(limit int) ([]UserSessionCount, error) {
+	rows, err := s.db.Query(`
+	SELECT user_id, COUNT(*) FROM sessions
+	WHERE expires_at > datetime('now') AND invalidated_at IS NULL
+	GROUP BY user_id
+	HAVING COUNT(*) > ?
+	ORDER BY COUNT(*) DESC, user_id
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to count sessions by user: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []UserSessionCount{}
+	for rows.Next() {
+		var count UserSessionCount
+		if err := rows.Scan(&count.UserID, &count.Count); err != nil {
+			return nil, fmt.Errorf("sqlite: failed to scan session count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating session counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// DeviceIPsByUser returns the distinct device IPs across the user's sessions,
+// including expired and invalidated ones.
+func (s *SQLiteStore) DeviceIPsByUser(userID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT device_ip FROM sessions WHERE user_id = ? AND device_ip IS NOT NULL", userID)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query device IPs: %w", err)
+	}
+	defer rows.Close()
+
+	ips := []string{}
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("sqlite: failed to scan device IP: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating device IPs: %w", err)
+	}
+
+	return ips, nil
+}
+
+// UpdateLocationByIP sets the location of the user's sessions from ip to loc,
+// including expired and invalidated ones.
+func (s *SQLiteStore) UpdateLocationByIP(userID, ip string, loc Location) (int, error) {
+	result, err := s.db.Exec(`
+	UPDATE sessions
+	SET loc_city = ?, loc_country = ?, loc_country_code = ?, loc_lat = ?, loc_lng = ?, loc_geohash = ?
+	WHERE user_id = ? AND device_ip = ?
+		AND NOT (loc_city IS ? AND loc_country IS ? AND loc_country_code IS ? AND loc_lat IS ? AND loc_lng IS ? AND loc_geohash IS ?)`,
+		loc.City, loc.Country, loc.CountryCode, loc.Lat, loc.Lng, loc.Geohash,
+		userID, ip,
+		loc.City, loc.Country, loc.CountryCode, loc.Lat, loc.Lng, loc.Geohash,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: failed to update location: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("sqlite: failed to update location: %w", err)
+	}
+	return int(updated), nil
+}
+
+// LastLoginAt returns the most recent CreatedAt across all of the user's
+// sessions, including expired and invalidated ones.
+func (s *SQLiteStore) LastLoginAt(userID string) (time.Time, bool, error) {
+	var createdAt time.Time
+	err := s.db.QueryRow(
+		"SELECT created_at FROM sessions WHERE user_id = ? ORDER BY created_at DESC LIMIT 1",
+		userID,
+	).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("sqlite: failed to get last login: %w", err)
+	}
+	return createdAt, true, nil
+}
+
+// CountLoginsByBucket counts the user's sessions created at or after from and
+// before to, per bucket-long interval, including expired and invalidated
+// ones. Sessions are grouped to whole seconds.
+func (s *SQLiteStore) CountLoginsByBucket(userID string, from, to time.Time, bucket time.Duration) ([]int, error) {
+	// Times are stored in Go's text format, which SQLite's date functions
+	// cannot parse; like the range comparisons, the grouping relies on
+	// created_at and from sharing a time zone and uses their wall clock.
+	rows, err := s.db.Query(`
+	SELECT (unixepoch(substr(created_at, 1, 19)) - unixepoch(substr(?, 1, 19))) / ?, COUNT(*)
+	FROM sessions
+	WHERE user_id = ? AND created_at >= ? AND created_at < ?
+	GROUP BY 1`,
+		from, int64(bucket/time.Second), userID, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to count logins: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]int, bucketCount(from, to, bucket))
+	for rows.Next() {
+		var index, count int
+		if err := rows.Scan(&index, &count); err != nil {
+			return nil, fmt.Errorf("sqlite: failed to scan login count: %w", err)
+		}
+		counts[min(max(index, 0), len(counts)-1)] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating login counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetSessionAudit returns the session with the given ID regardless of its
+// state, and the time it was invalidated.
+func (s *SQLiteStore) GetSessionAudit(sessionID string) (*Session, time.Time, error) {
+	var invalidatedAt sql.NullTime
+	err := s.db.QueryRow(
+		"SELECT invalidated_at FROM sessions WHERE session_id = ?",
+		sessionID,
+	).Scan(&invalidatedAt)
+	if err == sql.ErrNoRows {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("sqlite: failed to query invalidation: %w", err)
+	}
+
+	rows, err := s.db.Query(sqliteSessionSelect+" WHERE session_id = ?", sessionID)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("sqlite: failed to query session: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, time.Time{}, fmt.Errorf("sqlite: failed to query session: %w", err)
+		}
+		return nil, time.Time{}, nil
+	}
+	session, err := scanSession(rows)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return session, invalidatedAt.Time, nil
+}
+
+// GetActiveByUserAt returns the user's sessions that were active at t.
+func (s *SQLiteStore) GetActiveByUserAt(userID string, t time.Time) ([]*Session, error) {
+	query := sqliteSessionSelect + `
+	WHERE user_id = ? AND created_at <= ? AND expires_at > ? AND (invalidated_at IS NULL OR invalidated_at > ?)
+	ORDER BY created_at DESC
 	`
 
-	rows, err := s.db.Query(query, userID)
+	rows, err := s.db.Query(query, userID, t, t, t.UTC().Format("2006-01-02 15:04:05"))
 	if err != nil {
 		return nil, fmt.Errorf("sqlite: failed to query sessions: %w", err)
 	}
 	defer rows.Close()
 
-	var sessions []*Session
+	sessions := []*Session{}
 	for rows.Next() {
 		session, err := scanSession(rows)
 		if err != nil {
@@ -176,6 +860,82 @@ func (s *SQLiteStore) GetActiveByUser(userID string) ([]*Session, error) {
 	return sessions, nil
 }
 
+// FindSessions returns all sessions matching filter, across all users.
+func (s *SQLiteStore) FindSessions(filter SessionFilter) ([]*Session, error) {
+	query := sqliteSessionSelect + `
+	WHERE 1 = 1`
+	var args []any
+	if filter.DeviceIP != "" {
+		query += " AND device_ip = ?"
+		args = append(args, filter.DeviceIP)
+	}
+	if filter.CountryCode != "" {
+		query += " AND loc_country_code = ?"
+		args = append(args, strings.ToUpper(filter.CountryCode))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.CreatedBefore)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to search sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Maintain VACUUMs the database if SQLiteOptions.VacuumOnMaintain is set,
+// then checkpoints the write-ahead log into the database file and truncates
+// it. SQLite checkpoints automatically, but the WAL file never shrinks and
+// keeps growing while long-running reads prevent checkpoints, so call
+// Maintain on a schedule, e.g. nightly, during low traffic.
+func (s *SQLiteStore) Maintain() error {
+	// VACUUM goes through the WAL, so it must come first
+	if s.vacuumOnMaintain {
+		if _, err := s.db.Exec("VACUUM"); err != nil {
+			return fmt.Errorf("sqlite: failed to vacuum: %w", err)
+		}
+	}
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("sqlite: failed to checkpoint WAL: %w", err)
+	}
+	return nil
+}
+
+// Clear deletes all sessions, including invalidated ones.
+// It is intended for resetting state between tests; never call it on a
+// production database.
+func (s *SQLiteStore) Clear(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM sessions"); err != nil {
+		return fmt.Errorf("sqlite: failed to clear sessions: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM user_agents"); err != nil {
+		return fmt.Errorf("sqlite: failed to clear user agents: %w", err)
+	}
+	return nil
+}
+
 // Close closes the database connection.
 func (s *SQLiteStore) Close() error {
 	return s.db.Close()
@@ -192,12 +952,19 @@ func scanSession(rows *sql.Rows) (*Session, error) {
 		&session.Browser,
 		&session.OS,
 		&session.DeviceType,
+		&session.DeviceFingerprint,
 		&session.LocCity,
 		&session.LocCountry,
+		&session.LocCountryCode,
 		&session.LocLat,
 		&session.LocLng,
+		&session.LocGeohash,
+		&session.LocASN,
+		&session.GroupKey,
+		&session.Sealed,
 		&session.TTLSeconds,
 		&session.CreatedAt,
+		&session.StoredExpiresAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("sqlite: failed to scan session: %w", err)
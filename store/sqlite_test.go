@@ -0,0 +1,336 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestSQLite creates a SQLite store in a temporary directory.
+func newTestSQLite(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	s, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// newTestSession returns a session created now with a one hour TTL.
+func newTestSession(sessionID, userID string) *Session {
+	return &Session{
+		SessionID:  sessionID,
+		UserID:     userID,
+		DeviceIP:   "8.8.8.8",
+		TTLSeconds: int64(time.Hour.Seconds()),
+		CreatedAt:  time.Now(),
+	}
+}
+
+func TestSQLiteSessionExists(t *testing.T) {
+	s := newTestSQLite(t)
+
+	for _, id := range []string{"active", "invalidated"} {
+		if err := s.Save(newTestSession(id, "user1")); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+	if err := s.Delete("invalidated"); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+
+	tests := []struct {
+		sessionID string
+		want      bool
+	}{
+		{"active", true},
+		{"absent", false},
+		{"invalidated", false},
+	}
+
+	for _, tt := range tests {
+		got, err := s.SessionExists(tt.sessionID)
+		if err != nil {
+			t.Fatalf("SessionExists(%q) failed: %v", tt.sessionID, err)
+		}
+		if got != tt.want {
+			t.Errorf("SessionExists(%q) = %v, want %v", tt.sessionID, got, tt.want)
+		}
+	}
+}
+
+func TestSQLiteStoredExpiresAt(t *testing.T) {
+	s := newTestSQLite(t)
+
+	for _, id := range []string{"extended", "revoked"} {
+		if err := s.Save(newTestSession(id, "user1")); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+
+	// Expiry moved by the database, e.g. by an operator or a clock that
+	// disagrees with the application's
+	extendedUntil := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+	updates := map[string]time.Time{
+		"extended": extendedUntil,
+		"revoked":  time.Now().UTC().Add(-time.Minute),
+	}
+	for id, expiresAt := range updates {
+		if _, err := s.db.Exec("UPDATE sessions SET expires_at = ? WHERE session_id = ?", expiresAt, id); err != nil {
+			t.Fatalf("Failed to update expires_at: %v", err)
+		}
+	}
+
+	sessions := mustGetActive(t, s, "user1", 1)
+	got := sessions[0]
+	if got.SessionID != "extended" {
+		t.Fatalf("Expected only the extended session, got %s", got.SessionID)
+	}
+	if !got.StoredExpiresAt.Equal(extendedUntil) {
+		t.Errorf("Expected StoredExpiresAt %v, got %v", extendedUntil, got.StoredExpiresAt)
+	}
+	if !got.ExpiresAt().Equal(extendedUntil) {
+		t.Errorf("Expected ExpiresAt to use the stored value %v, got %v", extendedUntil, got.ExpiresAt())
+	}
+}
+
+func TestSQLiteClear(t *testing.T) {
+	s := newTestSQLite(t)
+
+	for _, id := range []string{"session1", "session2"} {
+		if err := s.Save(newTestSession(id, "user1")); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+	if err := s.Delete("session2"); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+
+	if err := s.Clear(context.Background()); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+
+	sessions, err := s.GetActiveByUser("user1")
+	if err != nil {
+		t.Fatalf("GetActiveByUser failed: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("Expected no sessions after Clear, got %d", len(sessions))
+	}
+	if n, _ := s.Len(); n != 0 {
+		t.Errorf("Expected no invalidations after Clear, got %d", n)
+	}
+}
+
+func TestSQLiteSaveAll(t *testing.T) {
+	s := newTestSQLite(t)
+
+	sessions := []*Session{
+		newTestSession("session1", "user1"),
+		newTestSession("session2", "user2"),
+		newTestSession("session3", "user3"),
+	}
+	if err := s.SaveAll(sessions); err != nil {
+		t.Fatalf("SaveAll failed: %v", err)
+	}
+	for _, session := range sessions {
+		mustGetActive(t, s, session.UserID, 1)
+	}
+
+	// A failing insert rolls back the whole batch
+	_, err := s.db.Exec(`CREATE TRIGGER fail_bad BEFORE INSERT ON sessions
+		WHEN NEW.session_id = 'bad' BEGIN SELECT RAISE(ABORT, 'injected failure'); END`)
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+	err = s.SaveAll([]*Session{
+		newTestSession("session4", "user4"),
+		newTestSession("bad", "user4"),
+	})
+	if err == nil {
+		t.Fatal("Expected SaveAll to fail")
+	}
+	mustGetActive(t, s, "user4", 0)
+}
+
+func TestSQLiteMaintain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := NewSQLiteWithOptions(path, SQLiteOptions{VacuumOnMaintain: true})
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 500; i++ {
+		id := fmt.Sprintf("session%d", i)
+		if err := s.Save(newTestSession(id, "user1")); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+		if i%2 == 0 {
+			if err := s.Delete(id); err != nil {
+				t.Fatalf("Failed to delete session: %v", err)
+			}
+		}
+	}
+
+	if err := s.Maintain(); err != nil {
+		t.Fatalf("Maintain failed: %v", err)
+	}
+
+	info, err := os.Stat(path + "-wal")
+	if err != nil {
+		t.Fatalf("Failed to stat WAL file: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Expected the WAL to be truncated, got %d bytes", info.Size())
+	}
+
+	sessions, err := s.GetActiveByUser("user1")
+	if err != nil {
+		t.Fatalf("GetActiveByUser failed: %v", err)
+	}
+	if len(sessions) != 250 {
+		t.Errorf("Expected 250 sessions after Maintain, got %d", len(sessions))
+	}
+}
+
+func TestSQLiteInternUserAgents(t *testing.T) {
+	s, err := NewSQLiteWithOptions(filepath.Join(t.TempDir(), "test.db"), SQLiteOptions{InternUserAgents: true})
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer s.Close()
+
+	const ua = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	for _, id := range []string{"session1", "session2"} {
+		session := newTestSession(id, "user1")
+		session.DeviceUA = ua
+		if err := s.Save(session); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+
+	var rows int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM user_agents").Scan(&rows); err != nil {
+		t.Fatalf("Failed to count user agents: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("Expected the sessions to share 1 user agent row, got %d", rows)
+	}
+
+	var inline int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE device_ua != ''").Scan(&inline); err != nil {
+		t.Fatalf("Failed to count sessions: %v", err)
+	}
+	if inline != 0 {
+		t.Errorf("Expected no inline user agents, got %d", inline)
+	}
+
+	sessions, err := s.GetActiveByUser("user1")
+	if err != nil {
+		t.Fatalf("GetActiveByUser failed: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.DeviceUA != ua {
+			t.Errorf("Expected the full user agent, got %q", session.DeviceUA)
+		}
+	}
+}
+
+func TestSQLiteInternUserAgentsConformance(t *testing.T) {
+	RunSessionStoreConformance(t, func() SessionStore {
+		s, err := NewSQLiteWithOptions(filepath.Join(t.TempDir(), "test.db"), SQLiteOptions{InternUserAgents: true})
+		if err != nil {
+			t.Fatalf("Failed to create SQLite store: %v", err)
+		}
+		return s
+	})
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	RunSessionStoreConformance(t, func() SessionStore {
+		s, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to create SQLite store: %v", err)
+		}
+		return s
+	})
+}
+
+func TestSQLiteMemory(t *testing.T) {
+	s, err := NewSQLiteMemory()
+	if err != nil {
+		t.Fatalf("Failed to create in-memory SQLite store: %v", err)
+	}
+	defer s.Close()
+
+	for _, id := range []string{"session1", "session2", "session3"} {
+		if err := s.Save(newTestSession(id, "user1")); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+	if err := s.Delete("session2"); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+
+	sessions, err := s.GetActiveByUser("user1")
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("Expected 2 active sessions, got %d", len(sessions))
+	}
+
+	session, err := s.GetSession("session1")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if session == nil || session.DeviceIP != "8.8.8.8" {
+		t.Errorf("Expected session1 to be readable, got %+v", session)
+	}
+
+	invalidated, err := s.Exists("session2")
+	if err != nil {
+		t.Fatalf("Failed to check invalidation: %v", err)
+	}
+	if !invalidated {
+		t.Error("session2 should be invalidated")
+	}
+}
+
+func TestSQLiteMemoryPath(t *testing.T) {
+	s, err := NewSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create in-memory SQLite store: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Save(newTestSession("session1", "user1")); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+	exists, err := s.SessionExists("session1")
+	if err != nil {
+		t.Fatalf("Failed to check session: %v", err)
+	}
+	if !exists {
+		t.Error("Session saved to :memory: should be readable")
+	}
+}
+
+func TestSQLiteMemoryConformance(t *testing.T) {
+	RunSessionStoreConformance(t, func() SessionStore {
+		s, err := NewSQLiteMemory()
+		if err != nil {
+			t.Fatalf("Failed to create in-memory SQLite store: %v", err)
+		}
+		return s
+	})
+}
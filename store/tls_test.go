@@ -0,0 +1,85 @@
+//go:build integration
+
+package store
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestTLSConfig returns a TLS config trusting the PEM CA certificate in
+// the file named by HEIMDALL_TEST_TLS_CA.
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	caFile := os.Getenv("HEIMDALL_TEST_TLS_CA")
+	if caFile == "" {
+		t.Skip("HEIMDALL_TEST_TLS_CA not set")
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatalf("Failed to read CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		t.Fatalf("No certificates found in %s", caFile)
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+}
+
+// TestRedisTLS connects to the TLS-enabled Redis server in
+// HEIMDALL_TEST_REDIS_TLS_ADDR.
+func TestRedisTLS(t *testing.T) {
+	addr := os.Getenv("HEIMDALL_TEST_REDIS_TLS_ADDR")
+	if addr == "" {
+		t.Skip("HEIMDALL_TEST_REDIS_TLS_ADDR not set")
+	}
+
+	cache, err := NewRedisFromConfig(RedisConfig{
+		Addr:      addr,
+		DB:        15,
+		KeyPrefix: "heimdall:test:tls:",
+		TLSConfig: newTestTLSConfig(t),
+	})
+	if err != nil {
+		t.Fatalf("Failed to connect over TLS: %v", err)
+	}
+	defer cache.Close()
+
+	if err := cache.Set("session1", time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	exists, err := cache.Exists("session1")
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+	if !exists {
+		t.Error("Expected session1 to be invalidated")
+	}
+}
+
+// TestMySQLTLS connects to the TLS-enabled MySQL server in
+// HEIMDALL_TEST_MYSQL_TLS_DSN and checks the connection is encrypted.
+func TestMySQLTLS(t *testing.T) {
+	dsn := os.Getenv("HEIMDALL_TEST_MYSQL_TLS_DSN")
+	if dsn == "" {
+		t.Skip("HEIMDALL_TEST_MYSQL_TLS_DSN not set")
+	}
+
+	s, err := NewMySQLFromDSNWithOptions(dsn, MySQLOptions{TLSConfig: newTestTLSConfig(t)})
+	if err != nil {
+		t.Fatalf("Failed to connect over TLS: %v", err)
+	}
+	defer s.Close()
+
+	var name, cipher string
+	if err := s.db.QueryRow("SHOW SESSION STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher); err != nil {
+		t.Fatalf("Failed to query TLS status: %v", err)
+	}
+	if cipher == "" {
+		t.Error("Expected an encrypted connection")
+	}
+}
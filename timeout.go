@@ -0,0 +1,48 @@
+package heimdall
+
+import (
+	"fmt"
+	"time"
+)
+
+// storeCall runs call, the session store or invalidation cache operation op,
+// and reports its duration to observeStore. If call takes longer than
+// Config.OperationTimeout, storeCall returns ErrOperationTimeout without
+// waiting for it; the call then finishes in the background and its result
+// is discarded, so a timed-out write may still be applied.
+func storeCall[T any](h *Heimdall, op string, call func() (T, error)) (T, error) {
+	defer h.observeStore(op, time.Now())
+
+	if h.config.OperationTimeout <= 0 {
+		return call()
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value, err}
+	}()
+
+	timer := time.NewTimer(h.config.OperationTimeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-timer.C:
+		var zero T
+		return zero, fmt.Errorf("%w: %s", ErrOperationTimeout, op)
+	}
+}
+
+// storeExec is storeCall for operations returning only an error.
+func (h *Heimdall) storeExec(op string, call func() error) error {
+	_, err := storeCall(h, op, func() (struct{}, error) {
+		return struct{}{}, call()
+	})
+	return err
+}
@@ -0,0 +1,62 @@
+package heimdall
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// blockingStore is a SessionStore whose GetActiveByUser blocks until release
+// is closed, like a backend that stopped responding.
+type blockingStore struct {
+	store.SessionStore
+	release chan struct{}
+}
+
+func (s blockingStore) GetActiveByUser(userID string) ([]*store.Session, error) {
+	<-s.release
+	return s.SessionStore.GetActiveByUser(userID)
+}
+
+func TestOperationTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	h, err := New(Config{
+		SessionStore:      blockingStore{store.NewMemorySessionStore(), release},
+		InvalidationCache: store.NewMemoryCache(),
+		OperationTimeout:  20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	start := time.Now()
+	_, err = h.RegisterSession("user123", "session1", DeviceInfo{IP: "8.8.8.8"}, LocationInfo{}, 0)
+	if !errors.Is(err, ErrOperationTimeout) {
+		t.Fatalf("Expected ErrOperationTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected to fail fast, took %v", elapsed)
+	}
+
+	// Operations on a responsive backend are unaffected
+	if _, err := h.IsSessionInvalidated("session1"); err != nil {
+		t.Errorf("IsSessionInvalidated failed: %v", err)
+	}
+}
+
+func TestOperationTimeoutDisabledByDefault(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	if h.config.OperationTimeout != 0 {
+		t.Errorf("Expected OperationTimeout to be disabled by default, got %v", h.config.OperationTimeout)
+	}
+}
@@ -0,0 +1,60 @@
+package heimdall
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aadithya-v/heimdall/store"
+)
+
+// maxTimeSeriesBuckets caps the number of buckets LoginTimeSeries returns,
+// since stores allocate a count for each.
+const maxTimeSeriesBuckets = 10_000
+
+// TimeBucket is the number of logins in one interval of a LoginTimeSeries.
+type TimeBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// LoginTimeSeries returns the number of sessions the user created in each
+// bucket-long interval from from up to to, e.g. with a 24h bucket for a daily
+// activity graph. Every interval is returned, including empty ones; the last
+// may be cut short by to. Stores implementing store.LoginCountStore count
+// expired and invalidated sessions too; for other stores only active
+// sessions are counted. Returns ErrInvalidTimeRange if to is not after
+// from, bucket is shorter than a second, or the range would need more than
+// 10,000 buckets.
+func (h *Heimdall) LoginTimeSeries(userID string, from, to time.Time, bucket time.Duration) ([]TimeBucket, error) {
+	if !to.After(from) || bucket < time.Second {
+		return nil, ErrInvalidTimeRange
+	}
+	if (to.Sub(from)-1)/bucket >= maxTimeSeriesBuckets {
+		return nil, fmt.Errorf("%w: more than %d buckets", ErrInvalidTimeRange, maxTimeSeriesBuckets)
+	}
+
+	var counts []int
+	if countStore, ok := store.Optional[store.LoginCountStore](h.sessions); ok {
+		var err error
+		counts, err = storeCall(h, "CountLoginsByBucket", func() ([]int, error) {
+			return countStore.CountLoginsByBucket(userID, from, to, bucket)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("heimdall: failed to count logins: %w", err)
+		}
+	} else {
+		sessions, err := storeCall(h, "GetActiveByUser", func() ([]*store.Session, error) {
+			return h.sessions.GetActiveByUser(userID)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("heimdall: failed to count logins: %w", err)
+		}
+		counts = store.BucketLogins(sessions, from, to, bucket)
+	}
+
+	series := make([]TimeBucket, len(counts))
+	for i, count := range counts {
+		series[i] = TimeBucket{Start: from.Add(time.Duration(i) * bucket), Count: count}
+	}
+	return series, nil
+}
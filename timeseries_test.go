@@ -0,0 +1,84 @@
+package heimdall
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginTimeSeries(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	logins := []struct {
+		userID, sessionID string
+		at                time.Time
+	}{
+		{"alice", "before", from.Add(-time.Second)},
+		{"alice", "day1a", from},
+		{"alice", "day1b", from.Add(23 * time.Hour)},
+		{"alice", "day3", from.Add(48*time.Hour + 30*time.Minute)},
+		{"alice", "day4", from.Add(72*time.Hour + time.Hour)},
+		{"alice", "after", from.Add(84 * time.Hour)},
+		{"bob", "bob1", from.Add(time.Hour)},
+	}
+	for _, l := range logins {
+		opts := RegisterOptions{CreatedAt: l.at}
+		if _, err := h.RegisterSessionWithOptions(l.userID, l.sessionID, DeviceInfo{IP: "8.8.8.8"}, LocationInfo{}, 0, opts); err != nil {
+			t.Fatalf("Failed to register session: %v", err)
+		}
+	}
+	if err := h.InvalidateSession("day1b"); err != nil {
+		t.Fatalf("Failed to invalidate session: %v", err)
+	}
+
+	// The last bucket is cut short at 12:00 on the fourth day
+	series, err := h.LoginTimeSeries("alice", from, from.Add(84*time.Hour), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("LoginTimeSeries failed: %v", err)
+	}
+
+	want := []int{2, 0, 1, 1}
+	if len(series) != len(want) {
+		t.Fatalf("Expected %d buckets, got %d", len(want), len(series))
+	}
+	for i, b := range series {
+		if start := from.Add(time.Duration(i) * 24 * time.Hour); !b.Start.Equal(start) {
+			t.Errorf("Bucket %d: expected start %v, got %v", i, start, b.Start)
+		}
+		if b.Count != want[i] {
+			t.Errorf("Bucket %d: expected count %d, got %d", i, want[i], b.Count)
+		}
+	}
+}
+
+func TestLoginTimeSeriesInvalidRange(t *testing.T) {
+	h, err := newTestHeimdall()
+	if err != nil {
+		t.Fatalf("Failed to create Heimdall: %v", err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	tests := []struct {
+		from, to time.Time
+		bucket   time.Duration
+	}{
+		{now, now, time.Hour},
+		{now, now.Add(-time.Hour), time.Hour},
+		{now, now.Add(time.Hour), time.Millisecond},
+		{now, now.Add(10_000*time.Second + 1), time.Second}, // 10,001 buckets
+		{now.AddDate(-5, 0, 0), now, time.Second},
+	}
+	for _, tt := range tests {
+		_, err := h.LoginTimeSeries("alice", tt.from, tt.to, tt.bucket)
+		if !errors.Is(err, ErrInvalidTimeRange) {
+			t.Errorf("%s: expected ErrInvalidTimeRange, got %v", fmt.Sprint(tt.to.Sub(tt.from), "/", tt.bucket), err)
+		}
+	}
+}